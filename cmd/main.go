@@ -2,20 +2,29 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/dispatcher"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/broker"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/health"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/journal"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/outbox"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/storage"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/trace"
 )
 
+const configPath = "./config.yaml"
+
 func main() {
 	cfg := config.Settings{}
 	if err := cfg.LoadFromEnv(); err != nil {
@@ -28,11 +37,15 @@ func main() {
 
 	// Tracer
 	provider, err := trace.NewProvider(trace.ProviderConfig{
-		JaegerEndpoint: fmt.Sprintf("%s/api/traces", cfg.TraceURL),
-		ServiceName:    cfg.TraceServiceName,
-		ServiceVersion: cfg.ServiceVersion,
-		Environment:    cfg.Env,
-		Disabled:       !cfg.TraceEnabled,
+		Exporter:           cfg.TraceExporter,
+		Endpoint:           cfg.TraceURL,
+		Insecure:           cfg.TraceInsecure,
+		SampleRatio:        cfg.TraceSampleRatio,
+		ServiceName:        cfg.TraceServiceName,
+		ServiceVersion:     cfg.ServiceVersion,
+		Environment:        cfg.Env,
+		ResourceAttributes: cfg.TraceResourceAttributes,
+		Disabled:           !cfg.TraceEnabled,
 	})
 	if err != nil {
 		logger.Fatal(err)
@@ -40,38 +53,155 @@ func main() {
 	defer provider.Close(context.Background())
 
 	// Broker
-	brokerService, err := broker.NewRabbitMqClient(cfg.BrokerConfig)
+	brokerService, err := broker.New(cfg.BrokerConfig)
 	if err != nil {
 		panic(err)
 	}
 	defer brokerService.Close()
 
 	// Storage
-	storage := storage.NewS3Storage(cfg.StorageConfig, cfg.AwsRegion)
+	storage, err := storage.New(cfg.StorageConfig)
+	if err != nil {
+		panic(err)
+	}
 
 	// FileSerrver
-	fileServer, err := fileserver.NewLocalFileServer(cfg.FileServerConfig)
+	fileServer, err := fileserver.New(cfg.FileServerConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	if closer, ok := fileServer.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// Journal
+	journal, err := journal.New(cfg.JournalConfig)
+	if err != nil {
+		panic(err)
+	}
+	defer journal.Close()
+
+	// Outbox
+	outbox, err := outbox.New(cfg.OutboxConfig)
 	if err != nil {
 		panic(err)
 	}
+	defer outbox.Close()
 
 	// Run service
 	var dispatcherCfg dispatcher.Config
-	if err := dispatcherCfg.LoadFromYaml("./config.yaml"); err != nil {
+	if err := dispatcherCfg.LoadFromYaml(configPath); err != nil {
 		panic(err)
 	}
 
-	dispatcher, err := dispatcher.New(dispatcherCfg, storage, fileServer, brokerService)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	configChanges, err := dispatcher.WatchConfig(watchCtx, configPath)
+	if err != nil {
+		logger.Errorf("Failed to watch config file, only SIGHUP reloads it, %s", err)
+	}
+
+	dispatcher, err := dispatcher.New(dispatcherCfg, storage, fileServer, brokerService, journal, outbox)
 	if err != nil {
 		panic(err)
 	}
+	defer dispatcher.Close()
 
 	dispatcher.Start()
 
+	// Health checks
+	readiness := health.NewChecks()
+	liveness := health.NewChecks()
+
+	readiness.Add("broker", brokerService)
+	readiness.Add("storage", storage)
+	readiness.Add("fileServer", fileServer)
+	dispatcher.RegisterChecks(readiness, liveness, cfg.HTTPConfig.LivenessFactor)
+
+	// HTTP Server
+	server := newHTTPServer(cfg.HTTPConfig, readiness, liveness, dispatcher)
+	if server != nil {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("HTTP server failed, %s", err)
+			}
+		}()
+	}
+
+	// Config reload
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
-	<-quit
-	dispatcher.Stop()
+	for running := true; running; {
+		select {
+		case <-quit:
+			running = false
+		case <-reload:
+			reloadConfig(dispatcher, cfg.ShutdownTimeout)
+		case _, ok := <-configChanges:
+			if !ok {
+				configChanges = nil
+
+				continue
+			}
+
+			reloadConfig(dispatcher, cfg.ShutdownTimeout)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := dispatcher.Stop(ctx); err != nil {
+		logger.Errorf("Failed to stop gracefully, %s", err)
+	}
+
+	if server != nil {
+		_ = server.Shutdown(ctx)
+	}
+}
+
+// Apply the config file on the running dispatcher, the current config is kept when the file is invalid.
+func reloadConfig(d *dispatcher.Dispatcher, timeout time.Duration) {
+	var dispatcherCfg dispatcher.Config
+	if err := dispatcherCfg.LoadFromYaml(configPath); err != nil {
+		logger.Errorf("Failed to load config file, keeping the current config, %s", err)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := d.Reload(ctx, dispatcherCfg); err != nil {
+		logger.Errorf("Failed to reload config, %s", err)
+	}
+}
+
+func newHTTPServer(cfg config.HTTPConfig, readiness, liveness *health.Checks, d *dispatcher.Dispatcher) *http.Server {
+	if cfg.Address == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", liveness.Handler(cfg.HealthTimeout))
+	mux.Handle("/readyz", readiness.Handler(cfg.HealthTimeout))
+	mux.Handle("/dead-letters/replay", dispatcher.DeadLettersHandler(d.ReplayDeadLetters))
+	mux.Handle("/dead-letters/discard", dispatcher.DeadLettersHandler(d.DiscardDeadLetters))
+
+	if cfg.MetricsEnabled {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+
+	return &http.Server{
+		Addr:              cfg.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
 }
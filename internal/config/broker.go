@@ -1,8 +1,16 @@
 package config
 
+import "time"
+
 type BrokerConfig struct {
-	Host     string `envconfig:"BROKER_URL" default:"localhost"`
-	Port     string `envconfig:"BROKER_PORT" default:"5672"`
-	User     string `envconfig:"BROKER_USER" default:"guest"`
-	Password string `envconfig:"BROKER_PASSWORD" default:"guest"`
+	Type     string `envconfig:"BROKER_TYPE" default:"rabbitmq" yaml:"type" json:"type"`
+	Host     string `envconfig:"BROKER_URL" default:"localhost" yaml:"host" json:"host"`
+	Port     string `envconfig:"BROKER_PORT" default:"5672" yaml:"port" json:"port"`
+	User     string `envconfig:"BROKER_USER" default:"guest" yaml:"user" json:"user"`
+	Password string `envconfig:"BROKER_PASSWORD" default:"guest" yaml:"password" json:"password"`
+	Region   string `envconfig:"AWS_REGION" default:"sa-east-1" yaml:"region" json:"region"`
+
+	ConfirmTimeout time.Duration `envconfig:"BROKER_CONFIRM_TIMEOUT" default:"5s" yaml:"confirmTimeout" json:"confirmTimeout"`
+	// Format of the sent messages: json, cloudevents-structured or cloudevents-binary
+	EventFormat string `envconfig:"BROKER_EVENT_FORMAT" default:"json" yaml:"eventFormat" json:"eventFormat"`
 }
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Set the fields with a default tag to its value, like envconfig does but without reading the environment,
+// so the backends declared in config.yaml get the same defaults of the ones configured by env.
+func ApplyDefaults(spec interface{}) error {
+	value := reflect.ValueOf(spec)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return errors.New("defaults: spec must be a struct pointer")
+	}
+
+	return applyDefaults(value.Elem())
+}
+
+func applyDefaults(value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		fieldType := value.Type().Field(i)
+
+		if !field.CanSet() {
+			continue
+		}
+
+		if field.Kind() == reflect.Struct {
+			if err := applyDefaults(field); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		def, ok := fieldType.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+
+		if field.Kind() == reflect.String {
+			field.SetString(def)
+
+			continue
+		}
+
+		// The yaml decoder parses the numbers, booleans and durations like envconfig.
+		if err := yaml.Unmarshal([]byte(def), field.Addr().Interface()); err != nil {
+			return errors.Wrapf(err, "default of %s", fieldType.Name)
+		}
+	}
+
+	return nil
+}
@@ -1,10 +1,67 @@
 package config
 
+import "time"
+
 type FileServerConfig struct {
-	Server     string `envconfig:"FILE_SERVER_URL" default:"localhost:22"`
-	User       string `envconfig:"FILE_SERVER_USER" default:"admin"`
-	Password   string `envconfig:"FILE_SERVER_PASSWORD" default:"secret"`
-	PrivateKey string `envconfig:"FILE_SERVER_PRIVATE_KEY"`
+	Type       string `envconfig:"FILE_SERVER_TYPE" default:"local" yaml:"type" json:"type"`
+	Server     string `envconfig:"FILE_SERVER_URL" default:"localhost:22" yaml:"server" json:"server"`
+	User       string `envconfig:"FILE_SERVER_USER" default:"admin" yaml:"user" json:"user"`
+	Password   string `envconfig:"FILE_SERVER_PASSWORD" default:"secret" yaml:"password" json:"password"`
+	PrivateKey string `envconfig:"FILE_SERVER_PRIVATE_KEY" yaml:"privateKey" json:"privateKey"`
+	// Path of the private key, used instead of PrivateKey when informed
+	PrivateKeyFile       string `envconfig:"FILE_SERVER_PRIVATE_KEY_FILE" yaml:"privateKeyFile" json:"privateKeyFile"`
+	PrivateKeyPassphrase string `envconfig:"FILE_SERVER_PRIVATE_KEY_PASSPHRASE" yaml:"privateKeyPassphrase" json:"privateKeyPassphrase"`
+	// Authenticate with the keys of the ssh-agent listening at SSH_AUTH_SOCK
+	UseAgent bool `envconfig:"FILE_SERVER_USE_AGENT" default:"false" yaml:"useAgent" json:"useAgent"`
+
+	// Comma separated paths of known_hosts files used to verify the server host key
+	KnownHosts string `envconfig:"FILE_SERVER_KNOWN_HOSTS" yaml:"knownHosts" json:"knownHosts"`
+	// Comma separated fingerprints accepted as the server host key, like SHA256:<base64>
+	HostKeyFingerprints string `envconfig:"FILE_SERVER_HOST_KEY_FINGERPRINTS" yaml:"hostKeyFingerprints" json:"hostKeyFingerprints"`
+	// Accept any server host key when neither KnownHosts nor HostKeyFingerprints are informed, vulnerable to MITM
+	InsecureIgnoreHostKey bool `envconfig:"FILE_SERVER_INSECURE_IGNORE_HOST_KEY" default:"false" yaml:"insecureIgnoreHostKey" json:"insecureIgnoreHostKey"`
+
+	// Comma separated SSH algorithms, required by legacy servers, the defaults are used when empty
+	KeyExchanges      string `envconfig:"FILE_SERVER_KEY_EXCHANGES" yaml:"keyExchanges" json:"keyExchanges"`
+	Ciphers           string `envconfig:"FILE_SERVER_CIPHERS" yaml:"ciphers" json:"ciphers"`
+	MACs              string `envconfig:"FILE_SERVER_MACS" yaml:"macs" json:"macs"`
+	HostKeyAlgorithms string `envconfig:"FILE_SERVER_HOST_KEY_ALGORITHMS" yaml:"hostKeyAlgorithms" json:"hostKeyAlgorithms"`
+
+	// FTP TLS mode: none, explicit (AUTH TLS) or implicit
+	FTPTLSMode string `envconfig:"FILE_SERVER_FTP_TLS" default:"none" yaml:"ftpTLS" json:"ftpTLS"`
+	// Open the FTP data connections in active mode, where the server connects to the collector
+	FTPActiveMode bool `envconfig:"FILE_SERVER_FTP_ACTIVE" default:"false" yaml:"ftpActive" json:"ftpActive"`
+	// Address listened for the active data connections, defaults to the control connection address with a random port
+	FTPActiveListenAddr string `envconfig:"FILE_SERVER_FTP_ACTIVE_LISTEN_ADDR" yaml:"ftpActiveListenAddr" json:"ftpActiveListenAddr"`
+	// CA certificates used to verify the FTPS server, besides the system ones
+	TLSCAFile             string `envconfig:"FILE_SERVER_TLS_CA_FILE" yaml:"tlsCAFile" json:"tlsCAFile"`
+	TLSInsecureSkipVerify bool   `envconfig:"FILE_SERVER_TLS_INSECURE_SKIP_VERIFY" default:"false" yaml:"tlsInsecureSkipVerify" json:"tlsInsecureSkipVerify"`
+
+	// S3 source: bucket where the files are collected, the patterns are matched against the object keys
+	S3Bucket string `envconfig:"FILE_SERVER_S3_BUCKET" yaml:"s3Bucket" json:"s3Bucket"`
+	S3Region string `envconfig:"FILE_SERVER_S3_REGION" default:"sa-east-1" yaml:"s3Region" json:"s3Region"`
+	// Endpoint of a S3 compatible service, empty uses AWS
+	S3Endpoint string `envconfig:"FILE_SERVER_S3_ENDPOINT" yaml:"s3Endpoint" json:"s3Endpoint"`
+	// Address the bucket at the path instead of the host name, usually required by the S3 compatible services
+	S3PathStyle bool `envconfig:"FILE_SERVER_S3_PATH_STYLE" default:"false" yaml:"s3PathStyle" json:"s3PathStyle"`
+	// Static credentials, when empty the AWS default credentials chain is used
+	S3AccessKeyID     string `envconfig:"FILE_SERVER_S3_ACCESS_KEY_ID" yaml:"s3AccessKeyId" json:"s3AccessKeyId"`
+	S3SecretAccessKey string `envconfig:"FILE_SERVER_S3_SECRET_ACCESS_KEY" yaml:"s3SecretAccessKey" json:"s3SecretAccessKey"`
+	// Create the lock objects with If-None-Match, disable it when the service doesn't support conditional writes
+	S3ConditionalWrites bool `envconfig:"FILE_SERVER_S3_CONDITIONAL_WRITES" default:"true" yaml:"s3ConditionalWrites" json:"s3ConditionalWrites"`
+
+	// Max connections opened with the SFTP or FTP server, shared by the concurrent operations
+	MaxConnections int `envconfig:"FILE_SERVER_MAX_CONNECTIONS" default:"4" yaml:"maxConnections" json:"maxConnections"`
+	// Max concurrent requests of a file transfer, 0 uses the SFTP client default
+	MaxConcurrentRequests int `envconfig:"FILE_SERVER_MAX_CONCURRENT_REQUESTS" default:"64" yaml:"maxConcurrentRequests" json:"maxConcurrentRequests"`
+	// Max time of each operation, like listing or opening a file, 0 disables it
+	Timeout time.Duration `envconfig:"FILE_SERVER_TIMEOUT" default:"1m" yaml:"timeout" json:"timeout"`
+	// Attempts to connect to the server, the delay between them starts at the backoff and is doubled on each attempt
+	ReconnectAttempts int           `envconfig:"FILE_SERVER_RECONNECT_ATTEMPTS" default:"3" yaml:"reconnectAttempts" json:"reconnectAttempts"`
+	ReconnectBackoff  time.Duration `envconfig:"FILE_SERVER_RECONNECT_BACKOFF" default:"1s" yaml:"reconnectBackoff" json:"reconnectBackoff"`
 
-	KeyExchanges string `envconfig:"FILE_SERVER_KEY_EXCHANGES"`
+	// Identifies the replica at the lock files of the remote sources, defaults to the host name and process id
+	LockOwner string `envconfig:"FILE_SERVER_LOCK_OWNER" yaml:"lockOwner" json:"lockOwner"`
+	// Time a lock file is valid without being renewed, after that it can be taken over by another replica
+	LockLease time.Duration `envconfig:"FILE_SERVER_LOCK_LEASE" default:"1m" yaml:"lockLease" json:"lockLease"`
 }
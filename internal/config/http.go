@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+type HTTPConfig struct {
+	// Address of the HTTP server exposing the metrics and health checks, empty disables the server
+	Address string `envconfig:"HTTP_ADDRESS" default:":9090"`
+	// Expose the prometheus metrics at /metrics
+	MetricsEnabled bool `envconfig:"METRICS_ENABLED" default:"true"`
+	// Timeout of each check of /healthz and /readyz
+	HealthTimeout time.Duration `envconfig:"HEALTH_TIMEOUT" default:"5s"`
+	// /healthz fails when a sender loop doesn't complete within this factor times its delay
+	LivenessFactor int `envconfig:"HEALTH_LIVENESS_FACTOR" default:"10"`
+}
@@ -0,0 +1,10 @@
+package config
+
+type JournalConfig struct {
+	// When disabled the journal is kept only in memory and is lost on restart
+	Enabled bool `envconfig:"JOURNAL_ENABLED" default:"true"`
+	// Directory where the journal file is written
+	Directory string `envconfig:"JOURNAL_DIR" default:"./journal"`
+	// Hours to keep entries of finished files (moved, published or failed), 0 keeps them forever
+	RetentionHours int `envconfig:"JOURNAL_RETENTION_HOURS" default:"168"`
+}
@@ -0,0 +1,8 @@
+package config
+
+type OutboxConfig struct {
+	// When disabled the events waiting for the broker are kept only in memory and are lost on restart
+	Enabled bool `envconfig:"OUTBOX_ENABLED" default:"true"`
+	// Directory where the outbox file is written
+	Directory string `envconfig:"OUTBOX_DIR" default:"./outbox"`
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -13,17 +14,28 @@ type Settings struct {
 	ServiceVersion string `envconfig:"SERVICE_VERSION" default:"0.0.0"`
 	Env            string `envconfig:"ENVIRONMENT" default:"dev"`
 	Debug          bool   `envconfig:"DEBUG" default:"false"`
-
-	AwsRegion string `envconfig:"AWS_REGION" default:"sa-east-1"`
+	// Time to wait the files being processed and the pending events when stopping
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
 
 	TraceServiceName string `envconfig:"TRACE_SERVICE_NAME"`
-	TraceURL         string `envconfig:"TRACE_URL" default:"http://localhost:14268"`
 	TraceEnabled     bool   `envconfig:"TRACE_ENABLED" defult:"false"`
+	// Exporter of the spans: jaeger, otlp-grpc, otlp-http or stdout
+	TraceExporter string `envconfig:"TRACE_EXPORTER" default:"jaeger"`
+	// Collector endpoint, when empty the default of the exporter is used
+	TraceURL      string `envconfig:"TRACE_URL"`
+	TraceInsecure bool   `envconfig:"TRACE_INSECURE" default:"false"`
+	// Fraction of the traces that are sampled, from 0 to 1
+	TraceSampleRatio float64 `envconfig:"TRACE_SAMPLE_RATIO" default:"1"`
+	// Extra resource attributes, as key:value pairs separated by commas
+	TraceResourceAttributes map[string]string `envconfig:"TRACE_RESOURCE_ATTRIBUTES"`
 
 	BrokerConfig     BrokerConfig
 	StorageConfig    StorageConfig
 	FileServerConfig FileServerConfig
 	LoggerConfig     LoggerConfig
+	JournalConfig    JournalConfig
+	OutboxConfig     OutboxConfig
+	HTTPConfig       HTTPConfig
 }
 
 func (s *Settings) LoadFromEnv() error {
@@ -1,8 +1,10 @@
 package config
 
 type StorageConfig struct {
-	URL    string `envconfig:"STORAGE_HOST" default:"http://localhost.localstack.cloud:4566"`
-	User   string `envconfig:"STORAGE_USER"`
-	Key    string `envconfig:"STORAGE_KEY"`
-	Bucket string `envconfig:"STORAGE_BUCKET" default:"collector-files"`
+	Type   string `envconfig:"STORAGE_TYPE" default:"s3" yaml:"type" json:"type"`
+	URL    string `envconfig:"STORAGE_HOST" default:"http://localhost.localstack.cloud:4566" yaml:"url" json:"url"`
+	User   string `envconfig:"STORAGE_USER" yaml:"user" json:"user"`
+	Key    string `envconfig:"STORAGE_KEY" yaml:"key" json:"key"`
+	Bucket string `envconfig:"STORAGE_BUCKET" default:"collector-files" yaml:"bucket" json:"bucket"`
+	Region string `envconfig:"AWS_REGION" default:"sa-east-1" yaml:"region" json:"region"`
 }
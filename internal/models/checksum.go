@@ -0,0 +1,27 @@
+package models
+
+import "encoding/hex"
+
+// Digests of the file content, SHA256 is always computed, MD5 and CRC32C are optional.
+type Checksum struct {
+	SHA256 []byte `json:",omitempty"`
+	MD5    []byte `json:",omitempty"`
+	CRC32C []byte `json:",omitempty"`
+}
+
+func (c Checksum) IsEmpty() bool {
+	return len(c.SHA256) == 0 && len(c.MD5) == 0 && len(c.CRC32C) == 0
+}
+
+// Hex encoded digests indexed by algorithm name, empty digests are omitted.
+func (c Checksum) Hex() map[string]string {
+	digests := map[string]string{}
+
+	for name, digest := range map[string][]byte{"sha256": c.SHA256, "md5": c.MD5, "crc32c": c.CRC32C} {
+		if len(digest) > 0 {
+			digests[name] = hex.EncodeToString(digest)
+		}
+	}
+
+	return digests
+}
@@ -2,18 +2,35 @@ package models
 
 import (
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Event struct {
+	// Unique ID, kept when the event is sent again so the consumers can discard duplicates
+	ID    string `json:",omitempty"`
 	Topic string
 	Key   string
-	Data  any
+	// Who produced the event and what it is about, as a URI reference and the file key
+	Source  string `json:",omitempty"`
+	Subject string `json:",omitempty"`
+	Time    time.Time
+	// Relates the events of the same file
+	CorrelationID string `json:",omitempty"`
+	// Sent as the message headers on RabbitMQ and as the message attributes on SQS
+	Headers map[string]string `json:",omitempty"`
+	// W3C trace context of the span that produced the event, the brokers inject it on the messages
+	TraceContext map[string]string `json:",omitempty"`
+	Data         any
 }
 
 func NewEvent(topic, key string, data any) (Event, error) {
 	event := Event{
+		ID:    uuid.NewString(),
 		Topic: topic,
 		Key:   key,
+		Time:  time.Now().UTC(),
 		Data:  data,
 	}
 
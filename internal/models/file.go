@@ -13,6 +13,8 @@ type FileInfo struct {
 	Key      string
 	Size     int64
 	ModTime  time.Time
+	// Companion file signaling that the file is completely written, moved and removed with the file
+	MarkerPath string `json:",omitempty"`
 }
 
 type File struct {
@@ -76,6 +78,30 @@ func (f *File) Move(ctx context.Context, newPath string) error {
 	return f.controller.Move(ctx, f.FilePath, newPath)
 }
 
+func (f *File) Remove(ctx context.Context) error {
+	return f.controller.Remove(ctx, f.FilePath)
+}
+
+func (f *File) HasMarker() bool {
+	return f.MarkerPath != ""
+}
+
+// Move the marker file next to the new file path, keeping the marker suffix.
+func (f *File) MoveMarker(ctx context.Context, newFilePath string) error {
+	suffix := strings.TrimPrefix(f.MarkerPath, f.FilePath)
+
+	return f.controller.Move(ctx, f.MarkerPath, newFilePath+suffix)
+}
+
+func (f *File) RemoveMarker(ctx context.Context) error {
+	return f.controller.Remove(ctx, f.MarkerPath)
+}
+
+// Write data to another file at the same file server, like a sidecar file.
+func (f *File) WriteFile(ctx context.Context, filePath string, data []byte) error {
+	return f.controller.WriteFile(ctx, filePath, data)
+}
+
 func (f *File) Lock(ctx context.Context) error {
 	locker, err := f.controller.AcquireLock(ctx, f.FilePath)
 	if err != nil {
@@ -87,6 +113,15 @@ func (f *File) Lock(ctx context.Context) error {
 	return nil
 }
 
+// Closed when the lock is taken over by another owner, it's never closed for the locks that can't be lost.
+func (f *File) LockLost() <-chan struct{} {
+	if locker, ok := f.locker.(LeaseLocker); ok {
+		return locker.Lost()
+	}
+
+	return nil
+}
+
 func (f *File) Unlock(ctx context.Context) error {
 	if f.locker == nil {
 		return ErrFileIsNotLocked
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"mime"
+	"path"
+	"time"
+)
+
+// Version of the FileEventData schema, increased only on changes breaking the consumers.
+const FileEventVersion = "1"
+
+// Payload of the file events, the fields that aren't known when the file fails are omitted.
+type FileEventData struct {
+	Version      string            `json:"version"`
+	Bucket       string            `json:"bucket,omitempty"`
+	ObjectKey    string            `json:"object_key,omitempty"`
+	FileKey      string            `json:"file_key"`
+	FileName     string            `json:"file_name"`
+	OriginalPath string            `json:"original_path"`
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"content_type"`
+	Checksums    map[string]string `json:"checksums,omitempty"`
+	ModTime      time.Time         `json:"mod_time"`
+	CollectedAt  *time.Time        `json:"collected_at,omitempty"`
+	UploadedAt   *time.Time        `json:"uploaded_at,omitempty"`
+	SenderID     int               `json:"sender_id"`
+	Host         string            `json:"host"`
+	TraceID      string            `json:"trace_id,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+func NewFileEventData(info FileInfo) FileEventData {
+	return FileEventData{
+		Version:      FileEventVersion,
+		FileKey:      info.Key,
+		FileName:     info.Name,
+		OriginalPath: info.FilePath,
+		Size:         info.Size,
+		ContentType:  ContentType(info.Name),
+		ModTime:      info.ModTime,
+	}
+}
+
+// Content type guessed by the file extension.
+func ContentType(fileName string) string {
+	if contentType := mime.TypeByExtension(path.Ext(fileName)); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
@@ -6,14 +6,26 @@ import (
 	"io"
 )
 
-var ErrFileIsNotLocked = errors.New("file is not locked")
+var (
+	ErrFileIsNotLocked = errors.New("file is not locked")
+	ErrFileLocked      = errors.New("file is locked by another owner")
+	ErrLockLost        = errors.New("lock was taken over by another owner")
+)
 
 type Locker interface {
 	Unlock() error
 }
 
+// Locker whose lock can be taken over by another owner while it's held, like an expired lease.
+type LeaseLocker interface {
+	Locker
+	Lost() <-chan struct{}
+}
+
 type FileController interface {
 	Open(ctx context.Context, filepath string) (io.ReadSeekCloser, error)
 	Move(ctx context.Context, oldpath string, newpath string) error
+	Remove(ctx context.Context, filepath string) error
+	WriteFile(ctx context.Context, filepath string, data []byte) error
 	AcquireLock(ctx context.Context, filepath string) (Locker, error)
 }
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type FileState string
+
+// States of a file, in processing order.
+const (
+	FileCollected FileState = "collected"
+	FileUploading FileState = "uploading"
+	FileUploaded  FileState = "uploaded"
+	FileMoved     FileState = "moved"
+	FilePublished FileState = "published"
+	// The file was moved to the failed directory after exhausting the attempts
+	FileFailed FileState = "failed"
+)
+
+var fileStateOrder = map[FileState]int{ // nolint:gochecknoglobals
+	FileCollected: 1,
+	FileUploading: 2,
+	FileUploaded:  3,
+	FileMoved:     4,
+	FilePublished: 5,
+}
+
+// Check if the file already passed through the other state.
+func (s FileState) Reached(other FileState) bool {
+	return fileStateOrder[s] >= fileStateOrder[other]
+}
+
+// Check if the file don't need to be processed anymore.
+func (s FileState) IsDone() bool {
+	return s == FileFailed || s.Reached(FileMoved)
+}
+
+type JournalEntry struct {
+	FileInfo
+	Checksum  Checksum
+	Topic     string
+	State     FileState
+	UpdatedAt time.Time
+	// Kept from the entry recording the state, so they are known until the file is published
+	CollectedAt time.Time `json:",omitempty"`
+	UploadedAt  time.Time `json:",omitempty"`
+}
+
+func NewJournalEntry(info FileInfo, topic string, state FileState) JournalEntry {
+	return JournalEntry{
+		FileInfo:  info,
+		Topic:     topic,
+		State:     state,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// Identify the file by path, size and modification time, a file rewritten with
+// the same path is handled as a new file.
+func (e JournalEntry) ID() string {
+	return JournalID(e.FileInfo)
+}
+
+func JournalID(info FileInfo) string {
+	return fmt.Sprintf("%s:%d:%d", info.FilePath, info.Size, info.ModTime.UnixNano())
+}
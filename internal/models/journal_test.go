@@ -0,0 +1,41 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+func TestFileStateReachedShouldFollowProcessingOrder(t *testing.T) {
+	// Arrange
+	sut := models.FileUploaded
+
+	// Action & Assert
+	assert.True(t, sut.Reached(models.FileCollected))
+	assert.True(t, sut.Reached(models.FileUploaded))
+	assert.False(t, sut.Reached(models.FileMoved))
+}
+
+func TestFileStateIsDoneShouldReturnTrueAfterMoved(t *testing.T) {
+	// Assert
+	assert.False(t, models.FileState("").IsDone())
+	assert.False(t, models.FileUploaded.IsDone())
+	assert.True(t, models.FileMoved.IsDone())
+	assert.True(t, models.FilePublished.IsDone())
+}
+
+func TestJournalIDShouldChangeWhenFileIsRewritten(t *testing.T) {
+	// Arrange
+	modTime := time.Now()
+	info := models.FileInfo{FilePath: "/data/file.json", Size: 10, ModTime: modTime}
+	rewritten := models.FileInfo{FilePath: "/data/file.json", Size: 12, ModTime: modTime.Add(time.Second)}
+
+	// Action
+	id := models.JournalID(info)
+	rewrittenID := models.JournalID(rewritten)
+
+	// Assert
+	assert.NotEqual(t, id, rewrittenID)
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Event waiting at the outbox to be sent to the broker, the events of each stream are sent in order.
+type OutboxRecord struct {
+	ID        uint64    `json:"id"`
+	Stream    string    `json:"stream"`
+	Event     Event     `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+}
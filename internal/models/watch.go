@@ -0,0 +1,7 @@
+package models
+
+// File written or moved into a watched directory, with the collect pattern that matched it.
+type WatchEvent struct {
+	FilePath string
+	Pattern  string
+}
@@ -5,14 +5,23 @@ import (
 	"strings"
 
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
 )
 
 type Config struct {
 	// Patterns to collect files on file server
-	// Ex: ./files/*.json"
+	// Ex: ./files/*.json", ./files/**/*.json
 	MatchPatterns []string `yaml:"pattern" json:"pattern"`
+	// Patterns of the files and directories that should be ignored
+	// Ex: ./files/tmp/**, ./files/**/*.partial
+	Exclude []string `yaml:"exclude" json:"exclude"`
 	// Max files amount to collect on each collect loop
 	MaxCollectBatchSize int `yaml:"maxFilesBatch" json:"maxFilesBatch"`
+	// Go template of the file key at storage, default is {{.Name}}
+	// Ex: {{.RelDir}}/{{.CollectedAt.Format "2006/01/02"}}/{{.BaseName}}-{{.SHA256}}{{.Ext}}
+	KeyTemplate string `yaml:"keyTemplate" json:"keyTemplate"`
+	// Conditions to consider that the file is completely written
+	Stability StabilityConfig `yaml:"stability" json:"stability"`
 }
 
 func (c *Config) Validate() error {
@@ -25,6 +34,34 @@ func (c *Config) Validate() error {
 	for i, pattern := range c.MatchPatterns {
 		if strings.TrimSpace(pattern) == "" {
 			validator.AddError(fmt.Sprintf("MatchPattern[%d]", i), "field is required")
+		} else if !fileserver.ValidatePattern(pattern) {
+			validator.AddError(fmt.Sprintf("MatchPattern[%d]", i), "invalid pattern")
+		}
+	}
+
+	for i, pattern := range c.Exclude {
+		if strings.TrimSpace(pattern) == "" {
+			validator.AddError(fmt.Sprintf("Exclude[%d]", i), "field is required")
+		} else if !fileserver.ValidatePattern(pattern) {
+			validator.AddError(fmt.Sprintf("Exclude[%d]", i), "invalid pattern")
+		}
+	}
+
+	if _, err := parseKeyTemplate(c.KeyTemplate); err != nil {
+		validator.AddError("KeyTemplate", err.Error())
+	}
+
+	if c.Stability.MinAge < 0 {
+		validator.AddError("Stability.MinAge", "must be higher or equal then 0")
+	}
+
+	if c.Stability.StablePolls < 0 {
+		validator.AddError("Stability.StablePolls", "must be higher or equal then 0")
+	}
+
+	for i, marker := range c.Stability.Markers {
+		if strings.TrimSpace(marker) == "" {
+			validator.AddError(fmt.Sprintf("Stability.Markers[%d]", i), "field is required")
 		}
 	}
 
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+)
+
+const defaultKeyTemplate = "{{.Name}}"
+
+var ErrEmptyFileKey = errors.New("key template rendered an empty key")
+
+// Values available at the key template.
+type keyData struct {
+	Name        string
+	FilePath    string
+	Pattern     string
+	ModTime     time.Time
+	CollectedAt time.Time
+	Topic       string
+	Hostname    string
+
+	ctx    context.Context // nolint:containedctx
+	server services.FileServer
+	sha256 string
+}
+
+func (d *keyData) BaseName() string {
+	return strings.TrimSuffix(d.Name, d.Ext())
+}
+
+func (d *keyData) Ext() string {
+	return path.Ext(d.Name)
+}
+
+// Directory of the file relative to the static part of the matched pattern.
+func (d *keyData) RelDir() string {
+	base := filepath.FromSlash(fileserver.GlobBase(d.Pattern))
+	if filepath.IsAbs(d.FilePath) && !filepath.IsAbs(base) {
+		if absBase, err := filepath.Abs(base); err == nil {
+			base = absBase
+		}
+	}
+
+	rel, err := filepath.Rel(base, filepath.Dir(d.FilePath))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// Hex encoded SHA-256 of the file content, the file is only read when the template uses it.
+func (d *keyData) SHA256() (string, error) {
+	if d.sha256 != "" {
+		return d.sha256, nil
+	}
+
+	reader, err := d.server.Open(d.ctx, d.FilePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+
+	d.sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	return d.sha256, nil
+}
+
+type keyTemplate struct {
+	tmpl     *template.Template
+	topic    string
+	hostname string
+}
+
+func newKeyTemplate(text, topic string) (*keyTemplate, error) {
+	tmpl, err := parseKeyTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyTemplate{
+		tmpl:     tmpl,
+		topic:    topic,
+		hostname: hostname,
+	}, nil
+}
+
+func parseKeyTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		text = defaultKeyTemplate
+	}
+
+	return template.New("key").Option("missingkey=error").Parse(text)
+}
+
+func (k *keyTemplate) render(ctx context.Context, data keyData) (string, error) {
+	data.ctx = ctx
+	data.Topic = k.topic
+	data.Hostname = k.hostname
+
+	buf := bytes.Buffer{}
+	if err := k.tmpl.Execute(&buf, &data); err != nil {
+		return "", err
+	}
+
+	key := strings.TrimPrefix(path.Clean(buf.String()), "/")
+	if key == "" || key == "." {
+		return "", ErrEmptyFileKey
+	}
+
+	return key, nil
+}
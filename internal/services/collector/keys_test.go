@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderKeyShouldUseFileNameByDefault(t *testing.T) {
+	// Arrange
+	sut, err := newKeyTemplate("", "files")
+	assert.Nil(t, err)
+
+	// Action
+	key, err := sut.render(context.TODO(), keyData{Name: "orders.json", FilePath: "/data/orders.json"})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "orders.json", key)
+}
+
+func TestRenderKeyShouldRenderTemplate(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	filePath := filepath.Join(folder, "domain_1", "orders.json")
+	content := []byte(`{"id": 1}`)
+
+	assert.Nil(t, os.MkdirAll(filepath.Dir(filePath), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filePath, content, 0o600))
+
+	hash := sha256.Sum256(content)
+
+	// Arrange
+	sut, err := newKeyTemplate(
+		`{{.Topic}}/{{.RelDir}}/{{.CollectedAt.Format "2006/01/02"}}/{{.BaseName}}-{{.SHA256}}{{.Ext}}`, "files",
+	)
+	assert.Nil(t, err)
+
+	// Action
+	key, err := sut.render(context.TODO(), keyData{
+		Name:        "orders.json",
+		FilePath:    filePath,
+		Pattern:     filepath.Join(folder, "*", "*.json"),
+		CollectedAt: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		server:      newFileServer(),
+	})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "files/domain_1/2026/10/18/orders-"+hex.EncodeToString(hash[:])+".json", key)
+}
+
+func TestRenderKeyShouldReturnErrorWhenKeyIsEmpty(t *testing.T) {
+	// Arrange
+	sut, err := newKeyTemplate("{{.RelDir}}", "files")
+	assert.Nil(t, err)
+
+	// Action
+	_, err = sut.render(context.TODO(), keyData{Name: "orders.json", FilePath: "/data/orders.json"})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrEmptyFileKey)
+}
+
+func TestValidateConfigShouldReturnErrorWhenKeyTemplateIsInvalid(t *testing.T) {
+	// Arrange
+	sut := Config{MatchPatterns: []string{"./files/*.json"}, KeyTemplate: "{{.Name"}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "KeyTemplate: ")
+}
@@ -2,28 +2,45 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/trace"
 )
 
+var (
+	errAlreadyProcessed = errors.New("file is already processed")
+	errNotReady         = errors.New("file is not ready to be collected")
+	errNotDirectory     = errors.New("pattern base is not a directory")
+)
+
 type Collector struct {
 	ID           int
 	cfg          Config
+	keys         *keyTemplate
+	stability    *stabilityTracker
 	server       services.FileServer
+	journal      services.Journal
+	metrics      metrics.Sender
 	collectGroup *sync.WaitGroup
 	processGroup *sync.WaitGroup
 }
 
 func New(
 	processID int,
+	eventTopic string,
 	config Config,
 	fileServer services.FileServer,
+	journal services.Journal,
 	collectWaitGroup *sync.WaitGroup,
 	proccessGroup *sync.WaitGroup,
 ) (*Collector, error) {
@@ -31,10 +48,19 @@ func New(
 		return nil, err
 	}
 
+	keys, err := newKeyTemplate(config.KeyTemplate, eventTopic)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Collector{
 		ID:           processID,
 		cfg:          config,
+		keys:         keys,
+		stability:    newStabilityTracker(config.Stability, fileServer),
 		server:       fileServer,
+		journal:      journal,
+		metrics:      metrics.NewSender(processID, eventTopic),
 		collectGroup: collectWaitGroup,
 		processGroup: proccessGroup,
 	}, nil
@@ -44,6 +70,8 @@ func (c *Collector) CollectFiles(ctx context.Context, channel chan models.File)
 	ctx, span := trace.NewSpan(ctx, "collector.collectFiles")
 	defer span.End()
 
+	c.stability.nextPoll()
+
 	for _, pattern := range c.cfg.MatchPatterns {
 		c.collectGroup.Add(1)
 
@@ -63,7 +91,7 @@ func (c *Collector) collectFilesWithPattern(
 	trace.AddSpanTags(span, map[string]string{"pattern": pattern})
 	logger.Infof("[Collector %d] Collecting files with pattern: %s", c.ID, pattern)
 
-	collectedFiles, err := c.server.Glob(ctx, pattern)
+	collectedFiles, err := c.server.Glob(ctx, pattern, c.cfg.Exclude...)
 	if err != nil {
 		trace.AddSpanError(span, err)
 		trace.FailSpan(span, fmt.Sprintf("Error on collect files with pattern: %s", pattern))
@@ -72,6 +100,8 @@ func (c *Collector) collectFilesWithPattern(
 		return
 	}
 
+	c.metrics.FilesMatched(pattern, len(collectedFiles))
+
 	if len(collectedFiles) > 0 {
 		trace.AddSpanTags(span, map[string]string{"matchCount": strconv.Itoa(len(collectedFiles))})
 	}
@@ -83,18 +113,10 @@ func (c *Collector) collectFilesWithPattern(
 	}()
 
 	for _, fp := range collectedFiles {
-		model, err := c.createFileModel(ctx, fp)
-		if err != nil {
-			trace.AddSpanError(span, err)
-			trace.FailSpan(span, "Failed to create FileModel")
-			logger.Errorf("[Collector %d] Failed to create FileModel, %s", c.ID, err)
-
+		if !c.sendFile(ctx, channel, fp, pattern) {
 			continue
 		}
 
-		c.processGroup.Add(1)
-		channel <- model
-
 		sendedCount++
 		if c.cfg.MaxCollectBatchSize > 0 && sendedCount == c.cfg.MaxCollectBatchSize {
 			return
@@ -102,12 +124,167 @@ func (c *Collector) collectFilesWithPattern(
 	}
 }
 
-// Insert a timestamp at end of file name maintaining same file extension.
-func (c *Collector) createFileModel(ctx context.Context, filePath string) (models.File, error) {
+// Collect only the files notified by the file server, used by the watch mode instead of
+// globing all the patterns. The events don't count as a collect loop for the stability polls.
+func (c *Collector) CollectEvents(ctx context.Context, channel chan models.File, events []models.WatchEvent) {
+	c.collectGroup.Add(1)
+
+	go func() {
+		defer c.collectGroup.Done()
+
+		ctx, span := trace.NewSpan(ctx, "collector.collectEvents")
+		defer span.End()
+
+		trace.AddSpanTags(span, map[string]string{"eventCount": strconv.Itoa(len(events))})
+
+		sendedCount := 0
+
+		for _, event := range events {
+			c.metrics.FilesMatched(event.Pattern, 1)
+
+			if !c.sendFile(ctx, channel, event.FilePath, event.Pattern) {
+				continue
+			}
+
+			sendedCount++
+			if c.cfg.MaxCollectBatchSize > 0 && sendedCount == c.cfg.MaxCollectBatchSize {
+				break
+			}
+		}
+
+		trace.AddSpanTags(span, map[string]string{"sendedCount": strconv.Itoa(sendedCount)})
+	}()
+}
+
+// Send the file to the publishers, returns false when the file is skipped.
+func (c *Collector) sendFile(ctx context.Context, channel chan models.File, filePath, pattern string) bool {
+	span := trace.SpanFromContext(ctx)
+
+	model, err := c.createFileModel(ctx, filePath, pattern)
+	if err != nil {
+		// Files notified by the watcher may be already moved by a previous loop
+		if errors.Is(err, errAlreadyProcessed) || errors.Is(err, errNotReady) || errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+
+		trace.AddSpanError(span, err)
+		trace.FailSpan(span, "Failed to create FileModel")
+		logger.Errorf("[Collector %d] Failed to create FileModel, %s", c.ID, err)
+
+		return false
+	}
+
+	if !c.recordCollected(model) {
+		return false
+	}
+
+	c.processGroup.Add(1)
+	channel <- model
+
+	return true
+}
+
+// Check if the directories of the patterns are accessible on the file server.
+func (c *Collector) CheckDirectories(ctx context.Context) error {
+	for _, pattern := range c.cfg.MatchPatterns {
+		dir := fileserver.GlobBase(pattern)
+
+		info, err := c.server.Stat(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("%w: %s", errNotDirectory, dir)
+		}
+	}
+
+	return nil
+}
+
+// Check at journal if the file was already processed.
+func (c *Collector) isProcessed(entry models.JournalEntry, ok bool) bool {
+	if ok && entry.State.IsDone() {
+		logger.Debugf("[Collector %d] Skipping file '%s', it is already %s", c.ID, entry.FilePath, entry.State)
+
+		return true
+	}
+
+	return false
+}
+
+// Record the new files as collected at journal.
+func (c *Collector) recordCollected(file models.File) bool {
+	if _, ok := c.journal.Get(file.FileInfo); ok {
+		return true
+	}
+
+	entry := models.NewJournalEntry(file.FileInfo, "", models.FileCollected)
+	entry.CollectedAt = entry.UpdatedAt
+
+	if err := c.journal.Record(entry); err != nil {
+		logger.Errorf("[Collector %d] Failed to record file '%s' at journal, %s", c.ID, file.FilePath, err)
+
+		return false
+	}
+
+	return true
+}
+
+// Create the file model with the key rendered from the key template, the key is only rendered
+// for files that weren't collected yet, the others keep the key recorded at journal.
+func (c *Collector) createFileModel(ctx context.Context, filePath, pattern string) (models.File, error) {
+	if c.stability.isMarker(filePath) {
+		return models.File{}, errNotReady
+	}
+
 	info, err := c.server.Stat(ctx, filePath)
 	if err != nil {
 		return models.File{}, err
 	}
 
-	return models.NewFile(info.Name(), filePath, info.Name(), info.Size(), info.ModTime(), c.server)
+	entry, collected := c.journal.Get(models.FileInfo{FilePath: filePath, Size: info.Size(), ModTime: info.ModTime()})
+	if c.isProcessed(entry, collected) {
+		return models.File{}, errAlreadyProcessed
+	}
+
+	stable, marker := c.stability.isStable(ctx, filePath, info)
+	if !stable {
+		logger.Debugf("[Collector %d] File '%s' is not ready to be collected yet", c.ID, filePath)
+
+		return models.File{}, errNotReady
+	}
+
+	key, err := c.fileKey(ctx, entry, collected, filePath, pattern, info)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	file, err := models.NewFile(info.Name(), filePath, key, info.Size(), info.ModTime(), c.server)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	file.MarkerPath = marker
+
+	return file, nil
+}
+
+// A file already collected keeps its key, so a resumed upload and its event use the key that was written,
+// and a template using the SHA256 reads the file only once.
+func (c *Collector) fileKey(
+	ctx context.Context, entry models.JournalEntry, collected bool, filePath, pattern string, info fs.FileInfo,
+) (string, error) {
+	if collected && entry.Key != "" {
+		return entry.Key, nil
+	}
+
+	return c.keys.render(ctx, keyData{
+		Name:        info.Name(),
+		FilePath:    filePath,
+		Pattern:     pattern,
+		ModTime:     info.ModTime(),
+		CollectedAt: time.Now(),
+		server:      c.server,
+	})
 }
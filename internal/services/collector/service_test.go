@@ -12,6 +12,7 @@ import (
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/journal"
 )
 
 func createTempFile(dir, fileName string) (models.File, error) {
@@ -56,7 +57,7 @@ func newSut(patterns ...string) *Collector {
 		MatchPatterns: patterns,
 	}
 
-	collector, err := New(1, cfg, server, &sync.WaitGroup{}, &sync.WaitGroup{})
+	collector, err := New(1, "files", cfg, server, journal.NewMemoryJournal(), &sync.WaitGroup{}, &sync.WaitGroup{})
 	if err != nil {
 		panic(err)
 	}
@@ -129,3 +130,84 @@ func TestCollectFilesShouldReturnAllFilesWhenMaxCollectBatchSizeIsZero(t *testin
 	// Assert
 	assert.Equal(t, testFile1, f1)
 }
+
+func TestCollectFilesShouldSkipFilesAlreadyProcessed(t *testing.T) {
+	// Prepare
+	folder, err := ioutil.TempDir("", "*")
+	if err != nil {
+		panic(err)
+	}
+
+	pattern := path.Join(folder, "*.json")
+	sut := newSut(pattern)
+
+	// Arrange
+	processedFile, err := createTempFile(folder, "test_file_1.json")
+	assert.Nil(t, err)
+
+	pendingFile, err := createTempFile(folder, "test_file_2.json")
+	assert.Nil(t, err)
+
+	err = sut.journal.Record(models.NewJournalEntry(processedFile.FileInfo, "files", models.FilePublished))
+	assert.Nil(t, err)
+
+	fileChannel := make(chan models.File, 2)
+
+	// Action
+	sut.collectGroup.Add(1)
+	sut.collectFilesWithPattern(context.TODO(), fileChannel, pattern)
+
+	// Assert
+	assert.Len(t, fileChannel, 1)
+	assert.Equal(t, pendingFile, <-fileChannel)
+
+	entry, _ := sut.journal.Get(pendingFile.FileInfo)
+	assert.Equal(t, models.FileCollected, entry.State)
+}
+
+func TestCheckDirectoriesShouldReturnErrorWhenDirectoryDoesNotExist(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+
+	// Arrange
+	validSut := newSut(path.Join(folder, "*.json"))
+	invalidSut := newSut(path.Join(folder, "missing", "*.json"))
+
+	// Action
+	validErr := validSut.CheckDirectories(context.TODO())
+	invalidErr := invalidSut.CheckDirectories(context.TODO())
+
+	// Assert
+	assert.Nil(t, validErr)
+	assert.NotNil(t, invalidErr)
+}
+
+func TestCollectFilesShouldKeepKeyOfFilesAlreadyCollected(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	pattern := path.Join(folder, "*.json")
+
+	// Arrange
+	sut := newSut(pattern)
+	keys, err := newKeyTemplate(`{{.CollectedAt.UnixNano}}-{{.SHA256}}`, "files")
+	assert.Nil(t, err)
+
+	sut.keys = keys
+
+	uploadedFile, err := createTempFile(folder, "test_file_1.json")
+	assert.Nil(t, err)
+
+	uploadedFile.Key = "2022/previous-key.json"
+	err = sut.journal.Record(models.NewJournalEntry(uploadedFile.FileInfo, "files", models.FileUploaded))
+	assert.Nil(t, err)
+
+	fileChannel := make(chan models.File, 1)
+
+	// Action
+	sut.collectGroup.Add(1)
+	sut.collectFilesWithPattern(context.TODO(), fileChannel, pattern)
+
+	// Assert
+	assert.Len(t, fileChannel, 1)
+	assert.Equal(t, "2022/previous-key.json", (<-fileChannel).Key)
+}
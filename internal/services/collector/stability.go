@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
+)
+
+type StabilityConfig struct {
+	// Minimum time since the last modification of the file. Ex: 30s
+	MinAge time.Duration `yaml:"minAge" json:"minAge"`
+	// Number of consecutive collect loops the file size must stay unchanged, 0 disables the check
+	StablePolls int `yaml:"stablePolls" json:"stablePolls"`
+	// Suffixes of the companion marker file, the file is only collected when one of them exists.
+	// Ex: [.done, .ok] waits for orders.json.done or orders.json.ok
+	Markers []string `yaml:"markers" json:"markers"`
+}
+
+// Size observed of each file on the previous loops.
+type observation struct {
+	size     int64
+	modTime  time.Time
+	polls    int
+	lastPoll int
+}
+
+type stabilityTracker struct {
+	sync.Mutex
+	cfg          StabilityConfig
+	server       services.FileServer
+	poll         int
+	observations map[string]observation
+}
+
+func newStabilityTracker(cfg StabilityConfig, server services.FileServer) *stabilityTracker {
+	return &stabilityTracker{
+		cfg:          cfg,
+		server:       server,
+		observations: make(map[string]observation),
+	}
+}
+
+// Start a new collect loop, forgetting files that weren't seen on the previous one.
+func (st *stabilityTracker) nextPoll() {
+	st.Lock()
+	defer st.Unlock()
+
+	st.poll++
+
+	for filePath, obs := range st.observations {
+		if obs.lastPoll < st.poll-1 {
+			delete(st.observations, filePath)
+		}
+	}
+}
+
+// Check if the file is a marker of another file.
+func (st *stabilityTracker) isMarker(filePath string) bool {
+	for _, suffix := range st.cfg.Markers {
+		if strings.HasSuffix(filePath, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check if the file is ready to be collected, returning the marker path when markers are configured.
+func (st *stabilityTracker) isStable(ctx context.Context, filePath string, info fs.FileInfo) (bool, string) {
+	if st.cfg.MinAge > 0 && time.Since(info.ModTime()) < st.cfg.MinAge {
+		return false, ""
+	}
+
+	if st.cfg.StablePolls > 0 && !st.observe(filePath, info) {
+		return false, ""
+	}
+
+	if len(st.cfg.Markers) == 0 {
+		return true, ""
+	}
+
+	for _, suffix := range st.cfg.Markers {
+		markerPath := filePath + suffix
+		if _, err := st.server.Stat(ctx, markerPath); err == nil {
+			return true, markerPath
+		}
+	}
+
+	return false, ""
+}
+
+// Record the file size on the current loop, return true when it is unchanged for enough loops.
+func (st *stabilityTracker) observe(filePath string, info fs.FileInfo) bool {
+	st.Lock()
+	defer st.Unlock()
+
+	obs, ok := st.observations[filePath]
+	if !ok || obs.size != info.Size() || !obs.modTime.Equal(info.ModTime()) {
+		obs = observation{size: info.Size(), modTime: info.ModTime()}
+	} else if obs.lastPoll != st.poll {
+		obs.polls++
+	}
+
+	obs.lastPoll = st.poll
+	st.observations[filePath] = obs
+
+	return obs.polls >= st.cfg.StablePolls
+}
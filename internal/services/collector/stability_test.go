@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, filePath, content string) os.FileInfo {
+	t.Helper()
+
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte(content), 0o600))
+
+	info, err := os.Stat(filePath)
+	assert.Nil(t, err)
+
+	return info
+}
+
+func TestIsStableShouldWaitForMinAge(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.json")
+	info := writeFile(t, filePath, "{}")
+
+	// Arrange
+	sut := newStabilityTracker(StabilityConfig{MinAge: time.Hour}, newFileServer())
+
+	// Action
+	stable, _ := sut.isStable(context.TODO(), filePath, info)
+
+	// Assert
+	assert.False(t, stable)
+}
+
+func TestIsStableShouldWaitSizeUnchangedForPolls(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.json")
+
+	// Arrange
+	sut := newStabilityTracker(StabilityConfig{StablePolls: 2}, newFileServer())
+
+	// Action
+	results := []bool{}
+
+	for _, content := range []string{"{", "{}", "{}", "{}"} {
+		sut.nextPoll()
+
+		writeFile(t, filePath, content)
+
+		// Keep the same modification time, only the size changes
+		assert.Nil(t, os.Chtimes(filePath, time.Unix(1000, 0), time.Unix(1000, 0)))
+
+		info, err := os.Stat(filePath)
+		assert.Nil(t, err)
+
+		stable, _ := sut.isStable(context.TODO(), filePath, info)
+		results = append(results, stable)
+	}
+
+	// Assert
+	assert.Equal(t, []bool{false, false, false, true}, results)
+}
+
+func TestIsStableShouldWaitForMarker(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	filePath := filepath.Join(folder, "file.json")
+	info := writeFile(t, filePath, "{}")
+
+	// Arrange
+	sut := newStabilityTracker(StabilityConfig{Markers: []string{".done", ".ok"}}, newFileServer())
+
+	// Action
+	stableWithoutMarker, _ := sut.isStable(context.TODO(), filePath, info)
+
+	writeFile(t, filePath+".ok", "")
+	stableWithMarker, marker := sut.isStable(context.TODO(), filePath, info)
+
+	// Assert
+	assert.False(t, stableWithoutMarker)
+	assert.True(t, stableWithMarker)
+	assert.Equal(t, filePath+".ok", marker)
+	assert.True(t, sut.isMarker(marker))
+}
+
+func TestNextPollShouldForgetFilesNotSeen(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.json")
+	info := writeFile(t, filePath, "{}")
+
+	// Arrange
+	sut := newStabilityTracker(StabilityConfig{StablePolls: 1}, newFileServer())
+	sut.nextPoll()
+	sut.observe(filePath, info)
+
+	// Action
+	sut.nextPoll()
+	sut.nextPoll()
+
+	// Assert
+	assert.Empty(t, sut.observations)
+}
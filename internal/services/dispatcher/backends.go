@@ -0,0 +1,303 @@
+package dispatcher
+
+import (
+	"io"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/broker"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/health"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/storage"
+)
+
+// Backends declared on sender configs, each client is created once and shared by name.
+type backends struct {
+	fileServers map[string]fileserver.Client
+	storages    map[string]storage.Client
+	brokers     map[string]broker.Client
+
+	// Settings of each declared backend, used to reuse the clients when the config is reloaded
+	fileServerConfigs map[string]config.FileServerConfig
+	storageConfigs    map[string]config.StorageConfig
+	brokerConfigs     map[string]config.BrokerConfig
+
+	// Clients of the senders still stopping after a reload, closed once they are no longer used
+	retained []interface{}
+}
+
+func newBackends(configs []sender.Config) (*backends, error) {
+	return (*backends)(nil).reload(configs)
+}
+
+// Create the backends of the configs, reusing the clients of b whose settings didn't change.
+func (b *backends) reload(configs []sender.Config) (*backends, error) {
+	next := &backends{
+		fileServers:       make(map[string]fileserver.Client),
+		storages:          make(map[string]storage.Client),
+		brokers:           make(map[string]broker.Client),
+		fileServerConfigs: make(map[string]config.FileServerConfig),
+		storageConfigs:    make(map[string]config.StorageConfig),
+		brokerConfigs:     make(map[string]config.BrokerConfig),
+	}
+
+	for _, cfg := range configs {
+		if err := next.declare(cfg, b); err != nil {
+			next.closeExcept(b)
+
+			return nil, err
+		}
+	}
+
+	return next, nil
+}
+
+func (b *backends) declare(cfg sender.Config, previous *backends) error {
+	if cfg.FileServer != nil && !isReference(cfg.FileServer.Type) {
+		if _, ok := b.fileServers[cfg.FileServer.Name]; !ok {
+			client, ok := previous.reuseFileServer(cfg.FileServer)
+			if !ok {
+				var err error
+
+				if client, err = fileserver.New(cfg.FileServer.FileServerConfig); err != nil {
+					return err
+				}
+			}
+
+			b.fileServers[cfg.FileServer.Name] = client
+			b.fileServerConfigs[cfg.FileServer.Name] = cfg.FileServer.FileServerConfig
+		}
+	}
+
+	if cfg.Storage != nil && !isReference(cfg.Storage.Type) {
+		if _, ok := b.storages[cfg.Storage.Name]; !ok {
+			client, ok := previous.reuseStorage(cfg.Storage)
+			if !ok {
+				var err error
+
+				if client, err = storage.New(cfg.Storage.StorageConfig); err != nil {
+					return err
+				}
+			}
+
+			b.storages[cfg.Storage.Name] = client
+			b.storageConfigs[cfg.Storage.Name] = cfg.Storage.StorageConfig
+		}
+	}
+
+	if cfg.Broker != nil && !isReference(cfg.Broker.Type) {
+		if _, ok := b.brokers[cfg.Broker.Name]; !ok {
+			client, ok := previous.reuseBroker(cfg.Broker)
+			if !ok {
+				var err error
+
+				if client, err = broker.New(cfg.Broker.BrokerConfig); err != nil {
+					return err
+				}
+			}
+
+			b.brokers[cfg.Broker.Name] = client
+			b.brokerConfigs[cfg.Broker.Name] = cfg.Broker.BrokerConfig
+		}
+	}
+
+	return nil
+}
+
+func (b *backends) reuseFileServer(cfg *sender.FileServerConfig) (fileserver.Client, bool) {
+	if b == nil || b.fileServerConfigs[cfg.Name] != cfg.FileServerConfig {
+		return nil, false
+	}
+
+	client, ok := b.fileServers[cfg.Name]
+
+	return client, ok
+}
+
+func (b *backends) reuseStorage(cfg *sender.StorageConfig) (storage.Client, bool) {
+	if b == nil || b.storageConfigs[cfg.Name] != cfg.StorageConfig {
+		return nil, false
+	}
+
+	client, ok := b.storages[cfg.Name]
+
+	return client, ok
+}
+
+func (b *backends) reuseBroker(cfg *sender.BrokerConfig) (broker.Client, bool) {
+	if b == nil || b.brokerConfigs[cfg.Name] != cfg.BrokerConfig {
+		return nil, false
+	}
+
+	client, ok := b.brokers[cfg.Name]
+
+	return client, ok
+}
+
+// Check if the clients used by the sender are different on the other backends.
+func (b *backends) changed(cfg sender.Config, other *backends) bool {
+	if cfg.FileServer != nil && b.fileServers[cfg.FileServer.Name] != other.fileServers[cfg.FileServer.Name] {
+		return true
+	}
+
+	if cfg.Storage != nil && b.storages[cfg.Storage.Name] != other.storages[cfg.Storage.Name] {
+		return true
+	}
+
+	return cfg.Broker != nil && b.brokers[cfg.Broker.Name] != other.brokers[cfg.Broker.Name]
+}
+
+func (b *backends) fileServer(cfg sender.Config, fallback services.FileServer) services.FileServer {
+	if cfg.FileServer == nil {
+		return fallback
+	}
+
+	return b.fileServers[cfg.FileServer.Name]
+}
+
+func (b *backends) storage(cfg sender.Config, fallback services.Storage) services.Storage {
+	if cfg.Storage == nil {
+		return fallback
+	}
+
+	client := b.storages[cfg.Storage.Name]
+	if cfg.Storage.KeyPrefix != "" {
+		return storage.NewPrefixedStorage(client, cfg.Storage.KeyPrefix)
+	}
+
+	return client
+}
+
+func (b *backends) broker(cfg sender.Config, fallback services.Broker) services.Broker {
+	if cfg.Broker == nil {
+		return fallback
+	}
+
+	return b.brokers[cfg.Broker.Name]
+}
+
+// The clients declared by the sender config, empty when it uses the default ones.
+func (b *backends) declared(cfg sender.Config) []interface{} {
+	clients := []interface{}{}
+
+	if cfg.FileServer != nil {
+		clients = append(clients, b.fileServers[cfg.FileServer.Name])
+	}
+
+	if cfg.Storage != nil {
+		clients = append(clients, b.storages[cfg.Storage.Name])
+	}
+
+	if cfg.Broker != nil {
+		clients = append(clients, b.brokers[cfg.Broker.Name])
+	}
+
+	return clients
+}
+
+// Keep the clients of a sender that is still stopping, so they aren't closed while the sender uses them.
+func (b *backends) retain(clients []interface{}) {
+	for _, client := range clients {
+		if client != nil && !b.uses(client) {
+			b.retained = append(b.retained, client)
+		}
+	}
+}
+
+func (b *backends) uses(client interface{}) bool {
+	for _, declared := range b.fileServers {
+		if declared == client {
+			return true
+		}
+	}
+
+	for _, declared := range b.storages {
+		if declared == client {
+			return true
+		}
+	}
+
+	for _, declared := range b.brokers {
+		if declared == client {
+			return true
+		}
+	}
+
+	for _, retained := range b.retained {
+		if retained == client {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add the readiness checks of the backends.
+func (b *backends) registerChecks(readiness *health.Checks) {
+	for name, client := range b.fileServers {
+		readiness.Add("fileServer:"+name, client)
+	}
+
+	for name, client := range b.storages {
+		readiness.Add("storage:"+name, client)
+	}
+
+	for name, client := range b.brokers {
+		readiness.Add("broker:"+name, client)
+	}
+}
+
+func (b *backends) unregisterChecks(readiness *health.Checks) {
+	for name := range b.fileServers {
+		readiness.Remove("fileServer:" + name)
+	}
+
+	for name := range b.storages {
+		readiness.Remove("storage:" + name)
+	}
+
+	for name := range b.brokers {
+		readiness.Remove("broker:" + name)
+	}
+}
+
+// Close the clients created from sender configs.
+func (b *backends) Close() {
+	b.closeExcept(nil)
+}
+
+// Close the clients that aren't used by the other backends.
+func (b *backends) closeExcept(other *backends) {
+	for _, client := range b.fileServers {
+		closeUnused(client, other)
+	}
+
+	for _, client := range b.storages {
+		closeUnused(client, other)
+	}
+
+	for _, client := range b.brokers {
+		closeUnused(client, other)
+	}
+
+	for _, client := range b.retained {
+		closeUnused(client, other)
+	}
+}
+
+func closeUnused(client interface{}, other *backends) {
+	if other != nil && other.uses(client) {
+		return
+	}
+
+	switch client := client.(type) {
+	case broker.Client:
+		client.Close()
+	case io.Closer:
+		if err := client.Close(); err != nil {
+			logger.Errorf("[Dispatcher] Failed to close backend, %s", err)
+		}
+	}
+}
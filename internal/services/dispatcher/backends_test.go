@@ -0,0 +1,104 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/storage"
+)
+
+func TestNewBackendsShouldShareClientsByName(t *testing.T) {
+	// Prepare
+	first := newSenderConfig()
+	first.Storage = &sender.StorageConfig{Name: "files", StorageConfig: config.StorageConfig{Type: "memory"}}
+
+	second := newSenderConfig()
+	second.Storage = &sender.StorageConfig{Name: "files"}
+
+	// Arrange
+	sut, err := newBackends([]sender.Config{first, second})
+	assert.Nil(t, err)
+
+	// Action
+	firstStorage := sut.storage(first, nil)
+	secondStorage := sut.storage(second, nil)
+
+	// Assert
+	assert.Len(t, sut.storages, 1)
+	assert.Same(t, firstStorage, secondStorage)
+}
+
+func TestStorageShouldReturnFallbackWhenSenderHasNoStorage(t *testing.T) {
+	// Prepare
+	fallback := storage.NewMemoryStorage()
+
+	// Arrange
+	sut, err := newBackends([]sender.Config{newSenderConfig()})
+	assert.Nil(t, err)
+
+	// Action
+	result := sut.storage(newSenderConfig(), fallback)
+
+	// Assert
+	assert.Same(t, fallback, result)
+}
+
+func TestStorageShouldPrefixFileKeys(t *testing.T) {
+	// Prepare
+	cfg := newSenderConfig()
+	cfg.Storage = &sender.StorageConfig{
+		Name:          "files",
+		KeyPrefix:     "domain_1",
+		StorageConfig: config.StorageConfig{Type: "memory"},
+	}
+
+	// Arrange
+	sut, err := newBackends([]sender.Config{cfg})
+	assert.Nil(t, err)
+
+	// Action
+	result := sut.storage(cfg, nil)
+
+	// Assert
+	assert.IsType(t, &storage.PrefixedStorage{}, result)
+}
+
+func TestNewBackendsShouldReturnErrorWhenTypeIsUnknown(t *testing.T) {
+	// Prepare
+	cfg := newSenderConfig()
+	cfg.Broker = &sender.BrokerConfig{Name: "events", BrokerConfig: config.BrokerConfig{Type: "unknown"}}
+
+	// Action
+	_, err := newBackends([]sender.Config{cfg})
+
+	// Assert
+	assert.NotNil(t, err)
+}
+
+func TestReloadShouldReuseClientsWithSameSettings(t *testing.T) {
+	// Prepare
+	kept := newSenderConfig()
+	kept.Storage = &sender.StorageConfig{Name: "files", StorageConfig: config.StorageConfig{Type: "memory"}}
+
+	changed := newSenderConfig()
+	changed.Broker = &sender.BrokerConfig{Name: "events", BrokerConfig: config.BrokerConfig{Type: "memory"}}
+
+	sut, err := newBackends([]sender.Config{kept, changed})
+	assert.Nil(t, err)
+
+	// Arrange
+	changedAgain := newSenderConfig()
+	changedAgain.Broker = &sender.BrokerConfig{Name: "events", BrokerConfig: config.BrokerConfig{Type: "none"}}
+
+	// Action
+	result, err := sut.reload([]sender.Config{kept, changedAgain})
+	assert.Nil(t, err)
+
+	// Assert
+	assert.Same(t, sut.storages["files"], result.storages["files"])
+	assert.NotSame(t, sut.brokers["events"], result.brokers["events"])
+	assert.False(t, result.changed(kept, sut))
+	assert.True(t, result.changed(changedAgain, sut))
+}
@@ -3,7 +3,9 @@ package dispatcher
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
 	"gopkg.in/yaml.v3"
@@ -34,15 +36,89 @@ func (c Config) Validate() error {
 		validator.AddError("SenderConfig", "sender config is required")
 	}
 
+	names := map[string]bool{}
+
 	for nWorker, cfg := range c.SenderConfig {
 		if err := cfg.Validate(); err != nil {
 			validator.AddError(fmt.Sprintf("Worker[%d]", nWorker+1), err.Error())
 		}
+
+		if cfg.Name != "" && names[cfg.Name] {
+			validator.AddError(fmt.Sprintf("Worker[%d]", nWorker+1), fmt.Sprintf("name '%s' is already used", cfg.Name))
+		}
+
+		names[cfg.Name] = true
 	}
 
+	c.validateBackends(&validator)
+
 	if validator.HasErrors() {
 		return validator.GetError()
 	}
 
 	return nil
 }
+
+// Check that each named backend is declared only once and that every reference is declared.
+func (c Config) validateBackends(validator *models.Validator) {
+	fileServers := map[string]config.FileServerConfig{}
+	storages := map[string]config.StorageConfig{}
+	brokers := map[string]config.BrokerConfig{}
+
+	for _, cfg := range c.SenderConfig {
+		if cfg.FileServer != nil && !isReference(cfg.FileServer.Type) {
+			declareBackend(validator, "fileServer", fileServers, cfg.FileServer.Name, cfg.FileServer.FileServerConfig)
+		}
+
+		if cfg.Storage != nil && !isReference(cfg.Storage.Type) {
+			declareBackend(validator, "storage", storages, cfg.Storage.Name, cfg.Storage.StorageConfig)
+		}
+
+		if cfg.Broker != nil && !isReference(cfg.Broker.Type) {
+			declareBackend(validator, "broker", brokers, cfg.Broker.Name, cfg.Broker.BrokerConfig)
+		}
+	}
+
+	for _, cfg := range c.SenderConfig {
+		if cfg.FileServer != nil {
+			checkReference(validator, "fileServer", fileServers, cfg.FileServer.Name)
+		}
+
+		if cfg.Storage != nil {
+			checkReference(validator, "storage", storages, cfg.Storage.Name)
+		}
+
+		if cfg.Broker != nil {
+			checkReference(validator, "broker", brokers, cfg.Broker.Name)
+		}
+	}
+}
+
+func declareBackend[T comparable](validator *models.Validator, kind string, declared map[string]T, name string, cfg T) {
+	if strings.TrimSpace(name) == "" {
+		return
+	}
+
+	if current, ok := declared[name]; ok && current != cfg {
+		validator.AddError(kind, fmt.Sprintf("'%s' is declared more than once with different settings", name))
+
+		return
+	}
+
+	declared[name] = cfg
+}
+
+func checkReference[T any](validator *models.Validator, kind string, declared map[string]T, name string) {
+	if strings.TrimSpace(name) == "" {
+		return
+	}
+
+	if _, ok := declared[name]; !ok {
+		validator.AddError(kind, fmt.Sprintf("'%s' is not declared, type is required", name))
+	}
+}
+
+// A backend block without type only refers to a backend declared by another sender.
+func isReference(backendType string) bool {
+	return strings.TrimSpace(backendType) == ""
+}
@@ -1,9 +1,12 @@
 package dispatcher
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/collector"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
 )
@@ -55,3 +58,105 @@ func TestValidateShouldReturnNillWhenConfigIsValid(t *testing.T) {
 	// Assert
 	assert.Nil(t, err)
 }
+
+func newSenderConfig() sender.Config {
+	return sender.Config{
+		EventTopic: "event-topic",
+		Workers:    1,
+		CollectorCfg: collector.Config{
+			MatchPatterns: []string{"./files.json"},
+		},
+	}
+}
+
+func TestValidateShouldReturnErrorWhenBackendIsDeclaredWithDifferentSettings(t *testing.T) {
+	// Prepare
+	first := newSenderConfig()
+	first.Storage = &sender.StorageConfig{Name: "files", StorageConfig: config.StorageConfig{Type: "memory"}}
+
+	second := newSenderConfig()
+	second.Storage = &sender.StorageConfig{Name: "files", StorageConfig: config.StorageConfig{Type: "none"}}
+
+	// Arrange
+	sut := Config{[]sender.Config{first, second}}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "storage: 'files' is declared more than once with different settings")
+}
+
+func TestValidateShouldReturnErrorWhenReferencedBackendIsNotDeclared(t *testing.T) {
+	// Prepare
+	cfg := newSenderConfig()
+	cfg.Broker = &sender.BrokerConfig{Name: "events"}
+
+	// Arrange
+	sut := Config{[]sender.Config{cfg}}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "broker: 'events' is not declared, type is required")
+}
+
+func TestValidateShouldReturnNillWhenBackendIsReferencedByOtherSender(t *testing.T) {
+	// Prepare
+	first := newSenderConfig()
+	first.FileServer = &sender.FileServerConfig{Name: "inbox", FileServerConfig: config.FileServerConfig{Type: "local"}}
+
+	second := newSenderConfig()
+	second.FileServer = &sender.FileServerConfig{Name: "inbox"}
+
+	// Arrange
+	sut := Config{[]sender.Config{first, second}}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.Nil(t, err)
+}
+
+func TestLoadFromYamlShouldParseSenderBackends(t *testing.T) {
+	// Prepare
+	data := `
+sender:
+  - collect:
+      pattern:
+        - ./data/*.json
+    workers: 1
+    topic: collector.files
+    fileServer:
+      name: partner
+      type: sftp
+      server: partner.com:22
+    storage:
+      name: files
+      type: s3
+      bucket: partner-files
+      keyPrefix: partner/
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := ioutil.WriteFile(configPath, []byte(data), 0o600)
+	assert.Nil(t, err)
+
+	// Arrange
+	sut := Config{}
+
+	// Action
+	err = sut.LoadFromYaml(configPath)
+	assert.Nil(t, err)
+
+	// Assert
+	cfg := sut.SenderConfig[0]
+	assert.Equal(t, "sftp", cfg.FileServer.Type)
+	assert.Equal(t, "partner.com:22", cfg.FileServer.Server)
+	assert.Equal(t, "partner-files", cfg.Storage.Bucket)
+	assert.Equal(t, "partner/", cfg.Storage.KeyPrefix)
+	assert.Nil(t, cfg.Broker)
+}
@@ -0,0 +1,91 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+var ErrSenderNotFound = errors.New("sender not found")
+
+// Action applied to the dead-letter stream of a sender, returns how many events were changed.
+type deadLetterAction func(*sender.Sender) (int, error)
+
+// Send again the events at the dead-letter streams of the senders, or only of the sender with the key
+// when it isn't empty. Returns how many events were moved back.
+func (d *Dispatcher) ReplayDeadLetters(key string) (int, error) {
+	return d.eachDeadLetters(key, (*sender.Sender).ReplayDeadLetters)
+}
+
+// Remove the events at the dead-letter streams of the senders, or only of the sender with the key
+// when it isn't empty. Returns how many events were removed.
+func (d *Dispatcher) DiscardDeadLetters(key string) (int, error) {
+	return d.eachDeadLetters(key, (*sender.Sender).DiscardDeadLetters)
+}
+
+func (d *Dispatcher) eachDeadLetters(key string, action deadLetterAction) (int, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	total, found := 0, false
+
+	for _, worker := range d.workerPool {
+		if key != "" && worker.key != key {
+			continue
+		}
+
+		found = true
+
+		count, err := action(worker.sender)
+		total += count
+
+		if err != nil {
+			return total, fmt.Errorf("sender %d: %w", worker.sender.ID, err)
+		}
+	}
+
+	if !found && key != "" {
+		return 0, fmt.Errorf("%w: '%s'", ErrSenderNotFound, key)
+	}
+
+	return total, nil
+}
+
+type deadLettersResponse struct {
+	Events int    `json:"events"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Handler running the action on POST requests, the sender query parameter limits it to the sender with that name
+// (or position). Responds the number of events changed as json.
+func DeadLettersHandler(action func(key string) (int, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		count, err := action(r.URL.Query().Get("sender"))
+		response, status := deadLettersResponse{Events: count}, http.StatusOK
+
+		if err != nil {
+			logger.Errorf("[Dispatcher] Failed to change the dead-letter events, %s", err)
+
+			response.Error, status = err.Error(), http.StatusInternalServerError
+			if errors.Is(err, ErrSenderNotFound) {
+				status = http.StatusNotFound
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
@@ -0,0 +1,39 @@
+package dispatcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLettersHandlerShouldReturnNotFoundWhenSenderIsUnknown(t *testing.T) {
+	// Prepare
+	sut := newRunningSut(t, newNamedSenderConfig("files", t.TempDir()))
+	recorder := httptest.NewRecorder()
+
+	// Action
+	DeadLettersHandler(sut.ReplayDeadLetters).ServeHTTP(
+		recorder, httptest.NewRequest(http.MethodPost, "/dead-letters/replay?sender=unknown", nil),
+	)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "sender not found")
+}
+
+func TestDeadLettersHandlerShouldRespondCountOfEvents(t *testing.T) {
+	// Prepare
+	sut := newRunningSut(t, newNamedSenderConfig("files", t.TempDir()))
+	recorder := httptest.NewRecorder()
+
+	// Action
+	DeadLettersHandler(sut.DiscardDeadLetters).ServeHTTP(
+		recorder, httptest.NewRequest(http.MethodPost, "/dead-letters/discard?sender=files", nil),
+	)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"events": 0}`, recorder.Body.String())
+}
@@ -1,48 +1,386 @@
 package dispatcher
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/health"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
 )
 
 // Create and manage sender services, one service is created binding each config.
 type Dispatcher struct {
-	workerPool []*sender.Sender
+	sync.Mutex
+	workerPool []*worker
+	backends   *backends
+	defaults   defaults
+	lastID     int
+	checks     *checks
+}
+
+// Backends used by every sender that doesn't declare its own.
+type defaults struct {
+	storage    services.Storage
+	fileServer services.FileServer
+	broker     services.Broker
+	journal    services.Journal
+	outbox     services.Outbox
+}
+
+type worker struct {
+	key    string
+	sender *sender.Sender
+
+	// Clients declared by the sender config, kept while the sender is stopping
+	clients []interface{}
+
+	// The sender didn't stop before the reload timeout, it's stopped again on the next reload
+	stopping bool
+}
+
+type checks struct {
+	readiness      *health.Checks
+	liveness       *health.Checks
+	livenessFactor int
 }
 
+// The storage, file server and broker are used by every sender that doesn't declare its own backend,
+// the journal and the outbox are shared by all of them.
 func New(
-	config Config, storage services.Storage, fileServer services.FileServer, broker services.Broker,
+	config Config,
+	storage services.Storage,
+	fileServer services.FileServer,
+	broker services.Broker,
+	journal services.Journal,
+	outbox services.Outbox,
 ) (*Dispatcher, error) {
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
-	workerPool := []*sender.Sender{}
+	backends, err := newBackends(config.SenderConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		backends: backends,
+		defaults: defaults{
+			storage: storage, fileServer: fileServer, broker: broker, journal: journal, outbox: outbox,
+		},
+	}
+
+	for i, cfg := range config.SenderConfig {
+		d.lastID++
 
-	for senderID, cfg := range config.SenderConfig {
-		worker, err := sender.New(senderID+1, cfg, storage, fileServer, broker)
+		worker, err := d.newWorker(d.lastID, senderKey(i, cfg), cfg, backends)
 		if err != nil {
+			backends.Close()
+
 			return nil, err
 		}
 
-		workerPool = append(workerPool, worker)
+		d.workerPool = append(d.workerPool, worker)
 	}
 
-	return &Dispatcher{workerPool: workerPool}, nil
+	return d, nil
+}
+
+// Senders are identified by the name, or by the position when they don't have one.
+func senderKey(position int, cfg sender.Config) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+
+	return strconv.Itoa(position + 1)
+}
+
+func (d *Dispatcher) newWorker(senderID int, key string, cfg sender.Config, backends *backends) (*worker, error) {
+	s, err := sender.New(
+		senderID,
+		cfg,
+		backends.storage(cfg, d.defaults.storage),
+		backends.fileServer(cfg, d.defaults.fileServer),
+		backends.broker(cfg, d.defaults.broker),
+		d.defaults.journal,
+		d.defaults.outbox,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &worker{key: key, sender: s, clients: backends.declared(cfg)}, nil
 }
 
 func (d *Dispatcher) Start() {
-	go func() {
-		for _, worker := range d.workerPool {
-			worker.Start()
+	d.Lock()
+	defer d.Unlock()
+
+	for _, worker := range d.workerPool {
+		worker.sender.Start()
+	}
+}
+
+// Stop all the senders concurrently, returns the errors of the senders that couldn't finish
+// their files and events before the context is done.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return joinErrors(stopEach(ctx, senders(d.workerPool)))
+}
+
+// Stop the senders concurrently, returns the error of each sender.
+func stopEach(ctx context.Context, senders []*sender.Sender) []error {
+	errs := make([]error, len(senders))
+	wg := sync.WaitGroup{}
+
+	for i, s := range senders {
+		wg.Add(1)
+
+		go func(i int, s *sender.Sender) {
+			defer wg.Done()
+
+			errs[i] = s.Stop(ctx)
+		}(i, s)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+func joinErrors(errs []error) error {
+	var (
+		first    error
+		messages []string
+	)
+
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if first == nil {
+			first = err
+
+			continue
+		}
+
+		messages = append(messages, err.Error())
+	}
+
+	if first == nil || len(messages) == 0 {
+		return first
+	}
+
+	return fmt.Errorf("%w; %s", first, strings.Join(messages, "; "))
+}
+
+// Reconcile the running senders with the config. New senders are started, removed ones are stopped
+// gracefully and changed ones are updated on their next loop, or replaced when the change can't be
+// applied on a running sender. Nothing is changed when the config is invalid.
+// The senders that don't stop before the context is done are kept, with their backends, until they
+// are stopped on a later reload, and their replacements aren't started.
+func (d *Dispatcher) Reload(ctx context.Context, config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	backends, err := d.backends.reload(config.SenderConfig)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]*worker, len(d.workerPool))
+	for _, worker := range d.workerPool {
+		running[worker.key] = worker
+	}
+
+	var (
+		workerPool   []*worker
+		started      []*worker
+		stopped      []*worker
+		replacements = map[*worker]*worker{}
+		reloads      = map[*worker]sender.Config{}
+	)
+
+	lastID := d.lastID
+
+	for i, cfg := range config.SenderConfig {
+		key := senderKey(i, cfg)
+
+		current, ok := running[key]
+		if ok {
+			delete(running, key)
+
+			if !current.stopping && !backends.changed(cfg, d.backends) && current.sender.CanReload(cfg) {
+				reloads[current] = cfg
+				workerPool = append(workerPool, current)
+
+				continue
+			}
+		}
+
+		senderID := lastID + 1
+		if ok {
+			senderID = current.sender.ID
+		} else {
+			lastID++
+		}
+
+		replacement, err := d.newWorker(senderID, key, cfg, backends)
+		if err != nil {
+			backends.closeExcept(d.backends)
+
+			return err
+		}
+
+		if ok {
+			stopped = append(stopped, current)
+			replacements[current] = replacement
+		}
+
+		started = append(started, replacement)
+		workerPool = append(workerPool, replacement)
+	}
+
+	for _, removed := range running {
+		stopped = append(stopped, removed)
+	}
+
+	for current, cfg := range reloads {
+		if err := current.sender.Reload(cfg); err != nil {
+			logger.Errorf("[Dispatcher] Failed to reload sender %d, %s", current.sender.ID, err)
 		}
-	}()
+	}
+
+	// The replaced senders are stopped before the new ones start, they would collect the same files
+	stopErrs := stopEach(ctx, senders(stopped))
+
+	for i, current := range stopped {
+		d.unregisterSenderChecks(current.sender)
+
+		if stopErrs[i] == nil {
+			continue
+		}
+
+		current.stopping = true
+		backends.retain(current.clients)
+
+		replacement, ok := replacements[current]
+		if !ok {
+			workerPool = append(workerPool, current)
+
+			continue
+		}
+
+		started = without(started, replacement)
+		workerPool[index(workerPool, replacement)] = current
+
+		// The replacement was never started, so it didn't replace the observations of the kept sender
+		_ = replacement.sender.Stop(ctx)
+	}
+
+	for _, worker := range started {
+		worker.sender.Start()
+		d.registerSenderChecks(worker.sender)
+	}
+
+	if d.checks != nil {
+		d.backends.unregisterChecks(d.checks.readiness)
+		backends.registerChecks(d.checks.readiness)
+	}
+
+	d.backends.closeExcept(backends)
+	d.backends = backends
+	d.workerPool = workerPool
+	d.lastID = lastID
+
+	logger.Infof(
+		"[Dispatcher] Config reloaded, %d senders started, %d stopped and %d updated",
+		len(started), len(stopped), len(reloads),
+	)
+
+	return joinErrors(stopErrs)
+}
+
+func senders(workers []*worker) []*sender.Sender {
+	senders := make([]*sender.Sender, 0, len(workers))
+	for _, worker := range workers {
+		senders = append(senders, worker.sender)
+	}
+
+	return senders
 }
 
-func (d *Dispatcher) Stop() {
-	go func() {
-		for _, worker := range d.workerPool {
-			worker.Stop()
+func index(workers []*worker, target *worker) int {
+	for i, worker := range workers {
+		if worker == target {
+			return i
 		}
-	}()
+	}
+
+	return -1
+}
+
+func without(workers []*worker, target *worker) []*worker {
+	if i := index(workers, target); i >= 0 {
+		return append(workers[:i], workers[i+1:]...)
+	}
+
+	return workers
+}
+
+// Add the readiness checks of the sender backends and directories, and the liveness checks of the sender loops.
+// The liveness fails when a loop doesn't complete within livenessFactor times its delay.
+// The checks are updated when the config is reloaded.
+func (d *Dispatcher) RegisterChecks(readiness, liveness *health.Checks, livenessFactor int) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.checks = &checks{readiness: readiness, liveness: liveness, livenessFactor: livenessFactor}
+	d.backends.registerChecks(readiness)
+
+	for _, worker := range d.workerPool {
+		d.registerSenderChecks(worker.sender)
+	}
+}
+
+func (d *Dispatcher) registerSenderChecks(s *sender.Sender) {
+	if d.checks == nil {
+		return
+	}
+
+	factor := d.checks.livenessFactor
+
+	d.checks.readiness.Add(fmt.Sprintf("sender:%d:directories", s.ID), health.CheckerFunc(s.CheckDirectories))
+	d.checks.liveness.Add(fmt.Sprintf("sender:%d:loop", s.ID), health.CheckerFunc(func(ctx context.Context) error {
+		return s.CheckLoop(factor)
+	}))
+}
+
+func (d *Dispatcher) unregisterSenderChecks(s *sender.Sender) {
+	if d.checks == nil {
+		return
+	}
+
+	d.checks.readiness.Remove(fmt.Sprintf("sender:%d:directories", s.ID))
+	d.checks.liveness.Remove(fmt.Sprintf("sender:%d:loop", s.ID))
+}
+
+// Release the backends created from sender configs.
+func (d *Dispatcher) Close() {
+	d.Lock()
+	defer d.Unlock()
+
+	d.backends.Close()
 }
@@ -1 +1,224 @@
 package dispatcher
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/collector"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/sender"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/broker"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/journal"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/outbox"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/storage"
+)
+
+func newRunningSut(t *testing.T, configs ...sender.Config) *Dispatcher {
+	t.Helper()
+
+	fileServer, err := fileserver.NewLocalFileServer(fileserver.Config{})
+	assert.Nil(t, err)
+
+	memoryBroker, err := broker.NewMemoryBroker()
+	assert.Nil(t, err)
+
+	sut, err := New(
+		Config{SenderConfig: configs},
+		storage.NewMemoryStorage(), fileServer, memoryBroker, journal.NewMemoryJournal(), outbox.NewMemoryOutbox(),
+	)
+	assert.Nil(t, err)
+
+	sut.Start()
+
+	t.Cleanup(func() {
+		assert.Nil(t, sut.Stop(context.Background()))
+	})
+
+	return sut
+}
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	return recorder.Body.String()
+}
+
+func newNamedSenderConfig(name, folder string) sender.Config {
+	return sender.Config{
+		Name:         name,
+		EventTopic:   "event-topic",
+		Workers:      1,
+		CollectDelay: 60,
+		CollectorCfg: collector.Config{MatchPatterns: []string{filepath.Join(folder, "*.json")}},
+	}
+}
+
+func TestReloadShouldReconcileSenders(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	kept := newNamedSenderConfig("kept", folder)
+	removed := newNamedSenderConfig("removed", folder)
+	replaced := newNamedSenderConfig("replaced", folder)
+
+	sut := newRunningSut(t, kept, removed, replaced)
+	keptSender, replacedSender := sut.workerPool[0].sender, sut.workerPool[2].sender
+
+	// Arrange
+	kept.Workers = 3
+	replaced.EventTopic = "other-topic"
+	added := newNamedSenderConfig("added", folder)
+
+	// Action
+	err := sut.Reload(context.Background(), Config{SenderConfig: []sender.Config{kept, replaced, added}})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Len(t, sut.workerPool, 3)
+	assert.Same(t, keptSender, sut.workerPool[0].sender)
+	assert.NotSame(t, replacedSender, sut.workerPool[1].sender)
+	assert.Equal(t, replacedSender.ID, sut.workerPool[1].sender.ID)
+	assert.Equal(t, 4, sut.workerPool[2].sender.ID)
+}
+
+func TestReloadShouldKeepSendersWhenConfigIsInvalid(t *testing.T) {
+	// Prepare
+	sut := newRunningSut(t, newNamedSenderConfig("kept", t.TempDir()))
+	current := sut.workerPool[0].sender
+
+	// Action
+	err := sut.Reload(context.Background(), Config{})
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Len(t, sut.workerPool, 1)
+	assert.Same(t, current, sut.workerPool[0].sender)
+}
+
+type blockingStorage struct {
+	*storage.MemoryStorage
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingStorage) SendFile(ctx context.Context, key string, reader io.ReadSeeker, checksum models.Checksum) error {
+	bs.sending <- struct{}{}
+	<-bs.release
+
+	return bs.MemoryStorage.SendFile(ctx, key, reader, checksum)
+}
+
+func TestReloadShouldKeepSendersThatDidNotStop(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(folder, "file.json"), []byte("{}"), 0o644))
+
+	fileServer, err := fileserver.NewLocalFileServer(fileserver.Config{})
+	assert.Nil(t, err)
+
+	memoryBroker, err := broker.NewMemoryBroker()
+	assert.Nil(t, err)
+
+	blocking := &blockingStorage{
+		MemoryStorage: storage.NewMemoryStorage(),
+		sending:       make(chan struct{}, 1),
+		release:       make(chan struct{}),
+	}
+
+	replaced := newNamedSenderConfig("replaced", folder)
+
+	sut, err := New(
+		Config{SenderConfig: []sender.Config{replaced}},
+		blocking, fileServer, memoryBroker, journal.NewMemoryJournal(), outbox.NewMemoryOutbox(),
+	)
+	assert.Nil(t, err)
+
+	sut.Start()
+	defer func() { assert.Nil(t, sut.Stop(context.Background())) }()
+
+	<-blocking.sending
+
+	current := sut.workerPool[0].sender
+
+	// Arrange
+	replaced.PublisherCfg.Retry.MaxAttempts = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Action
+	err = sut.Reload(ctx, Config{SenderConfig: []sender.Config{replaced}})
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Len(t, sut.workerPool, 1)
+	assert.Same(t, current, sut.workerPool[0].sender)
+	assert.True(t, sut.workerPool[0].stopping)
+	assert.Contains(t, scrapeMetrics(t), `collector_channel_depth{channel="event",sender="1",topic="event-topic"}`)
+
+	close(blocking.release)
+
+	assert.Nil(t, sut.Reload(context.Background(), Config{SenderConfig: []sender.Config{replaced}}))
+	assert.NotSame(t, current, sut.workerPool[0].sender)
+	assert.Equal(t, current.ID, sut.workerPool[0].sender.ID)
+}
+
+type closingFileServer struct {
+	*fileserver.LocalFileServer
+	closed bool
+}
+
+func (cs *closingFileServer) Close() error {
+	cs.closed = true
+
+	return nil
+}
+
+func TestReloadShouldCloseReplacedFileServers(t *testing.T) {
+	// Prepare
+	created := map[string]*closingFileServer{}
+
+	fileserver.Register("closing", func(cfg fileserver.Config) (fileserver.Client, error) {
+		local, err := fileserver.NewLocalFileServer(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		created[cfg.Server] = &closingFileServer{LocalFileServer: local}
+
+		return created[cfg.Server], nil
+	})
+
+	cfg := newNamedSenderConfig("remote", t.TempDir())
+	cfg.FileServer = &sender.FileServerConfig{
+		Name:             "files",
+		FileServerConfig: config.FileServerConfig{Type: "closing", Server: "first"},
+	}
+
+	sut := newRunningSut(t, cfg)
+
+	// Arrange
+	cfg.FileServer.Server = "second"
+
+	// Action
+	err := sut.Reload(context.Background(), Config{SenderConfig: []sender.Config{cfg}})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.True(t, created["first"].closed)
+	assert.False(t, created["second"].closed)
+
+	sut.Close()
+	assert.True(t, created["second"].closed)
+}
@@ -0,0 +1,67 @@
+package dispatcher
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+// Notify when the config file is written, until the context is done. The directory is watched
+// instead of the file, editors usually replace the file instead of writing it.
+func WatchConfig(ctx context.Context, configPath string) (<-chan struct{}, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		watcher.Close()
+
+		return nil, err
+	}
+
+	// Buffered to coalesce the events of a single save
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				logger.Warningf("[Dispatcher] Error watching config file, %s", err)
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) != absPath || event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -11,17 +11,44 @@ import (
 type Locker = models.Locker
 
 type FileServer interface {
-	Glob(context.Context, string) ([]string, error)
+	Glob(context.Context, string, ...string) ([]string, error)
 	Open(context.Context, string) (io.ReadSeekCloser, error)
 	Move(context.Context, string, string) error
+	Remove(context.Context, string) error
+	WriteFile(context.Context, string, []byte) error
 	Stat(context.Context, string) (fs.FileInfo, error)
 	AcquireLock(context.Context, string) (Locker, error)
 }
 
+// File servers able to notify the written files, required by the watch collect mode.
+type FileWatcher interface {
+	Watch(context.Context, []string, ...string) (<-chan models.WatchEvent, error)
+}
+
 type Storage interface {
-	SendFile(context.Context, string, io.ReadSeeker) (err error)
+	SendFile(context.Context, string, io.ReadSeeker, models.Checksum) (err error)
+	// Bucket and object key where the file with the informed key is stored
+	Locate(string) (string, string)
 }
 
 type Broker interface {
 	SendEvent(models.Event) error
 }
+
+type Journal interface {
+	Get(models.FileInfo) (models.JournalEntry, bool)
+	Record(models.JournalEntry) error
+	Advance(string, models.FileState, models.FileState) (bool, error)
+	Entries(models.FileState) []models.JournalEntry
+}
+
+// Durable queue of the events waiting to be sent to the broker, split in streams sent in order.
+type Outbox interface {
+	Push(string, models.Event) error
+	Next(string) (models.OutboxRecord, bool)
+	Ack(models.OutboxRecord) error
+	Release(models.OutboxRecord)
+	Len(string) int
+	Records(string) []models.OutboxRecord
+	Durable() bool
+}
@@ -0,0 +1,136 @@
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+// Actions applied on the file after it is uploaded.
+const (
+	AfterUploadMove         = "move"
+	AfterUploadDelete       = "delete"
+	AfterUploadRenameSuffix = "rename-suffix"
+	AfterUploadKeep         = "keep"
+)
+
+const (
+	defaultMoveDestination = "sent/{{.Name}}"
+	defaultRenameSuffix    = ".sent"
+)
+
+type AfterUploadConfig struct {
+	// One of move, delete, rename-suffix or keep, default is move
+	// keep relies on the journal to don't send the file again
+	Action string `yaml:"action" json:"action"`
+	// Template of the destination when action is move, relative paths are joined with the file directory
+	// Ex: archive/{{.Date}}/{{.Name}}
+	Destination string `yaml:"destination" json:"destination"`
+	// Suffix added to the file name when action is rename-suffix, default is .sent
+	Suffix string `yaml:"suffix" json:"suffix"`
+}
+
+// Values available at the destination template.
+type destinationData struct {
+	Name     string
+	BaseName string
+	Ext      string
+	Dir      string
+	Date     string
+	Year     string
+	Month    string
+	Day      string
+	ModTime  time.Time
+	Now      time.Time
+}
+
+func (c AfterUploadConfig) Validate() error {
+	validator := models.Validator{}
+
+	switch c.action() {
+	case AfterUploadMove:
+		if _, err := c.template(); err != nil {
+			validator.AddError("destination", err.Error())
+		}
+	case AfterUploadRenameSuffix, AfterUploadDelete, AfterUploadKeep:
+	default:
+		validator.AddError(
+			"action",
+			fmt.Sprintf(
+				"must be one of %s, %s, %s or %s",
+				AfterUploadMove, AfterUploadDelete, AfterUploadRenameSuffix, AfterUploadKeep,
+			),
+		)
+	}
+
+	if validator.HasErrors() {
+		return validator.GetError()
+	}
+
+	return nil
+}
+
+func (c AfterUploadConfig) action() string {
+	if strings.TrimSpace(c.Action) == "" {
+		return AfterUploadMove
+	}
+
+	return strings.ToLower(strings.TrimSpace(c.Action))
+}
+
+func (c AfterUploadConfig) template() (*template.Template, error) {
+	destination := c.Destination
+	if strings.TrimSpace(destination) == "" {
+		destination = defaultMoveDestination
+	}
+
+	return template.New("destination").Option("missingkey=error").Parse(destination)
+}
+
+// Render the new path of the file when action is move.
+func (c AfterUploadConfig) destination(file models.File, now time.Time) (string, error) {
+	tmpl, err := c.template()
+	if err != nil {
+		return "", err
+	}
+
+	fileDir, fileName := path.Split(file.FilePath)
+	ext := path.Ext(fileName)
+
+	buf := bytes.Buffer{}
+
+	err = tmpl.Execute(&buf, destinationData{
+		Name:     fileName,
+		BaseName: strings.TrimSuffix(fileName, ext),
+		Ext:      ext,
+		Dir:      path.Clean(fileDir),
+		Date:     now.Format("2006-01-02"),
+		Year:     now.Format("2006"),
+		Month:    now.Format("01"),
+		Day:      now.Format("02"),
+		ModTime:  file.ModTime,
+		Now:      now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if destination := buf.String(); path.IsAbs(destination) {
+		return path.Clean(destination), nil
+	}
+
+	return path.Join(fileDir, buf.String()), nil
+}
+
+func (c AfterUploadConfig) suffix() string {
+	if c.Suffix == "" {
+		return defaultRenameSuffix
+	}
+
+	return c.Suffix
+}
@@ -0,0 +1,75 @@
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+func TestValidateAfterUploadShouldReturnErrorWhenActionIsInvalid(t *testing.T) {
+	// Arrange
+	sut := AfterUploadConfig{Action: "copy"}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "action: must be one of move, delete, rename-suffix or keep")
+}
+
+func TestValidateAfterUploadShouldReturnErrorWhenDestinationIsInvalid(t *testing.T) {
+	// Arrange
+	sut := AfterUploadConfig{Action: "move", Destination: "archive/{{.Date}"}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "destination: ")
+}
+
+func TestDestinationShouldUseSentDirByDefault(t *testing.T) {
+	// Arrange
+	sut := AfterUploadConfig{}
+	file := models.File{FileInfo: models.FileInfo{FilePath: "/data/orders.json"}}
+
+	// Action
+	destination, err := sut.destination(file, time.Now())
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "/data/sent/orders.json", destination)
+}
+
+func TestDestinationShouldRenderTemplate(t *testing.T) {
+	// Arrange
+	sut := AfterUploadConfig{Destination: "archive/{{.Date}}/{{.BaseName}}-{{.ModTime.Unix}}{{.Ext}}"}
+	modTime := time.Unix(1000, 0)
+	file := models.File{FileInfo: models.FileInfo{FilePath: "/data/orders.json", ModTime: modTime}}
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	// Action
+	destination, err := sut.destination(file, now)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "/data/archive/2026-10-18/orders-1000.json", destination)
+}
+
+func TestDestinationShouldKeepAbsolutePaths(t *testing.T) {
+	// Arrange
+	sut := AfterUploadConfig{Destination: "/archive/{{.Year}}/{{.Month}}/{{.Day}}/{{.Name}}"}
+	file := models.File{FileInfo: models.FileInfo{FilePath: "/data/orders.json"}}
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	// Action
+	destination, err := sut.destination(file, now)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "/archive/2026/10/18/orders.json", destination)
+}
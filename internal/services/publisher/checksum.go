@@ -0,0 +1,148 @@
+package publisher
+
+import (
+	"crypto/md5" // nolint:gosec
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+// Checksum algorithms, sha256 is always computed.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumMD5    = "md5"
+	ChecksumCRC32C = "crc32c"
+)
+
+func isValidChecksum(algorithm string) bool {
+	switch strings.ToLower(algorithm) {
+	case ChecksumSHA256, ChecksumMD5, ChecksumCRC32C:
+		return true
+	default:
+		return false
+	}
+}
+
+// The Content-MD5 header must be sent before the content, so the checksums are computed before the upload.
+func checksumUpFront(algorithms []string) bool {
+	for _, algorithm := range algorithms {
+		if strings.ToLower(algorithm) == ChecksumMD5 {
+			return true
+		}
+	}
+
+	return false
+}
+
+type checksumHashes struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+	crc32c hash.Hash
+	writer io.Writer
+}
+
+func newChecksumHashes(algorithms []string) *checksumHashes {
+	hashes := &checksumHashes{sha256: sha256.New()}
+	writers := []io.Writer{hashes.sha256}
+
+	for _, algorithm := range algorithms {
+		switch strings.ToLower(algorithm) {
+		case ChecksumMD5:
+			hashes.md5 = md5.New() // nolint:gosec
+			writers = append(writers, hashes.md5)
+		case ChecksumCRC32C:
+			hashes.crc32c = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+			writers = append(writers, hashes.crc32c)
+		}
+	}
+
+	hashes.writer = io.MultiWriter(writers...)
+
+	return hashes
+}
+
+func (h *checksumHashes) checksum() models.Checksum {
+	checksum := models.Checksum{SHA256: h.sha256.Sum(nil)}
+
+	if h.md5 != nil {
+		checksum.MD5 = h.md5.Sum(nil)
+	}
+
+	if h.crc32c != nil {
+		checksum.CRC32C = h.crc32c.Sum(nil)
+	}
+
+	return checksum
+}
+
+// Compute the checksums reading the whole content, the reader is rewinded to be sent to the storage.
+func computeChecksum(reader io.ReadSeeker, algorithms []string) (models.Checksum, error) {
+	hashes := newChecksumHashes(algorithms)
+
+	if _, err := io.Copy(hashes.writer, reader); err != nil {
+		return models.Checksum{}, err
+	}
+
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return models.Checksum{}, err
+	}
+
+	return hashes.checksum(), nil
+}
+
+// Reader computing the checksums while the storage reads the content. The storages may seek to read it again,
+// like the SDKs retrying a request, so only the bytes after the last hashed offset are hashed.
+type checksumReader struct {
+	reader io.ReadSeeker
+	hashes *checksumHashes
+	size   int64
+	offset int64
+	hashed int64
+	gap    bool
+}
+
+func newChecksumReader(reader io.ReadSeeker, size int64, algorithms []string) *checksumReader {
+	return &checksumReader{reader: reader, hashes: newChecksumHashes(algorithms), size: size}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+
+	if end := r.offset + int64(n); end > r.hashed {
+		if r.offset > r.hashed {
+			// The content was skipped, the checksum must be computed reading the file again.
+			r.gap = true
+		} else if !r.gap {
+			_, _ = r.hashes.writer.Write(p[r.hashed-r.offset : n])
+			r.hashed = end
+		}
+	}
+
+	r.offset += int64(n)
+
+	return n, err
+}
+
+func (r *checksumReader) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.reader.Seek(offset, whence)
+	if err != nil {
+		return position, err
+	}
+
+	r.offset = position
+
+	return position, nil
+}
+
+// The checksums of the content, ok is false when the storage didn't read the whole content in order.
+func (r *checksumReader) Checksum() (models.Checksum, bool) {
+	if r.gap || r.hashed != r.size {
+		return models.Checksum{}, false
+	}
+
+	return r.hashes.checksum(), true
+}
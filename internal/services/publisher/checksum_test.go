@@ -0,0 +1,111 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeChecksumShouldComputeOnlySHA256ByDefault(t *testing.T) {
+	// Arrange
+	reader := bytes.NewReader([]byte("testing!"))
+
+	// Action
+	checksum, err := computeChecksum(reader, nil)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Len(t, checksum.SHA256, 32)
+	assert.Empty(t, checksum.MD5)
+	assert.Empty(t, checksum.CRC32C)
+}
+
+func TestComputeChecksumShouldComputeOptionalAlgorithms(t *testing.T) {
+	// Arrange
+	reader := bytes.NewReader([]byte("123456789"))
+
+	// Action
+	checksum, err := computeChecksum(reader, []string{ChecksumMD5, ChecksumCRC32C})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225", hex.EncodeToString(checksum.SHA256))
+	assert.Equal(t, "25f9e794323b453885f5181f1b624d0b", hex.EncodeToString(checksum.MD5))
+	assert.Equal(t, "e3069283", hex.EncodeToString(checksum.CRC32C))
+}
+
+func TestComputeChecksumShouldRewindReader(t *testing.T) {
+	// Arrange
+	reader := bytes.NewReader([]byte("testing!"))
+
+	// Action
+	_, err := computeChecksum(reader, nil)
+	assert.Nil(t, err)
+
+	// Assert
+	data, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("testing!"), data)
+}
+
+func TestChecksumReaderShouldComputeChecksumWhileReading(t *testing.T) {
+	// Arrange
+	content := []byte("123456789")
+	expected, err := computeChecksum(bytes.NewReader(content), []string{ChecksumCRC32C})
+	assert.Nil(t, err)
+
+	reader := newChecksumReader(bytes.NewReader(content), int64(len(content)), []string{ChecksumCRC32C})
+
+	// Action
+	_, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+
+	// Assert
+	checksum, ok := reader.Checksum()
+	assert.True(t, ok)
+	assert.Equal(t, expected, checksum)
+}
+
+func TestChecksumReaderShouldHashOnlyOnceWhenContentIsReadAgain(t *testing.T) {
+	// Arrange
+	content := []byte("123456789")
+	expected, err := computeChecksum(bytes.NewReader(content), nil)
+	assert.Nil(t, err)
+
+	reader := newChecksumReader(bytes.NewReader(content), int64(len(content)), nil)
+
+	// Action
+	_, err = reader.Read(make([]byte, 4))
+	assert.Nil(t, err)
+
+	_, err = reader.Seek(0, io.SeekStart)
+	assert.Nil(t, err)
+
+	_, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+
+	// Assert
+	checksum, ok := reader.Checksum()
+	assert.True(t, ok)
+	assert.Equal(t, expected, checksum)
+}
+
+func TestChecksumReaderShouldNotReturnChecksumWhenContentIsSkipped(t *testing.T) {
+	// Arrange
+	content := []byte("123456789")
+	reader := newChecksumReader(bytes.NewReader(content), int64(len(content)), nil)
+
+	// Action
+	_, err := reader.Seek(4, io.SeekStart)
+	assert.Nil(t, err)
+
+	_, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+
+	// Assert
+	_, ok := reader.Checksum()
+	assert.False(t, ok)
+}
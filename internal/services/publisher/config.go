@@ -0,0 +1,94 @@
+package publisher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
+)
+
+const (
+	defaultFailedDir   = "failed"
+	defaultEventMaxAge = 24 * time.Hour
+)
+
+type Config struct {
+	// Action applied on the file after it is uploaded
+	AfterUpload AfterUploadConfig `yaml:"afterUpload" json:"afterUpload"`
+	// Retry policy applied around upload, move and event publishing
+	Retry retry.Policy `yaml:"retry" json:"retry"`
+	// Directory where the file is moved after exhausting the retry attempts,
+	// relative paths are joined with the file directory. Ex: failed
+	// The file is only moved when retry.maxAttempts is informed.
+	FailedDir string `yaml:"failedDir" json:"failedDir"`
+	// Max time an event waits at the outbox for the broker, after it the event is moved to the dead-letter
+	// stream of the outbox. Default: 24h
+	EventMaxAge time.Duration `yaml:"eventMaxAge" json:"eventMaxAge"`
+	// Checksums computed besides sha256, sent to the storage and at the success event. Ex: [md5, crc32c]
+	Checksums []string `yaml:"checksums" json:"checksums"`
+}
+
+func (c *Config) Validate() error {
+	validator := models.Validator{}
+
+	if c.Retry.MaxAttempts < 0 {
+		validator.AddError("retry.maxAttempts", "must be higher or equal then 0")
+	}
+
+	if c.Retry.BaseBackoff < 0 {
+		validator.AddError("retry.baseBackoff", "must be higher or equal then 0")
+	}
+
+	if c.Retry.MaxBackoff < 0 {
+		validator.AddError("retry.maxBackoff", "must be higher or equal then 0")
+	}
+
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		validator.AddError("retry.jitter", "must be between 0 and 1")
+	}
+
+	if c.EventMaxAge < 0 {
+		validator.AddError("eventMaxAge", "must be higher or equal then 0")
+	}
+
+	for i, algorithm := range c.Checksums {
+		if !isValidChecksum(algorithm) {
+			validator.AddError(
+				fmt.Sprintf("checksums[%d]", i),
+				fmt.Sprintf("must be one of %s, %s or %s", ChecksumSHA256, ChecksumMD5, ChecksumCRC32C),
+			)
+		}
+	}
+
+	if err := c.AfterUpload.Validate(); err != nil {
+		validator.AddError("afterUpload", err.Error())
+	}
+
+	if validator.HasErrors() {
+		return validator.GetError()
+	}
+
+	return nil
+}
+
+// Files are only moved to the failed directory when a retry policy is configured.
+func (c *Config) deadLetterEnabled() bool {
+	return c.Retry.MaxAttempts > 0
+}
+
+func (c *Config) failedDir() string {
+	if c.FailedDir == "" {
+		return defaultFailedDir
+	}
+
+	return c.FailedDir
+}
+
+func (c *Config) MaxEventAge() time.Duration {
+	if c.EventMaxAge == 0 {
+		return defaultEventMaxAge
+	}
+
+	return c.EventMaxAge
+}
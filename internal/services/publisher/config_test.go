@@ -0,0 +1,34 @@
+package publisher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
+)
+
+func TestValidateConfigShouldReturnErrorWhenRetryIsInvalid(t *testing.T) {
+	// Arrange
+	sut := Config{Retry: retry.Policy{MaxAttempts: -1, BaseBackoff: -1, MaxBackoff: -1, Jitter: 2}}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "retry.maxAttempts: must be higher or equal then 0")
+	assert.Contains(t, err.Error(), "retry.baseBackoff: must be higher or equal then 0")
+	assert.Contains(t, err.Error(), "retry.maxBackoff: must be higher or equal then 0")
+	assert.Contains(t, err.Error(), "retry.jitter: must be between 0 and 1")
+}
+
+func TestValidateConfigShouldReturnNillWhenConfigIsEmpty(t *testing.T) {
+	// Arrange
+	sut := Config{}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.Nil(t, err)
+}
@@ -1,5 +1,22 @@
 package publisher
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var ErrEmptyFile = errors.New("file size is empty")
+
+const errorReportSuffix = ".error.json"
+
+// Sidecar file written next to the files moved to the failed directory.
+type failureReport struct {
+	FileName   string    `json:"file_name"`
+	FilePath   string    `json:"file_path"`
+	FileKey    string    `json:"file_key"`
+	EventTopic string    `json:"event_topic"`
+	Stage      string    `json:"stage"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error"`
+	FailedAt   time.Time `json:"failed_at"`
+}
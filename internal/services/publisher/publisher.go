@@ -2,60 +2,132 @@ package publisher
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"path"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/trace"
 )
 
 type Publisher struct {
 	ID           int
+	SenderID     int
 	EventTopic   string
+	cfg          Config
 	storage      services.Storage
+	journal      services.Journal
 	waitGroup    *sync.WaitGroup
 	eventChannel chan models.Event
+	metrics      metrics.Sender
+	processing   atomic.Value
+	hostname     string
 }
 
 func New(
 	publisherID int,
+	senderID int,
 	eventTopic string,
+	config Config,
 	storage services.Storage,
+	journal services.Journal,
 	eventCh chan models.Event,
 	waitGroup *sync.WaitGroup,
+	senderMetrics metrics.Sender,
 ) *Publisher {
+	// The hostname only describes the events, they are sent without it when it's unknown.
+	hostname, _ := os.Hostname()
+
 	return &Publisher{
 		ID:           publisherID,
+		SenderID:     senderID,
 		EventTopic:   eventTopic,
+		cfg:          config,
 		storage:      storage,
+		journal:      journal,
 		waitGroup:    waitGroup,
 		eventChannel: eventCh,
+		metrics:      senderMetrics,
+		hostname:     hostname,
 	}
 }
 
 func (p *Publisher) Handle(ctx context.Context, fileChannel chan models.File) {
 	go func() {
 		for file := range fileChannel {
-			err := p.processFile(ctx, file)
-			if err == nil {
-				logger.Infof("[Publisher %d] File %+v uploaded with success", p.ID, file.FileInfo)
-				p.notifyResult("success", map[string]string{"file_key": file.Key})
-			} else {
-				logger.Errorf("[Publisher %d] Failed to upload file '%+v', %s", p.ID, file.FileInfo, err)
-				p.notifyResult("error", map[string]string{"file_path": file.FilePath, "error": err.Error()})
-			}
+			// Keep the wait group busy until the event is on the channel, so a stop waiting the group
+			// don't flush the events before it.
+			p.waitGroup.Add(1)
+			p.processing.Store(file.FilePath)
+
+			p.handleFile(ctx, file)
+
+			p.processing.Store("")
+			p.waitGroup.Done()
 		}
 	}()
 }
 
+// Process the file and send its result event, both under the same span. The files locked by another
+// owner are skipped without an event, the owner holding the lock sends it.
+func (p *Publisher) handleFile(ctx context.Context, file models.File) {
+	ctx, span := trace.NewSpan(ctx, "publisher.processFile")
+	defer span.End()
+
+	err := p.processFile(ctx, file)
+
+	switch {
+	case err == nil:
+		logger.Infof("[Publisher %d] File %+v uploaded with success", p.ID, file.FileInfo)
+		p.notifySuccess(ctx, file.FileInfo)
+	case errors.Is(err, models.ErrFileLocked):
+		logger.Debugf("[Publisher %d] Skipping file '%s', %s", p.ID, file.FilePath, err)
+	case errors.Is(err, models.ErrLockLost):
+		logger.Warningf("[Publisher %d] Stopped processing file '%+v', %s", p.ID, file.FileInfo, err)
+	default:
+		logger.Errorf("[Publisher %d] Failed to upload file '%+v', %s", p.ID, file.FileInfo, err)
+		p.notifyFailure(ctx, file.FileInfo, err)
+	}
+}
+
+// Path of the file being processed, empty when the publisher is idle.
+func (p *Publisher) Processing() string {
+	filePath, _ := p.processing.Load().(string)
+
+	return filePath
+}
+
+// Send the success events of files that were moved but whose event wasn't published before the last shutdown,
+// skipping the events still queued at the outbox.
+func (p *Publisher) ResumePending(queued func(journalID string) bool) {
+	for _, entry := range p.journal.Entries(models.FileMoved) {
+		if entry.Topic != p.EventTopic || queued(entry.ID()) {
+			continue
+		}
+
+		logger.Infof("[Publisher %d] Resuming event of file %+v", p.ID, entry.FileInfo)
+
+		ctx, span := trace.NewSpan(context.Background(), "publisher.resumePending")
+		trace.AddSpanTags(span, map[string]string{"filePath": entry.FilePath, "fileKey": entry.Key})
+		p.notifySuccess(ctx, entry.FileInfo)
+		span.End()
+	}
+}
+
 func (p *Publisher) processFile(ctx context.Context, file models.File) error {
 	defer p.waitGroup.Done()
 
-	ctx, span := trace.NewSpan(ctx, "publisher.processFile")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 
 	trace.AddSpanTags(
 		span,
@@ -69,6 +141,12 @@ func (p *Publisher) processFile(ctx context.Context, file models.File) error {
 	)
 
 	err := file.Lock(ctx)
+	if errors.Is(err, models.ErrFileLocked) {
+		trace.AddSpanTags(span, map[string]string{"result": "locked"})
+
+		return err
+	}
+
 	if err != nil {
 		logger.Errorf("[Publisher %d] Error on acquire file lock '%s': '%s'", p.ID, file.FilePath, err)
 		trace.AddSpanTags(span, map[string]string{"result": "lock-error"})
@@ -78,29 +156,150 @@ func (p *Publisher) processFile(ctx context.Context, file models.File) error {
 		return err
 	}
 
+	defer p.unlock(ctx, file)
+
+	ctx, cancel := withLock(ctx, file)
+	defer cancel()
+
 	if file.Size == 0 {
 		return ErrEmptyFile
 	}
 
-	err = p.publishFile(ctx, file)
-	if err != nil {
-		logger.Errorf("[Publisher %d] Error on publish file '%s': '%s'", p.ID, file.FilePath, err)
-		trace.AddSpanTags(span, map[string]string{"result": "fail"})
-		trace.AddSpanError(span, err)
-		trace.FailSpan(span, "Error on publish file")
+	// The journal is read after the lock, another process could have changed it while we were waiting.
+	entry, _ := p.journal.Get(file.FileInfo)
+	trace.AddSpanTags(span, map[string]string{"journalState": string(entry.State)})
 
-		return err
+	if !entry.State.Reached(models.FileUploaded) {
+		err = p.withRetry(ctx, "upload", file, func() error { return p.uploadFile(ctx, file) })
+		if lockLost(file) {
+			return abandon(ctx, file)
+		}
+
+		if err != nil {
+			logger.Errorf("[Publisher %d] Error on publish file '%s': '%s'", p.ID, file.FilePath, err)
+			trace.AddSpanTags(span, map[string]string{"result": "fail"})
+			trace.AddSpanError(span, err)
+			trace.FailSpan(span, "Error on publish file")
+
+			p.metrics.FileFailed("upload")
+			p.deadLetter(ctx, file, "upload", err)
+
+			return err
+		}
 	}
 
-	_ = file.Unlock(ctx)
+	if !entry.State.Reached(models.FileMoved) {
+		action := p.cfg.AfterUpload.action()
 
-	p.moveFile(ctx, file)
+		err = p.withRetry(ctx, action, file, func() error {
+			err := p.afterUpload(ctx, file)
+			if err != nil {
+				p.metrics.MoveFailed(action)
+			}
+
+			return err
+		})
+		if lockLost(file) {
+			return abandon(ctx, file)
+		}
+
+		if err != nil {
+			p.metrics.FileFailed(action)
+			p.deadLetter(ctx, file, action, err)
+
+			return err
+		}
+	}
 
 	return nil
 }
 
-// Publish File at Storage.
-func (p *Publisher) publishFile(ctx context.Context, file models.File) error {
+// Cancel the context when the lock of the file is taken over by another owner, aborting the upload.
+func withLock(ctx context.Context, file models.File) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	if lost := file.LockLost(); lost != nil {
+		go func() {
+			select {
+			case <-lost:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return ctx, cancel
+}
+
+func lockLost(file models.File) bool {
+	select {
+	case <-file.LockLost():
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop processing the file whose lock was taken over, the new owner processes it.
+func abandon(ctx context.Context, file models.File) error {
+	trace.AddSpanTags(trace.SpanFromContext(ctx), map[string]string{"result": "lock-lost"})
+
+	return fmt.Errorf("%w: '%s'", models.ErrLockLost, file.FilePath)
+}
+
+// Release the lock after the file is processed, a lock taken over meanwhile is counted.
+func (p *Publisher) unlock(ctx context.Context, file models.File) {
+	err := file.Unlock(ctx)
+
+	switch {
+	case err == nil:
+	case errors.Is(err, models.ErrLockLost):
+		logger.Errorf("[Publisher %d] Lock of file '%s' was taken over while it was processed, %s", p.ID, file.FilePath, err)
+		p.metrics.LockLost()
+	default:
+		logger.Warningf("[Publisher %d] Failed to release the lock of file '%s', %s", p.ID, file.FilePath, err)
+	}
+}
+
+func (p *Publisher) withRetry(ctx context.Context, operation string, file models.File, fn func() error) error {
+	return p.cfg.Retry.Do(ctx, func(attempt int) error {
+		err := fn()
+		if err != nil && attempt < p.cfg.Retry.MaxAttempts {
+			logger.Warningf(
+				"[Publisher %d] Attempt %d/%d to %s file '%s' failed, %s",
+				p.ID, attempt, p.cfg.Retry.MaxAttempts, operation, file.FilePath, err,
+			)
+		}
+
+		return err
+	})
+}
+
+// Publish file at storage, recording the upload progress at journal.
+func (p *Publisher) uploadFile(ctx context.Context, file models.File) error {
+	if err := p.record(file.FileInfo, models.FileUploading); err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+
+	checksum, err := p.publishFile(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	p.metrics.FileUploaded(file.Size, time.Since(startTime))
+
+	entry := models.NewJournalEntry(file.FileInfo, p.EventTopic, models.FileUploaded)
+	entry.Checksum = checksum
+	entry.UploadedAt = entry.UpdatedAt
+
+	return p.recordEntry(entry)
+}
+
+// Publish File at Storage, the checksums are computed while the content is uploaded. When the storage must get
+// them up front, like the Content-MD5 header, or it didn't read the whole content, the file is read again.
+func (p *Publisher) publishFile(ctx context.Context, file models.File) (models.Checksum, error) {
 	span := trace.SpanFromContext(ctx)
 
 	trace.AddSpanEvents(
@@ -113,24 +312,103 @@ func (p *Publisher) publishFile(ctx context.Context, file models.File) error {
 
 	reader, err := file.Open(ctx)
 	if err != nil {
-		return err
+		return models.Checksum{}, err
 	}
 	defer reader.Close()
 
-	err = p.storage.SendFile(ctx, file.Key, reader)
+	var checksum models.Checksum
+
+	if checksumUpFront(p.cfg.Checksums) {
+		if checksum, err = computeChecksum(reader, p.cfg.Checksums); err != nil {
+			return models.Checksum{}, err
+		}
+
+		if err = p.storage.SendFile(ctx, file.Key, reader, checksum); err != nil {
+			return models.Checksum{}, err
+		}
+	} else {
+		streamed := newChecksumReader(reader, file.Size, p.cfg.Checksums)
+		if err = p.storage.SendFile(ctx, file.Key, streamed, models.Checksum{}); err != nil {
+			return models.Checksum{}, err
+		}
+
+		var ok bool
+		if checksum, ok = streamed.Checksum(); !ok {
+			if _, err = reader.Seek(0, io.SeekStart); err != nil {
+				return models.Checksum{}, err
+			}
+
+			if checksum, err = computeChecksum(reader, p.cfg.Checksums); err != nil {
+				return models.Checksum{}, err
+			}
+		}
+	}
+
+	trace.AddSpanTags(span, map[string]string{"checksumSHA256": checksum.Hex()[ChecksumSHA256]})
+
+	return checksum, nil
+}
+
+// Apply the configured action on the uploaded file and record it as moved at journal.
+func (p *Publisher) afterUpload(ctx context.Context, file models.File) error {
+	var err error
+
+	switch p.cfg.AfterUpload.action() {
+	case AfterUploadDelete:
+		if err = p.removeFile(ctx, file); err == nil {
+			p.removeMarker(ctx, file)
+		}
+	case AfterUploadRenameSuffix:
+		newPath := file.FilePath + p.cfg.AfterUpload.suffix()
+		if err = p.moveFile(ctx, file, newPath); err == nil {
+			p.moveMarker(ctx, file, newPath)
+		}
+	case AfterUploadKeep:
+		logger.Debugf("[Publisher %d] Keeping file '%s'", p.ID, file.FilePath)
+	default:
+		var newPath string
+
+		newPath, err = p.cfg.AfterUpload.destination(file, time.Now())
+		if err == nil {
+			if err = p.moveFile(ctx, file, newPath); err == nil {
+				p.moveMarker(ctx, file, newPath)
+			}
+		}
+	}
+
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return p.record(file.FileInfo, models.FileMoved)
 }
 
-// Move file to ./sent/<filename>.
-func (p *Publisher) moveFile(ctx context.Context, file models.File) {
-	span := trace.SpanFromContext(ctx)
+// Move the marker together with the file, a failure don't affect the file processing.
+func (p *Publisher) moveMarker(ctx context.Context, file models.File, newFilePath string) {
+	if !file.HasMarker() {
+		return
+	}
 
-	fileDir, fileName := path.Split(file.FilePath)
-	newPath := path.Join(fileDir, "sent", fileName)
+	if err := file.MoveMarker(ctx, newFilePath); err != nil {
+		trace.AddSpanError(trace.SpanFromContext(ctx), err)
+		logger.Errorf("[Publisher %d] Failed to move marker '%s', %s", p.ID, file.MarkerPath, err)
+	}
+}
+
+// Remove the marker together with the file, a failure don't affect the file processing.
+func (p *Publisher) removeMarker(ctx context.Context, file models.File) {
+	if !file.HasMarker() {
+		return
+	}
+
+	if err := file.RemoveMarker(ctx); err != nil {
+		trace.AddSpanError(trace.SpanFromContext(ctx), err)
+		logger.Errorf("[Publisher %d] Failed to remove marker '%s', %s", p.ID, file.MarkerPath, err)
+	}
+}
+
+func (p *Publisher) moveFile(ctx context.Context, file models.File, newPath string) error {
+	span := trace.SpanFromContext(ctx)
 
 	trace.AddSpanEvents(
 		span,
@@ -146,14 +424,164 @@ func (p *Publisher) moveFile(ctx context.Context, file models.File) {
 		trace.FailSpan(span, "Failed to move file")
 		logger.Errorf("Failed to move file, %s", err)
 
+		return err
+	}
+
+	return nil
+}
+
+func (p *Publisher) removeFile(ctx context.Context, file models.File) error {
+	span := trace.SpanFromContext(ctx)
+
+	trace.AddSpanEvents(
+		span,
+		"publisher.removeFile",
+		map[string]string{
+			"filename": file.Name,
+			"filepath": file.FilePath,
+		})
+
+	if err := file.Remove(ctx); err != nil {
+		trace.AddSpanError(span, err)
+		trace.FailSpan(span, "Failed to remove file")
+		logger.Errorf("Failed to remove file, %s", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// Move the file to the failed directory with a sidecar file explaining the last error.
+func (p *Publisher) deadLetter(ctx context.Context, file models.File, stage string, cause error) {
+	if !p.cfg.deadLetterEnabled() {
 		return
 	}
+
+	span := trace.SpanFromContext(ctx)
+
+	failedDir := p.cfg.failedDir()
+	fileDir, fileName := path.Split(file.FilePath)
+
+	if !path.IsAbs(failedDir) {
+		failedDir = path.Join(fileDir, failedDir)
+	}
+
+	newPath := path.Join(failedDir, fileName)
+
+	trace.AddSpanEvents(
+		span,
+		"publisher.deadLetter",
+		map[string]string{
+			"filename": file.Name,
+			"filepath": file.FilePath,
+			"newpath":  newPath,
+			"stage":    stage,
+		})
+
+	report, err := json.MarshalIndent(failureReport{
+		FileName:   file.Name,
+		FilePath:   file.FilePath,
+		FileKey:    file.Key,
+		Stage:      stage,
+		Attempts:   p.cfg.Retry.MaxAttempts,
+		Error:      cause.Error(),
+		FailedAt:   time.Now(),
+		EventTopic: p.EventTopic,
+	}, "", "  ")
+	if err != nil {
+		logger.Errorf("[Publisher %d] Failed to encode failure report of '%s', %s", p.ID, file.FilePath, err)
+
+		return
+	}
+
+	if err := file.Move(ctx, newPath); err != nil {
+		trace.AddSpanError(span, err)
+		logger.Errorf("[Publisher %d] Failed to move file '%s' to '%s', %s", p.ID, file.FilePath, newPath, err)
+
+		return
+	}
+
+	p.moveMarker(ctx, file, newPath)
+
+	if err := file.WriteFile(ctx, newPath+errorReportSuffix, report); err != nil {
+		trace.AddSpanError(span, err)
+		logger.Errorf("[Publisher %d] Failed to write failure report of '%s', %s", p.ID, newPath, err)
+	}
+
+	logger.Errorf("[Publisher %d] File '%s' moved to '%s' after %s failures", p.ID, file.FilePath, newPath, stage)
+
+	_ = p.record(file.FileInfo, models.FileFailed)
+}
+
+func (p *Publisher) record(info models.FileInfo, state models.FileState) error {
+	return p.recordEntry(models.NewJournalEntry(info, p.EventTopic, state))
 }
 
-func (p *Publisher) notifyResult(result string, data any) {
+func (p *Publisher) recordEntry(entry models.JournalEntry) error {
+	err := p.journal.Record(entry)
+	if err != nil {
+		logger.Errorf(
+			"[Publisher %d] Failed to record file '%s' as %s at journal, %s", p.ID, entry.FilePath, entry.State, err,
+		)
+	}
+
+	return err
+}
+
+// Send the success event, the streamer records the file as published once the broker accepts it.
+func (p *Publisher) notifySuccess(ctx context.Context, info models.FileInfo) {
+	data := p.eventData(ctx, info)
+	data.Bucket, data.ObjectKey = p.storage.Locate(info.Key)
+
+	if entry, ok := p.journal.Get(info); ok {
+		data.Checksums = entry.Checksum.Hex()
+		data.CollectedAt = optionalTime(entry.CollectedAt)
+		data.UploadedAt = optionalTime(entry.UploadedAt)
+	}
+
+	p.notifyResult(ctx, "success", info, data)
+}
+
+func (p *Publisher) notifyFailure(ctx context.Context, info models.FileInfo, cause error) {
+	data := p.eventData(ctx, info)
+	data.Error = cause.Error()
+
+	if entry, ok := p.journal.Get(info); ok {
+		data.CollectedAt = optionalTime(entry.CollectedAt)
+	}
+
+	p.notifyResult(ctx, "error", info, data)
+}
+
+func (p *Publisher) eventData(ctx context.Context, info models.FileInfo) models.FileEventData {
+	data := models.NewFileEventData(info)
+	data.SenderID = p.SenderID
+	data.Host = p.hostname
+	data.TraceID = trace.TraceID(ctx)
+
+	return data
+}
+
+// The event carries the trace context, so the consumers continue the trace of the file.
+func (p *Publisher) notifyResult(ctx context.Context, result string, info models.FileInfo, data models.FileEventData) {
 	event, err := models.NewEvent(p.EventTopic, result, data)
 	if err != nil {
 		logger.Errorf("Failed to create event, %s", err)
 	}
+
+	event.Source = fmt.Sprintf("/collector/%s/senders/%d", p.hostname, p.SenderID)
+	event.Subject = info.Key
+	event.CorrelationID = models.JournalID(info)
+	event.TraceContext = trace.Inject(ctx)
+
 	p.eventChannel <- event
 }
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -2,6 +2,11 @@ package publisher
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
@@ -9,9 +14,13 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/gofrs/flock"
 	"github.com/stretchr/testify/assert"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/journal"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/storage"
 )
 
@@ -49,7 +58,10 @@ func newSut() *Publisher {
 	eventChannel := make(chan models.Event, 10)
 	waitGroup := &sync.WaitGroup{}
 
-	return New(1, "files", storage.NewMemoryStorage(), eventChannel, waitGroup)
+	return New(
+		1, 1, "files", Config{}, storage.NewMemoryStorage(), journal.NewMemoryJournal(), eventChannel, waitGroup,
+		metrics.NewSender(1, "files"),
+	)
 }
 
 func TestPublishFileSendFileToStorage(t *testing.T) {
@@ -62,7 +74,7 @@ func TestPublishFileSendFileToStorage(t *testing.T) {
 	assert.Nil(t, err)
 
 	// Action
-	err = sut.publishFile(context.TODO(), file)
+	_, err = sut.publishFile(context.TODO(), file)
 	assert.Nil(t, err)
 
 	// Arrange
@@ -211,12 +223,22 @@ func TestHandleShouldSendSuccessEventWhenProcessFileReturnNil(t *testing.T) {
 	sut.waitGroup.Wait()
 
 	// Assert
-	expectedEvent, err := models.NewEvent(sut.EventTopic, "success", map[string]string{"file_key": successFile.Key})
-	assert.Nil(t, err)
-
+	checksum := sha256.Sum256([]byte{123})
 	event := <-sut.eventChannel
+	eventData := event.Data.(models.FileEventData)
 
-	assert.Equal(t, expectedEvent, event)
+	assert.Equal(t, "success", event.Key)
+	assert.Equal(t, sut.EventTopic, event.Topic)
+	assert.Equal(t, successFile.Key, event.Subject)
+	assert.Equal(t, models.JournalID(successFile.FileInfo), event.CorrelationID)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, models.FileEventVersion, eventData.Version)
+	assert.Equal(t, successFile.Key, eventData.ObjectKey)
+	assert.Equal(t, successFile.FilePath, eventData.OriginalPath)
+	assert.Equal(t, "application/json", eventData.ContentType)
+	assert.Equal(t, hex.EncodeToString(checksum[:]), eventData.Checksums["sha256"])
+	assert.Equal(t, 1, eventData.SenderID)
+	assert.NotNil(t, eventData.UploadedAt)
 }
 
 func TestHandleShouldSendErrorEventWhenProcessFileReturnError(t *testing.T) {
@@ -247,12 +269,288 @@ func TestHandleShouldSendErrorEventWhenProcessFileReturnError(t *testing.T) {
 
 	// Assert
 	event := <-sut.eventChannel
-	eventData := event.Data.(map[string]string)
-	eventError, _ := eventData["error"]
-	eventFilePath, _ := eventData["file_path"]
+	eventData := event.Data.(models.FileEventData)
 
 	assert.Equal(t, "error", event.Key)
 	assert.Equal(t, sut.EventTopic, event.Topic)
-	assert.Equal(t, errorFile.FilePath, eventFilePath)
-	assert.Contains(t, eventError, "no such file or directory")
+	assert.Equal(t, errorFile.FilePath, eventData.OriginalPath)
+	assert.Empty(t, eventData.ObjectKey)
+	assert.Contains(t, eventData.Error, "no such file or directory")
+}
+
+func TestProcessFileShouldNotUploadFileAlreadyUploaded(t *testing.T) {
+	// Prepare
+	folder, err := ioutil.TempDir("", "*")
+	if err != nil {
+		panic(err)
+	}
+
+	sut := newSut()
+	memoryStorage, _ := sut.storage.(*storage.MemoryStorage)
+
+	// Arrange
+	testFile, err := createTempFile(folder, "test_file_uploaded.json")
+	assert.Nil(t, err)
+
+	err = sut.journal.Record(models.NewJournalEntry(testFile.FileInfo, sut.EventTopic, models.FileUploaded))
+	assert.Nil(t, err)
+
+	// Action
+	sut.waitGroup.Add(1)
+	err = sut.processFile(context.TODO(), testFile)
+	assert.Nil(t, err)
+
+	// Assert
+	entry, _ := sut.journal.Get(testFile.FileInfo)
+	assert.Empty(t, memoryStorage.GetAllFiles())
+	assert.NoFileExists(t, testFile.FilePath)
+	assert.Equal(t, models.FileMoved, entry.State)
+}
+
+func TestResumePendingShouldSendEventOfMovedFiles(t *testing.T) {
+	// Prepare
+	sut := newSut()
+	info := models.FileInfo{Name: "moved.json", FilePath: "/data/moved.json", Key: "moved.json", Size: 1}
+	queuedInfo := models.FileInfo{Name: "queued.json", FilePath: "/data/queued.json", Key: "queued.json", Size: 1}
+
+	// Arrange
+	assert.Nil(t, sut.journal.Record(models.NewJournalEntry(info, sut.EventTopic, models.FileMoved)))
+	assert.Nil(t, sut.journal.Record(models.NewJournalEntry(queuedInfo, sut.EventTopic, models.FileMoved)))
+
+	// Action
+	sut.ResumePending(func(journalID string) bool { return journalID == models.JournalID(queuedInfo) })
+
+	// Assert
+	assert.Len(t, sut.eventChannel, 1)
+
+	event := <-sut.eventChannel
+	assert.Equal(t, "success", event.Key)
+	assert.Equal(t, info.Key, event.Data.(models.FileEventData).FileKey)
+	assert.Equal(t, models.JournalID(info), event.CorrelationID)
+
+	// The file is published only when the broker accepts the event
+	entry, _ := sut.journal.Get(info)
+	assert.Equal(t, models.FileMoved, entry.State)
+}
+
+type failingStorage struct {
+	calls int
+}
+
+func (fs *failingStorage) SendFile(
+	ctx context.Context, fileKey string, reader io.ReadSeeker, checksum models.Checksum,
+) error {
+	fs.calls++
+
+	return errors.New("storage unavailable")
+}
+
+func (fs *failingStorage) Locate(fileKey string) (string, string) {
+	return "", fileKey
+}
+
+func TestProcessFileShouldMoveFileToFailedDirAfterExhaustingAttempts(t *testing.T) {
+	// Prepare
+	folder, err := ioutil.TempDir("", "*")
+	if err != nil {
+		panic(err)
+	}
+
+	failing := &failingStorage{}
+	sut := newSut()
+	sut.storage = failing
+	sut.cfg = Config{Retry: retry.Policy{MaxAttempts: 2}}
+
+	// Arrange
+	testFile, err := createTempFile(folder, "test_failed_file.json")
+	assert.Nil(t, err)
+
+	// Action
+	sut.waitGroup.Add(1)
+	err = sut.processFile(context.TODO(), testFile)
+
+	// Assert
+	failedPath := filepath.Join(folder, "failed", testFile.Name)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, failing.calls)
+	assert.NoFileExists(t, testFile.FilePath)
+	assert.FileExists(t, failedPath)
+
+	data, err := ioutil.ReadFile(failedPath + errorReportSuffix)
+	assert.Nil(t, err)
+
+	var report failureReport
+	assert.Nil(t, json.Unmarshal(data, &report))
+	assert.Equal(t, "upload", report.Stage)
+	assert.Equal(t, "storage unavailable", report.Error)
+	assert.Equal(t, testFile.FilePath, report.FilePath)
+
+	entry, _ := sut.journal.Get(testFile.FileInfo)
+	assert.Equal(t, models.FileFailed, entry.State)
+}
+
+func TestProcessFileShouldKeepFileWhenRetryIsNotConfigured(t *testing.T) {
+	// Prepare
+	folder, err := ioutil.TempDir("", "*")
+	if err != nil {
+		panic(err)
+	}
+
+	sut := newSut()
+	sut.storage = &failingStorage{}
+
+	// Arrange
+	testFile, err := createTempFile(folder, "test_failed_file.json")
+	assert.Nil(t, err)
+
+	// Action
+	sut.waitGroup.Add(1)
+	err = sut.processFile(context.TODO(), testFile)
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.FileExists(t, testFile.FilePath)
+	assert.NoDirExists(t, filepath.Join(folder, "failed"))
+}
+
+func TestProcessFileShouldApplyAfterUploadAction(t *testing.T) {
+	testCases := []struct {
+		action       string
+		expectedPath func(filePath string) string
+	}{
+		{action: AfterUploadDelete, expectedPath: func(string) string { return "" }},
+		{action: AfterUploadRenameSuffix, expectedPath: func(fp string) string { return fp + defaultRenameSuffix }},
+		{action: AfterUploadKeep, expectedPath: func(fp string) string { return fp }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.action, func(t *testing.T) {
+			// Prepare
+			sut := newSut()
+			sut.cfg = Config{AfterUpload: AfterUploadConfig{Action: tc.action}}
+
+			// Arrange
+			testFile, err := createTempFile(t.TempDir(), "test_after_upload.json")
+			assert.Nil(t, err)
+
+			// Action
+			sut.waitGroup.Add(1)
+			err = sut.processFile(context.TODO(), testFile)
+			assert.Nil(t, err)
+
+			// Assert
+			expectedPath := tc.expectedPath(testFile.FilePath)
+			if expectedPath == "" {
+				assert.NoFileExists(t, testFile.FilePath)
+			} else {
+				assert.FileExists(t, expectedPath)
+			}
+
+			entry, _ := sut.journal.Get(testFile.FileInfo)
+			assert.Equal(t, models.FileMoved, entry.State)
+		})
+	}
+}
+
+func TestProcessFileShouldMoveMarkerWithFile(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	sut := newSut()
+
+	// Arrange
+	testFile, err := createTempFile(folder, "test_file_with_marker.json")
+	assert.Nil(t, err)
+
+	testFile.MarkerPath = testFile.FilePath + ".done"
+	err = ioutil.WriteFile(testFile.MarkerPath, []byte{}, fs.ModePerm)
+	assert.Nil(t, err)
+
+	// Action
+	sut.waitGroup.Add(1)
+	err = sut.processFile(context.TODO(), testFile)
+	assert.Nil(t, err)
+
+	// Assert
+	assert.NoFileExists(t, testFile.MarkerPath)
+	assert.FileExists(t, filepath.Join(folder, "sent", testFile.Name))
+	assert.FileExists(t, filepath.Join(folder, "sent", testFile.Name+".done"))
+}
+
+func TestHandleFileShouldSkipFileLockedByAnotherOwner(t *testing.T) {
+	// Prepare
+	sut := newSut()
+	memoryStorage, _ := sut.storage.(*storage.MemoryStorage)
+
+	file, err := createTempFile(t.TempDir(), "locked.json")
+	assert.Nil(t, err)
+
+	// Arrange
+	other := flock.New(file.FilePath)
+	locked, err := other.TryLock()
+	assert.Nil(t, err)
+	assert.True(t, locked)
+
+	defer other.Unlock()
+
+	// Action
+	sut.waitGroup.Add(1)
+	sut.handleFile(context.TODO(), file)
+
+	// Assert
+	assert.Empty(t, sut.eventChannel)
+	assert.False(t, memoryStorage.FileExists(file.Key))
+}
+
+type lostLock struct {
+	lost chan struct{}
+}
+
+func (l lostLock) Unlock() error {
+	return models.ErrLockLost
+}
+
+func (l lostLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+type leaseFileServer struct {
+	*fileserver.LocalFileServer
+	lock lostLock
+}
+
+func (fs leaseFileServer) AcquireLock(ctx context.Context, filePath string) (models.Locker, error) {
+	return fs.lock, nil
+}
+
+func TestHandleFileShouldStopProcessingWhenLockIsLost(t *testing.T) {
+	// Prepare
+	sut := newSut()
+	sut.cfg = Config{AfterUpload: AfterUploadConfig{Action: AfterUploadDelete}, Retry: retry.Policy{MaxAttempts: 1}}
+
+	localFile, err := createTempFile(t.TempDir(), "lost.json")
+	assert.Nil(t, err)
+
+	server, err := fileserver.NewLocalFileServer(fileserver.Config{})
+	assert.Nil(t, err)
+
+	// Arrange
+	lock := lostLock{lost: make(chan struct{})}
+	close(lock.lost)
+
+	file, err := models.NewFile(
+		localFile.Name, localFile.FilePath, localFile.Key, localFile.Size, localFile.ModTime,
+		leaseFileServer{LocalFileServer: server, lock: lock},
+	)
+	assert.Nil(t, err)
+
+	// Action
+	sut.waitGroup.Add(1)
+	err = sut.processFile(context.TODO(), file)
+
+	// Assert
+	assert.ErrorIs(t, err, models.ErrLockLost)
+	assert.FileExists(t, file.FilePath)
+	assert.NoDirExists(t, filepath.Join(filepath.Dir(file.FilePath), defaultFailedDir))
+	assert.Empty(t, sut.eventChannel)
 }
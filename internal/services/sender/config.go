@@ -1,13 +1,102 @@
 package sender
 
 import (
+	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/collector"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/publisher"
+	"gopkg.in/yaml.v3"
+)
+
+// File server used by the sender instead of the global one.
+// Senders that declare the same name share the same client, a block with only
+// the name refers to a file server declared by another sender.
+type FileServerConfig struct {
+	Name                    string `yaml:"name" json:"name"`
+	config.FileServerConfig `yaml:",inline"`
+}
+
+// Storage used by the sender instead of the global one.
+// Senders that declare the same name share the same client, a block with only
+// the name (and optionally the keyPrefix) refers to a storage declared by another sender.
+type StorageConfig struct {
+	Name                 string `yaml:"name" json:"name"`
+	KeyPrefix            string `yaml:"keyPrefix" json:"keyPrefix"`
+	config.StorageConfig `yaml:",inline"`
+}
+
+// Broker used by the sender instead of the global one.
+// Senders that declare the same name share the same client, a block with only
+// the name refers to a broker declared by another sender.
+type BrokerConfig struct {
+	Name                string `yaml:"name" json:"name"`
+	config.BrokerConfig `yaml:",inline"`
+}
+
+// The blocks start with the defaults of the env settings, a block without type keeps it empty since it refers
+// to a backend declared by another sender.
+func (c *FileServerConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain FileServerConfig
+
+	return decodeBackend(node, (*plain)(c), &c.FileServerConfig, &c.Type)
+}
+
+func (c *StorageConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain StorageConfig
+
+	return decodeBackend(node, (*plain)(c), &c.StorageConfig, &c.Type)
+}
+
+func (c *BrokerConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain BrokerConfig
+
+	return decodeBackend(node, (*plain)(c), &c.BrokerConfig, &c.Type)
+}
+
+func decodeBackend(node *yaml.Node, out, defaults interface{}, backendType *string) error {
+	if err := config.ApplyDefaults(defaults); err != nil {
+		return err
+	}
+
+	if err := node.Decode(out); err != nil {
+		return err
+	}
+
+	if !hasKey(node, "type") {
+		*backendType = ""
+	}
+
+	return nil
+}
+
+func hasKey(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	// Glob all the patterns on each collect loop
+	ModePoll = "poll"
+	// Collect the files notified by the file server, globing all the patterns only on each sweep
+	ModeWatch = "watch"
+
+	defaultSweepDelay = 60
 )
 
 type Config struct {
+	// Identify the sender when the config is reloaded, the sender position is used when it's empty
+	Name string `yaml:"name" json:"name"`
+
 	// Broker topic name to send event with file process result
 	EventTopic string `yaml:"topic" json:"topic"`
 
@@ -17,7 +106,20 @@ type Config struct {
 	// Minimum seconds between each collect loop
 	CollectDelay int `yaml:"delay" json:"delay"`
 
+	// Collect mode, poll (default) or watch
+	Mode string `yaml:"mode" json:"mode"`
+
+	// Seconds between each full collect on watch mode, catching the files whose events were missed
+	SweepDelay int `yaml:"sweepDelay" json:"sweepDelay"`
+
 	CollectorCfg collector.Config `json:"collect" yaml:"collect"`
+
+	PublisherCfg publisher.Config `json:"publish" yaml:"publish"`
+
+	// Optional backends, when not informed the global backends are used
+	FileServer *FileServerConfig `yaml:"fileServer,omitempty" json:"fileServer,omitempty"`
+	Storage    *StorageConfig    `yaml:"storage,omitempty" json:"storage,omitempty"`
+	Broker     *BrokerConfig     `yaml:"broker,omitempty" json:"broker,omitempty"`
 }
 
 func (c Config) Validate() error {
@@ -31,13 +133,66 @@ func (c Config) Validate() error {
 		validator.AddError("workers", "must be higher then 0")
 	}
 
+	if c.Mode != "" && c.Mode != ModePoll && c.Mode != ModeWatch {
+		validator.AddError("mode", fmt.Sprintf("must be %s or %s", ModePoll, ModeWatch))
+	}
+
+	if c.SweepDelay < 0 {
+		validator.AddError("sweepDelay", "must be higher or equal then 0")
+	}
+
 	if err := c.CollectorCfg.Validate(); err != nil {
 		validator.AddError("collector", err.Error())
 	}
 
+	if err := c.PublisherCfg.Validate(); err != nil {
+		validator.AddError("publisher", err.Error())
+	}
+
+	if c.FileServer != nil && strings.TrimSpace(c.FileServer.Name) == "" {
+		validator.AddError("fileServer", "name is required")
+	}
+
+	if c.Storage != nil && strings.TrimSpace(c.Storage.Name) == "" {
+		validator.AddError("storage", "name is required")
+	}
+
+	if c.Broker != nil && strings.TrimSpace(c.Broker.Name) == "" {
+		validator.AddError("broker", "name is required")
+	}
+
 	if validator.HasErrors() {
 		return validator.GetError()
 	}
 
 	return nil
 }
+
+// Outbox stream of the sender events, the senders sending to the same broker and topic share it.
+func (c Config) outboxStream() string {
+	if c.Broker == nil || c.Broker.Name == "" {
+		return c.EventTopic
+	}
+
+	return c.Broker.Name + "/" + c.EventTopic
+}
+
+// Check if the config can be applied on a running sender, the other changes require a new sender.
+func (c Config) canReload(other Config) bool {
+	return c.Name == other.Name &&
+		c.EventTopic == other.EventTopic &&
+		c.Mode == other.Mode &&
+		c.PublisherCfg.Retry == other.PublisherCfg.Retry &&
+		c.PublisherCfg.EventMaxAge == other.PublisherCfg.EventMaxAge &&
+		reflect.DeepEqual(c.FileServer, other.FileServer) &&
+		reflect.DeepEqual(c.Storage, other.Storage) &&
+		reflect.DeepEqual(c.Broker, other.Broker)
+}
+
+func (c Config) sweepDelay() time.Duration {
+	if c.SweepDelay == 0 {
+		return defaultSweepDelay * time.Second
+	}
+
+	return time.Duration(c.SweepDelay) * time.Second
+}
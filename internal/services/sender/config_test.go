@@ -2,9 +2,11 @@ package sender
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/collector"
+	"gopkg.in/yaml.v3"
 )
 
 func TestValidateShouldReturnErrorWhenEventTopicIsInvalid(t *testing.T) {
@@ -89,3 +91,78 @@ func TestValidateShouldReturnNillWhenConfigIsValid(t *testing.T) {
 	// Assert
 	assert.Nil(t, err)
 }
+
+func TestValidateShouldReturnErrorWhenBackendNameIsEmpty(t *testing.T) {
+	// Arrange
+	sut := Config{
+		CollectorCfg: collector.Config{
+			MatchPatterns: []string{"./files/*.json"},
+		},
+		EventTopic: "event-topic",
+		Workers:    1,
+		FileServer: &FileServerConfig{},
+		Storage:    &StorageConfig{},
+		Broker:     &BrokerConfig{},
+	}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fileServer: name is required")
+	assert.Contains(t, err.Error(), "storage: name is required")
+	assert.Contains(t, err.Error(), "broker: name is required")
+}
+
+func TestValidateShouldReturnErrorWhenModeIsInvalid(t *testing.T) {
+	// Arrange
+	sut := Config{
+		CollectorCfg: collector.Config{
+			MatchPatterns: []string{"./files/*.json"},
+		},
+		EventTopic: "event-topic",
+		Workers:    1,
+		Mode:       "inotify",
+		SweepDelay: -1,
+	}
+
+	// Action
+	err := sut.Validate()
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "mode: must be poll or watch")
+	assert.Contains(t, err.Error(), "sweepDelay: must be higher or equal then 0")
+}
+
+func TestUnmarshalYAMLShouldApplyBackendDefaults(t *testing.T) {
+	// Arrange
+	data := []byte(`
+fileServer:
+  name: partner-a
+  type: s3
+  s3Bucket: inbox
+  timeout: 10s
+storage:
+  name: files
+broker:
+  name: events
+  type: rabbitmq
+`)
+
+	// Action
+	var sut Config
+	err := yaml.Unmarshal(data, &sut)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "s3", sut.FileServer.Type)
+	assert.Equal(t, "inbox", sut.FileServer.S3Bucket)
+	assert.Equal(t, 10*time.Second, sut.FileServer.Timeout)
+	assert.Equal(t, 3, sut.FileServer.ReconnectAttempts)
+	assert.True(t, sut.FileServer.S3ConditionalWrites)
+	assert.Equal(t, "", sut.Storage.Type)
+	assert.Equal(t, "json", sut.Broker.EventFormat)
+	assert.Equal(t, 5*time.Second, sut.Broker.ConfirmTimeout)
+}
@@ -2,7 +2,11 @@ package sender
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
@@ -11,77 +15,153 @@ import (
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/publisher"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services/streamer"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/trace"
 )
 
+// Loops faster than this are expected to take this long, the uploads of a loop can take a while.
+const minLoopInterval = 30 * time.Second
+
+var (
+	ErrWatchNotSupported  = errors.New("file server doesn't support the watch mode")
+	ErrLoopStuck          = errors.New("sender loop is stuck")
+	ErrShutdownIncomplete = errors.New("shutdown incomplete")
+	ErrRestartRequired    = errors.New("config changes require a new sender")
+)
+
 type Sender struct {
 	ID               int
+	mutex            sync.RWMutex
 	config           Config
+	pending          *pendingReload
+	wake             chan struct{}
 	storage          services.Storage
+	fileServer       services.FileServer
+	journal          services.Journal
 	collector        *collector.Collector
 	streamer         *streamer.Streamer
 	publisherPool    []*publisher.Publisher
 	eventChannel     chan models.Event
+	fileChannel      chan models.File
+	channelMutex     sync.RWMutex
+	metrics          metrics.Sender
+	unobserve        []func()
 	collectWaitGroup *sync.WaitGroup
 	processWaitGroup *sync.WaitGroup
-	quit             chan bool
+	watcher          services.FileWatcher
+	watchEvents      <-chan models.WatchEvent
+	stopWatch        context.CancelFunc
+	nextSweep        time.Time
+	lastLoop         int64
+	started          int32
+	stopOnce         sync.Once
+	quit             chan struct{}
+	done             chan struct{}
 }
 
 func New(
-	processID int, config Config, storage services.Storage, fileServer services.FileServer, broker services.Broker,
+	processID int,
+	config Config,
+	storage services.Storage,
+	fileServer services.FileServer,
+	broker services.Broker,
+	journal services.Journal,
+	outbox services.Outbox,
 ) (*Sender, error) {
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
 
+	var watcher services.FileWatcher
+
+	if config.Mode == ModeWatch {
+		fileWatcher, ok := fileServer.(services.FileWatcher)
+		if !ok {
+			return nil, ErrWatchNotSupported
+		}
+
+		watcher = fileWatcher
+	}
+
 	collectWaitGroup := &sync.WaitGroup{}
 	processWaitGroup := &sync.WaitGroup{}
 	eventChannel := make(chan models.Event, config.Workers)
 
-	collector, err := collector.New(processID, config.CollectorCfg, fileServer, collectWaitGroup, processWaitGroup)
+	collector, err := collector.New(
+		processID, config.EventTopic, config.CollectorCfg, fileServer, journal, collectWaitGroup, processWaitGroup,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	eventStreamer, err := streamer.New(broker, eventChannel)
+	senderMetrics := metrics.NewSender(processID, config.EventTopic)
+
+	eventStreamer, err := streamer.New(
+		broker,
+		outbox,
+		journal,
+		config.outboxStream(),
+		eventChannel,
+		config.PublisherCfg.Retry,
+		config.PublisherCfg.MaxEventAge(),
+		senderMetrics,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	eventStreamer.Start()
-
-	return &Sender{
+	sender := &Sender{
 		ID:               processID,
 		config:           config,
 		storage:          storage,
+		fileServer:       fileServer,
+		journal:          journal,
 		collector:        collector,
 		streamer:         eventStreamer,
 		publisherPool:    []*publisher.Publisher{},
 		eventChannel:     eventChannel,
+		metrics:          senderMetrics,
 		collectWaitGroup: collectWaitGroup,
 		processWaitGroup: processWaitGroup,
-	}, nil
+		watcher:          watcher,
+		wake:             make(chan struct{}, 1),
+		quit:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	return sender, nil
 }
 
+// Run the collect loops until the sender is stopped, the current loop is always completed.
 func (s *Sender) loop() {
+	defer close(s.done)
+
+	var events []models.WatchEvent
+
 	for {
 		select {
 		case <-s.quit:
-			s.Stop()
-
 			return
 
 		default:
+			s.applyReload()
+
 			startTime := time.Now()
 
 			fileChannel := make(chan models.File, s.config.Workers)
+			s.setFileChannel(fileChannel)
 			ctx, span := trace.NewSpan(context.Background(), "sender.loop")
 
 			for _, worker := range s.publisherPool {
 				worker.Handle(ctx, fileChannel)
 			}
 
-			s.collector.CollectFiles(ctx, fileChannel)
+			if events == nil {
+				s.collector.CollectFiles(ctx, fileChannel)
+				s.nextSweep = time.Now().Add(s.config.sweepDelay())
+			} else {
+				s.collector.CollectEvents(ctx, fileChannel, events)
+			}
 
 			s.collectWaitGroup.Wait()
 			s.processWaitGroup.Wait()
@@ -91,33 +171,361 @@ func (s *Sender) loop() {
 
 			took := time.Since(startTime)
 			logger.Infof("[Sender %d] Took %s", s.ID, took.String())
+			s.metrics.LoopFinished(took, time.Duration(s.config.CollectDelay)*time.Second)
+			atomic.StoreInt64(&s.lastLoop, time.Now().UnixNano())
+
+			if s.watchEvents == nil {
+				s.sleep((time.Duration(s.config.CollectDelay) * time.Second) - took)
+			} else {
+				events = s.waitEvents(took)
+			}
+		}
+	}
+}
+
+// Check the readiness of the collected directories.
+func (s *Sender) CheckDirectories(ctx context.Context) error {
+	s.mutex.RLock()
+	collector := s.collector
+	s.mutex.RUnlock()
+
+	return collector.CheckDirectories(ctx)
+}
+
+// Send again the events moved to the dead-letter stream, returns how many events were moved back.
+func (s *Sender) ReplayDeadLetters() (int, error) {
+	return s.streamer.ReplayDeadLetters()
+}
+
+// Remove the events of the dead-letter stream, returns how many events were removed.
+func (s *Sender) DiscardDeadLetters() (int, error) {
+	return s.streamer.DiscardDeadLetters()
+}
+
+// Check if the loop completed an iteration within factor times the time expected between the loops.
+func (s *Sender) CheckLoop(factor int) error {
+	lastLoop := atomic.LoadInt64(&s.lastLoop)
+	if lastLoop == 0 {
+		return nil
+	}
+
+	s.mutex.RLock()
+	config := s.config
+	s.mutex.RUnlock()
+
+	expected := time.Duration(config.CollectDelay) * time.Second
+	if config.Mode == ModeWatch && config.sweepDelay() > expected {
+		expected = config.sweepDelay()
+	}
+
+	if expected < minLoopInterval {
+		expected = minLoopInterval
+	}
+
+	elapsed := time.Since(time.Unix(0, lastLoop))
+	if elapsed > time.Duration(factor)*expected {
+		return fmt.Errorf("%w, last iteration finished %s ago", ErrLoopStuck, elapsed.Round(time.Second))
+	}
+
+	return nil
+}
+
+func (s *Sender) setFileChannel(channel chan models.File) {
+	s.channelMutex.Lock()
+	defer s.channelMutex.Unlock()
+
+	s.fileChannel = channel
+}
+
+func (s *Sender) fileChannelDepth() int {
+	s.channelMutex.RLock()
+	defer s.channelMutex.RUnlock()
+
+	return len(s.fileChannel)
+}
+
+// Wait until the delay ends or the sender is stopped.
+func (s *Sender) sleep(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
 
-			time.Sleep((time.Duration(s.config.CollectDelay) * time.Second) - took)
+	select {
+	case <-timer.C:
+	case <-s.wake:
+	case <-s.quit:
+	}
+}
+
+// Wait for the files notified by the file server, returns nil when it's time of a full sweep.
+// The events received during the collect delay are collected together on the same loop.
+func (s *Sender) waitEvents(took time.Duration) []models.WatchEvent {
+	sweep := time.NewTimer(time.Until(s.nextSweep))
+	defer sweep.Stop()
+
+	events := []models.WatchEvent{}
+	received := map[string]bool{}
+
+	receive := func(event models.WatchEvent, ok bool) bool {
+		if !ok {
+			logger.Warningf("[Sender %d] File watcher stopped, falling back to full collects", s.ID)
+			s.watchEvents = nil
+
+			return false
+		}
+
+		if !received[event.FilePath] {
+			received[event.FilePath] = true
+			events = append(events, event)
+		}
+
+		return true
+	}
+
+	select {
+	case <-s.quit:
+		return nil
+
+	case <-s.wake:
+		return nil
+
+	case <-sweep.C:
+		return nil
+
+	case event, ok := <-s.watchEvents:
+		if !receive(event, ok) {
+			return nil
+		}
+	}
+
+	delay := time.NewTimer((time.Duration(s.config.CollectDelay) * time.Second) - took)
+	defer delay.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return nil
+
+		case <-sweep.C:
+			return nil
+
+		case <-delay.C:
+			return events
+
+		case event, ok := <-s.watchEvents:
+			if !receive(event, ok) {
+				return nil
+			}
 		}
 	}
 }
 
 func (s *Sender) Start() {
+	if !atomic.CompareAndSwapInt32(&s.started, 0, 1) {
+		return
+	}
+
 	logger.Infof("[Sender %d] Starting with %d workers", s.ID, s.config.Workers)
 
+	// The channels are observed only once started, a replaced sender with the same labels is already stopped.
+	s.unobserve = []func(){
+		s.metrics.ObserveChannel("event", func() int { return len(s.eventChannel) }),
+		s.metrics.ObserveChannel("file", s.fileChannelDepth),
+	}
+
+	for workerID := len(s.publisherPool); workerID < s.config.Workers; workerID++ {
+		s.newPublisher(workerID + 1)
+	}
+
+	s.streamer.Start()
+
 	go func() {
-		s.streamer.Start()
+		atomic.StoreInt64(&s.lastLoop, time.Now().UnixNano())
+		s.publisherPool[0].ResumePending(s.streamer.Queued)
 
-		for workerID := len(s.publisherPool); workerID < s.config.Workers; workerID++ {
-			s.newPublisher(workerID + 1)
+		if s.watcher != nil {
+			s.startWatch()
 		}
 
+		defer s.stopWatching()
+
 		s.loop()
 	}()
 }
 
-func (s *Sender) Stop() {
-	go func() {
-		s.streamer.Stop()
-	}()
+// Start watching the files of the patterns, falling back to full collects when the watch fails.
+func (s *Sender) startWatch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWatch = cancel
+
+	events, err := s.watcher.Watch(ctx, s.config.CollectorCfg.MatchPatterns, s.config.CollectorCfg.Exclude...)
+	if err != nil {
+		logger.Errorf("[Sender %d] Failed to watch files, falling back to full collects, %s", s.ID, err)
+
+		return
+	}
+
+	s.watchEvents = events
+}
+
+func (s *Sender) stopWatching() {
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+
+	s.stopWatch = nil
+	s.watchEvents = nil
+}
+
+// Apply the config on the next loop, the files being processed finish with the current config.
+// Returns ErrRestartRequired when the topic, mode, backends or retry policy changes.
+func (s *Sender) Reload(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	if !s.CanReload(config) {
+		return ErrRestartRequired
+	}
+
+	s.mutex.RLock()
+	current := s.config
+	s.mutex.RUnlock()
+
+	if reflect.DeepEqual(current, config) {
+		s.mutex.Lock()
+		s.pending = nil
+		s.mutex.Unlock()
+
+		return nil
+	}
+
+	collector, err := collector.New(
+		s.ID, config.EventTopic, config.CollectorCfg, s.fileServer, s.journal, s.collectWaitGroup, s.processWaitGroup,
+	)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.pending = &pendingReload{config: config, collector: collector}
+	s.mutex.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Check if the config can be applied without replacing the sender.
+func (s *Sender) CanReload(config Config) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.config.canReload(config)
+}
+
+type pendingReload struct {
+	config    Config
+	collector *collector.Collector
+}
+
+// Replace the config, collector and publishers with the reloaded ones, called between the loops.
+func (s *Sender) applyReload() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pending == nil {
+		return
+	}
+
+	reload := s.pending
+	s.pending = nil
+
+	watchChanged := !reflect.DeepEqual(s.config.CollectorCfg.MatchPatterns, reload.config.CollectorCfg.MatchPatterns) ||
+		!reflect.DeepEqual(s.config.CollectorCfg.Exclude, reload.config.CollectorCfg.Exclude)
+
+	s.config = reload.config
+	s.collector = reload.collector
+	s.publisherPool = []*publisher.Publisher{}
+
+	for workerID := 0; workerID < s.config.Workers; workerID++ {
+		s.newPublisher(workerID + 1)
+	}
+
+	if s.watcher != nil && watchChanged {
+		s.stopWatching()
+		s.startWatch()
+	}
+
+	logger.Infof("[Sender %d] Config reloaded with %d workers", s.ID, s.config.Workers)
+}
+
+// Stop collecting new files, waiting the files being processed and the pending events to be sent to the broker.
+// When the context is done first, returns an error describing what was abandoned, the journal resumes it on the
+// next start.
+func (s *Sender) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.quit) })
+
+	if atomic.LoadInt32(&s.started) == 0 {
+		s.unobserveChannels()
+
+		return nil
+	}
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: sender %d abandoned %s", ErrShutdownIncomplete, s.ID, s.describeInFlight())
+	}
+
+	if err := s.streamer.Stop(ctx); err != nil {
+		return fmt.Errorf("%w: sender %d %s", ErrShutdownIncomplete, s.ID, err)
+	}
+
+	s.unobserveChannels()
+
+	return nil
+}
+
+// Stop reporting the channel depths, the sender replacing this one on a reload keeps reporting its own.
+func (s *Sender) unobserveChannels() {
+	for _, unobserve := range s.unobserve {
+		unobserve()
+	}
+}
+
+// Describe the files and events that weren't finished yet.
+func (s *Sender) describeInFlight() string {
+	processing := []string{}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, worker := range s.publisherPool {
+		if filePath := worker.Processing(); filePath != "" {
+			processing = append(processing, filePath)
+		}
+	}
+
+	return fmt.Sprintf(
+		"%d files being processed %v, %d files queued and %d events pending",
+		len(processing), processing, s.fileChannelDepth(), len(s.eventChannel),
+	)
 }
 
 func (s *Sender) newPublisher(workerID int) {
-	publisher := publisher.New(workerID, s.config.EventTopic, s.storage, s.eventChannel, s.processWaitGroup)
+	publisher := publisher.New(
+		workerID,
+		s.ID,
+		s.config.EventTopic,
+		s.config.PublisherCfg,
+		s.storage,
+		s.journal,
+		s.eventChannel,
+		s.processWaitGroup,
+		s.metrics,
+	)
 	s.publisherPool = append(s.publisherPool, publisher)
 }
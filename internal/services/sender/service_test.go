@@ -1 +1,144 @@
 package sender
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/services/collector"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/broker"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/fileserver"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/journal"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/outbox"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/storage"
+)
+
+func TestCheckLoopShouldReturnErrorWhenLoopIsStuck(t *testing.T) {
+	// Arrange
+	sut := &Sender{
+		config:   Config{CollectDelay: 60},
+		lastLoop: time.Now().Add(-3 * time.Minute).UnixNano(),
+	}
+
+	// Action
+	err := sut.CheckLoop(2)
+
+	// Assert
+	assert.True(t, errors.Is(err, ErrLoopStuck))
+}
+
+func TestCheckLoopShouldReturnNilWhenLoopIsRunning(t *testing.T) {
+	// Arrange
+	started := &Sender{
+		config:   Config{CollectDelay: 1},
+		lastLoop: time.Now().Add(-10 * time.Second).UnixNano(),
+	}
+	notStarted := &Sender{}
+
+	// Action
+	startedErr := started.CheckLoop(2)
+	notStartedErr := notStarted.CheckLoop(2)
+
+	// Assert
+	assert.Nil(t, startedErr)
+	assert.Nil(t, notStartedErr)
+}
+
+func TestStopShouldWaitFilesAndEvents(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(folder, "file.json"), []byte("{}"), 0o644))
+
+	fileServer, err := fileserver.NewLocalFileServer(fileserver.Config{})
+	assert.Nil(t, err)
+
+	eventBroker, err := broker.NewMemoryBroker()
+	assert.Nil(t, err)
+
+	memoryStorage := storage.NewMemoryStorage()
+
+	// Arrange
+	sut, err := New(1, Config{
+		EventTopic:   "files",
+		Workers:      1,
+		CollectDelay: 60,
+		CollectorCfg: collector.Config{MatchPatterns: []string{filepath.Join(folder, "*.json")}},
+	}, memoryStorage, fileServer, eventBroker, journal.NewMemoryJournal(), outbox.NewMemoryOutbox())
+	assert.Nil(t, err)
+
+	sut.Start()
+
+	assert.Eventually(t, func() bool { return memoryStorage.FileExists("file.json") }, 5*time.Second, 10*time.Millisecond)
+
+	// Action
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = sut.Stop(ctx)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Len(t, eventBroker.Events["files"], 1)
+}
+
+func TestStopShouldReturnNilWhenSenderIsNotStarted(t *testing.T) {
+	// Arrange
+	sut := &Sender{quit: make(chan struct{})}
+
+	// Action
+	err := sut.Stop(context.Background())
+
+	// Assert
+	assert.Nil(t, err)
+}
+
+func TestReloadShouldApplyConfigOnNextLoop(t *testing.T) {
+	// Prepare
+	folder := t.TempDir()
+
+	fileServer, err := fileserver.NewLocalFileServer(fileserver.Config{})
+	assert.Nil(t, err)
+
+	eventBroker, err := broker.NewMemoryBroker()
+	assert.Nil(t, err)
+
+	cfg := Config{
+		EventTopic:   "files",
+		Workers:      1,
+		CollectDelay: 60,
+		CollectorCfg: collector.Config{MatchPatterns: []string{filepath.Join(folder, "*.json")}},
+	}
+
+	sut, err := New(
+		1, cfg, storage.NewMemoryStorage(), fileServer, eventBroker, journal.NewMemoryJournal(), outbox.NewMemoryOutbox(),
+	)
+	assert.Nil(t, err)
+
+	sut.Start()
+	defer sut.Stop(context.Background())
+
+	// Arrange
+	reloaded := cfg
+	reloaded.Workers = 2
+
+	moved := cfg
+	moved.EventTopic = "other-files"
+
+	// Action
+	err = sut.Reload(reloaded)
+	restartErr := sut.Reload(moved)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(restartErr, ErrRestartRequired))
+	assert.Eventually(t, func() bool {
+		sut.mutex.RLock()
+		defer sut.mutex.RUnlock()
+
+		return len(sut.publisherPool) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
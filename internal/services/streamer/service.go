@@ -1,40 +1,403 @@
 package streamer
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
 	"github.com/uesleicarvalhoo/go-collector-service/internal/services"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
+)
+
+const (
+	// Delay before sending the oldest event of the stream again, after all the attempts failed.
+	redeliveryDelay = 5 * time.Second
+	// Suffix of the outbox stream with the events that exceeded the max age, they aren't sent again.
+	deadLetterSuffix = ":dead-letter"
 )
 
+var ErrEventsAbandoned = errors.New("events not sent to the broker")
+
+// Write the received events at the outbox and send them to the broker in order, an event
+// is removed from the outbox only after the broker accepts it, when its file is recorded as published.
 type Streamer struct {
 	eventChannel chan models.Event
 	broker       services.Broker
-	quit         chan bool
+	outbox       services.Outbox
+	journal      services.Journal
+	stream       string
+	retryPolicy  retry.Policy
+	maxAge       time.Duration
+	metrics      metrics.Sender
+	wake         chan struct{}
+	stopReceive  chan struct{}
+	stopOnce     sync.Once
+	received     chan struct{}
+	quit         chan context.Context
+	done         chan struct{}
+
+	// Context of the sends, canceled when a stop isn't finished before its context is done
+	ctx    context.Context // nolint:containedctx
+	cancel context.CancelFunc
 }
 
-func New(broker services.Broker, eventChannel chan models.Event) (*Streamer, error) {
+func New(
+	broker services.Broker,
+	outbox services.Outbox,
+	journal services.Journal,
+	stream string,
+	eventChannel chan models.Event,
+	retryPolicy retry.Policy,
+	maxAge time.Duration,
+	senderMetrics metrics.Sender,
+) (*Streamer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Streamer{
 		broker:       broker,
+		outbox:       outbox,
+		journal:      journal,
+		stream:       stream,
 		eventChannel: eventChannel,
+		retryPolicy:  retryPolicy,
+		maxAge:       maxAge,
+		metrics:      senderMetrics,
+		wake:         make(chan struct{}, 1),
+		stopReceive:  make(chan struct{}),
+		received:     make(chan struct{}),
+		quit:         make(chan context.Context),
+		done:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
 	}, nil
 }
 
 func (s *Streamer) Start() {
-	go func() {
-		for {
-			select {
-			case <-s.quit:
-				return
-			case event := <-s.eventChannel:
-				logger.Debugf("Event received %+v", event)
-				_ = s.broker.SendEvent(event)
+	s.reportOutbox()
+
+	go s.receive()
+	go s.drain()
+}
+
+// Stop after sending the events already on the channel and at the outbox, returns an error with the
+// number of events that weren't sent when the context is done first. The events left at a durable
+// outbox are sent on the next start. The sends in progress are interrupted when the context is done.
+// It can be called again, e.g. after a stop that timed out.
+func (s *Streamer) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopReceive) })
+
+	select {
+	case <-s.received:
+	case <-ctx.Done():
+		s.cancel()
+
+		return s.abandoned()
+	}
+
+	select {
+	case s.quit <- ctx:
+	case <-s.done:
+	case <-ctx.Done():
+		s.cancel()
+
+		return s.abandoned()
+	}
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+
+	s.cancel()
+
+	return s.abandoned()
+}
+
+// Move the events from the channel to the outbox, until the streamer is stopped.
+func (s *Streamer) receive() {
+	defer close(s.received)
+
+	for {
+		select {
+		case <-s.stopReceive:
+			for {
+				select {
+				case event := <-s.eventChannel:
+					s.store(event)
+				default:
+					return
+				}
+			}
+
+		case event := <-s.eventChannel:
+			logger.Debugf("Event received %+v", event)
+			s.store(event)
+		}
+	}
+}
+
+// Write the event at the outbox, when it fails the event is sent straight to the broker.
+func (s *Streamer) store(event models.Event) {
+	if err := s.outbox.Push(s.stream, event); err != nil {
+		logger.Errorf("Failed to write event %+v at outbox, sending it to the broker, %s", event, err)
+
+		if err := s.sendEvent(s.ctx, event); err != nil {
+			s.metrics.EventDropped(event.Key)
+		}
+
+		return
+	}
+
+	s.reportOutbox()
+	s.wakeDrain()
+}
+
+// Send the events at the outbox without waiting the redelivery delay.
+func (s *Streamer) wakeDrain() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Send the events of the stream in order, the oldest event is retried until the broker accepts it.
+// It returns when the streamer is stopped, the events left are kept at the outbox.
+func (s *Streamer) drain() {
+	defer close(s.done)
+
+	for s.ctx.Err() == nil {
+		delay := redeliveryDelay
+
+		if record, ok := s.outbox.Next(s.stream); ok {
+			if s.sendRecord(s.ctx, record) {
+				continue
+			}
+
+			logger.Warningf("%d events waiting at outbox for '%s', trying again in %s", s.outbox.Len(s.stream), s.stream, delay)
+		}
+
+		// The stream could be shared with another streamer, so its events are also checked periodically.
+		timer := time.NewTimer(delay)
+
+		select {
+		case ctx := <-s.quit:
+			timer.Stop()
+			s.flush(ctx)
+
+			return
+		case <-s.ctx.Done():
+			timer.Stop()
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Send the events left at the outbox, until it is empty, a send fails or the context is done.
+func (s *Streamer) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		record, ok := s.outbox.Next(s.stream)
+		if !ok || !s.sendRecord(ctx, record) {
+			return
+		}
+	}
+}
+
+// Send the record and remove it from the outbox, the record is released when it fails, unless the broker
+// rejected it permanently or it exceeded the max age, then it's moved to the dead-letter stream.
+func (s *Streamer) sendRecord(ctx context.Context, record models.OutboxRecord) bool {
+	if err := s.sendEvent(ctx, record.Event); err != nil {
+		if retry.IsPermanent(err) || (s.maxAge > 0 && time.Since(record.CreatedAt) > s.maxAge) {
+			return s.deadLetter(record, err)
+		}
+
+		s.outbox.Release(record)
+
+		return false
+	}
+
+	return s.ack(record)
+}
+
+// Move the record to the dead-letter stream, so the next events of the stream aren't blocked by it.
+// The events at the dead-letter stream aren't sent again, their files are kept as moved at the journal.
+func (s *Streamer) deadLetter(record models.OutboxRecord, cause error) bool {
+	logger.Errorf(
+		"Event %+v waiting since %s moved to the outbox stream '%s', %s",
+		record.Event, record.CreatedAt.Format(time.RFC3339), s.deadLetterStream(), cause,
+	)
+
+	if err := s.outbox.Push(s.deadLetterStream(), record.Event); err != nil {
+		logger.Errorf("Failed to write event %+v at the outbox stream '%s', %s", record.Event, s.deadLetterStream(), err)
+		s.outbox.Release(record)
+
+		return false
+	}
+
+	if !s.ack(record) {
+		return false
+	}
+
+	s.metrics.EventDropped(record.Event.Key)
+
+	return true
+}
+
+func (s *Streamer) ack(record models.OutboxRecord) bool {
+	if err := s.outbox.Ack(record); err != nil {
+		// The record stays at the outbox and is sent again, the broker may receive it twice.
+		logger.Errorf("Failed to remove event %+v from outbox, %s", record.Event, err)
+		s.outbox.Release(record)
+
+		return false
+	}
+
+	s.reportOutbox()
+
+	return true
+}
+
+func (s *Streamer) sendEvent(ctx context.Context, event models.Event) error {
+	err := s.retryPolicy.Do(ctx, func(attempt int) error {
+		err := s.broker.SendEvent(event)
+		if err != nil && attempt < s.retryPolicy.MaxAttempts {
+			logger.Warningf("Attempt %d/%d to send event %+v failed, %s", attempt, s.retryPolicy.MaxAttempts, event, err)
+		}
+
+		return err
+	})
+	if err != nil {
+		logger.Errorf("Failed to send event %+v, %s", event, err)
+
+		return err
+	}
+
+	s.metrics.EventPublished(event.Key)
+	s.markPublished(event)
+
+	return nil
+}
+
+// Record the file of the event as published, the events of files that weren't moved don't change the journal.
+func (s *Streamer) markPublished(event models.Event) {
+	if event.CorrelationID == "" {
+		return
+	}
+
+	if _, err := s.journal.Advance(event.CorrelationID, models.FileMoved, models.FilePublished); err != nil {
+		logger.Errorf("Failed to record the file of event %+v as published at journal, %s", event, err)
+	}
+}
+
+// Check if the event of the file with the journal id is waiting at the outbox, or at its dead-letter stream.
+func (s *Streamer) Queued(journalID string) bool {
+	for _, stream := range []string{s.stream, s.deadLetterStream()} {
+		for _, record := range s.outbox.Records(stream) {
+			if record.Event.CorrelationID == journalID {
+				return true
 			}
 		}
-	}()
+	}
+
+	return false
+}
+
+func (s *Streamer) deadLetterStream() string {
+	return s.stream + deadLetterSuffix
+}
+
+func (s *Streamer) reportOutbox() {
+	s.metrics.OutboxSize(s.outbox.Len(s.stream))
+	s.metrics.DeadLetterSize(s.outbox.Len(s.deadLetterStream()))
 }
 
-func (s *Streamer) Stop() {
-	go func() {
-		s.quit <- true
-	}()
+// Move the events of the dead-letter stream back to the end of the stream, so they are sent again.
+// The max age of each event starts over, returns how many events were moved.
+func (s *Streamer) ReplayDeadLetters() (int, error) {
+	return s.drainDeadLetters(func(record models.OutboxRecord) error {
+		if err := s.outbox.Push(s.stream, record.Event); err != nil {
+			s.outbox.Release(record)
+
+			return err
+		}
+
+		// The event is already back at the stream, when the ack fails the broker may receive it twice.
+		if err := s.outbox.Ack(record); err != nil {
+			s.outbox.Release(record)
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Remove the events of the dead-letter stream, their files are recorded as failed at the journal,
+// so their events aren't resumed on the next start. Returns how many events were removed.
+func (s *Streamer) DiscardDeadLetters() (int, error) {
+	return s.drainDeadLetters(func(record models.OutboxRecord) error {
+		if err := s.outbox.Ack(record); err != nil {
+			s.outbox.Release(record)
+
+			return err
+		}
+
+		if record.Event.CorrelationID == "" {
+			return nil
+		}
+
+		if _, err := s.journal.Advance(record.Event.CorrelationID, models.FileMoved, models.FileFailed); err != nil {
+			logger.Errorf("Failed to record the file of event %+v as failed at journal, %s", record.Event, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *Streamer) drainDeadLetters(fn func(models.OutboxRecord) error) (int, error) {
+	defer s.reportOutbox()
+
+	count := 0
+
+	for {
+		record, ok := s.outbox.Next(s.deadLetterStream())
+		if !ok {
+			break
+		}
+
+		if err := fn(record); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	s.wakeDrain()
+
+	return count, nil
+}
+
+// Error with the events not sent, the ones kept at a durable outbox aren't lost.
+func (s *Streamer) abandoned() error {
+	abandoned := len(s.eventChannel)
+
+	if pending := s.outbox.Len(s.stream); pending > 0 {
+		if s.outbox.Durable() {
+			logger.Warningf("%d events kept at outbox for '%s', they are sent on the next start", pending, s.stream)
+		} else {
+			abandoned += pending
+		}
+	}
+
+	if abandoned > 0 {
+		return fmt.Errorf("%w: %d events", ErrEventsAbandoned, abandoned)
+	}
+
+	return nil
 }
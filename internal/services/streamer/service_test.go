@@ -1 +1,377 @@
 package streamer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/journal"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/metrics"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/outbox"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
+)
+
+type flakyBroker struct {
+	sync.Mutex
+	failures int
+	events   []models.Event
+}
+
+func (fb *flakyBroker) SendEvent(event models.Event) error {
+	fb.Lock()
+	defer fb.Unlock()
+
+	if fb.failures > 0 {
+		fb.failures--
+
+		return errors.New("broker unavailable")
+	}
+
+	fb.events = append(fb.events, event)
+
+	return nil
+}
+
+func TestSendEventShouldRetryWhenBrokerFails(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{failures: 2}
+
+	// Arrange
+	sut, err := New(broker, outbox.NewMemoryOutbox(), journal.NewMemoryJournal(), "files", make(chan models.Event), retry.Policy{MaxAttempts: 3}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	// Action
+	err = sut.sendEvent(context.TODO(), event)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Event{event}, broker.events)
+}
+
+func TestStopShouldFlushPendingEvents(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{}
+	eventChannel := make(chan models.Event, 3)
+
+	// Arrange
+	sut, err := New(broker, outbox.NewMemoryOutbox(), journal.NewMemoryJournal(), "files", eventChannel, retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	eventChannel <- event
+	eventChannel <- event
+
+	sut.Start()
+
+	// Action
+	err = sut.Stop(context.Background())
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Len(t, broker.events, 2)
+	assert.Len(t, eventChannel, 0)
+}
+
+func TestStopShouldReturnWhenCalledAgain(t *testing.T) {
+	// Arrange
+	sut, err := New(&flakyBroker{}, outbox.NewMemoryOutbox(), journal.NewMemoryJournal(), "files", make(chan models.Event, 1), retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	sut.Start()
+	assert.Nil(t, sut.Stop(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Action
+	err = sut.Stop(ctx)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.Err())
+}
+
+func TestStopShouldInterruptSendsWhenContextIsDone(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{failures: 100}
+	eventChannel := make(chan models.Event, 1)
+
+	// Arrange
+	sut, err := New(broker, outbox.NewMemoryOutbox(), journal.NewMemoryJournal(), "files", eventChannel, retry.Policy{MaxAttempts: 10, BaseBackoff: time.Hour}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	sut.Start()
+	eventChannel <- event
+
+	assert.Eventually(t, func() bool {
+		broker.Lock()
+		defer broker.Unlock()
+
+		return broker.failures < 100
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Action
+	err = sut.Stop(ctx)
+
+	// Assert
+	assert.True(t, errors.Is(err, ErrEventsAbandoned))
+
+	select {
+	case <-sut.done:
+	case <-time.After(time.Second):
+		t.Fatal("the drain didn't return after the stop timed out")
+	}
+}
+
+func TestStopShouldReturnErrorWhenEventsAreAbandoned(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{failures: 1}
+	eventChannel := make(chan models.Event, 1)
+
+	// Arrange
+	sut, err := New(broker, outbox.NewMemoryOutbox(), journal.NewMemoryJournal(), "files", eventChannel, retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	eventChannel <- event
+
+	// Action
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err = sut.Stop(ctx)
+
+	// Assert
+	assert.True(t, errors.Is(err, ErrEventsAbandoned))
+	assert.Contains(t, err.Error(), "1 events")
+}
+
+func TestStopShouldKeepEventsAtDurableOutboxWhenBrokerFails(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	broker := &flakyBroker{failures: 10}
+	eventChannel := make(chan models.Event, 1)
+
+	fileOutbox, err := outbox.NewFileOutbox(outbox.Config{Enabled: true, Directory: dir})
+	assert.Nil(t, err)
+
+	// Arrange
+	sut, err := New(broker, fileOutbox, journal.NewMemoryJournal(), "files", eventChannel, retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	eventChannel <- event
+
+	sut.Start()
+
+	// Action
+	err = sut.Stop(context.Background())
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Nil(t, fileOutbox.Close())
+
+	reopened, err := outbox.NewFileOutbox(outbox.Config{Enabled: true, Directory: dir})
+	assert.Nil(t, err)
+	defer reopened.Close()
+
+	assert.Equal(t, 1, reopened.Len("files"))
+}
+
+func TestStartShouldSendEventsLeftAtOutboxInOrder(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{}
+	memoryOutbox := outbox.NewMemoryOutbox()
+
+	first, err := models.NewEvent("files", "success", map[string]string{"file": "first"})
+	assert.Nil(t, err)
+
+	second, err := models.NewEvent("files", "success", map[string]string{"file": "second"})
+	assert.Nil(t, err)
+
+	assert.Nil(t, memoryOutbox.Push("files", first))
+	assert.Nil(t, memoryOutbox.Push("files", second))
+	assert.Nil(t, memoryOutbox.Push("other", second))
+
+	// Arrange
+	sut, err := New(broker, memoryOutbox, journal.NewMemoryJournal(), "files", make(chan models.Event), retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	// Action
+	sut.Start()
+	err = sut.Stop(context.Background())
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Event{first, second}, broker.events)
+	assert.Equal(t, 0, memoryOutbox.Len("files"))
+	assert.Equal(t, 1, memoryOutbox.Len("other"))
+}
+
+func TestSendEventShouldRecordFileAsPublished(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{failures: 1}
+	memoryJournal := journal.NewMemoryJournal()
+	info := models.FileInfo{Name: "moved.json", FilePath: "/data/moved.json", Key: "moved.json", Size: 1}
+
+	assert.Nil(t, memoryJournal.Record(models.NewJournalEntry(info, "files", models.FileMoved)))
+
+	// Arrange
+	sut, err := New(broker, outbox.NewMemoryOutbox(), memoryJournal, "files", make(chan models.Event), retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	event.CorrelationID = models.JournalID(info)
+
+	// Action
+	failedErr := sut.sendEvent(context.TODO(), event)
+	failedEntry, _ := memoryJournal.Get(info)
+
+	err = sut.sendEvent(context.TODO(), event)
+
+	// Assert
+	assert.NotNil(t, failedErr)
+	assert.Equal(t, models.FileMoved, failedEntry.State)
+
+	assert.Nil(t, err)
+
+	entry, _ := memoryJournal.Get(info)
+	assert.Equal(t, models.FilePublished, entry.State)
+}
+
+func TestSendRecordShouldMoveExpiredEventToDeadLetterStream(t *testing.T) {
+	// Prepare
+	broker := &flakyBroker{failures: 1}
+	memoryOutbox := outbox.NewMemoryOutbox()
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+	event.CorrelationID = "file.json"
+
+	assert.Nil(t, memoryOutbox.Push("files", event))
+
+	// Arrange
+	sut, err := New(broker, memoryOutbox, journal.NewMemoryJournal(), "files", make(chan models.Event), retry.Policy{}, time.Nanosecond, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	record, ok := memoryOutbox.Next("files")
+	assert.True(t, ok)
+
+	// Action
+	sent := sut.sendRecord(context.Background(), record)
+
+	// Assert
+	assert.True(t, sent)
+	assert.Equal(t, 0, memoryOutbox.Len("files"))
+	assert.Len(t, memoryOutbox.Records("files:dead-letter"), 1)
+	assert.True(t, sut.Queued("file.json"))
+	assert.Empty(t, broker.events)
+}
+
+type rejectingBroker struct{}
+
+func (rb rejectingBroker) SendEvent(event models.Event) error {
+	return retry.Permanent(errors.New("event unroutable"))
+}
+
+func TestSendRecordShouldMoveRejectedEventToDeadLetterStream(t *testing.T) {
+	// Prepare
+	memoryOutbox := outbox.NewMemoryOutbox()
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, memoryOutbox.Push("files", event))
+
+	// Arrange
+	sut, err := New(rejectingBroker{}, memoryOutbox, journal.NewMemoryJournal(), "files", make(chan models.Event), retry.Policy{MaxAttempts: 3, BaseBackoff: time.Hour}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	record, ok := memoryOutbox.Next("files")
+	assert.True(t, ok)
+
+	// Action
+	sent := sut.sendRecord(context.Background(), record)
+
+	// Assert
+	assert.True(t, sent)
+	assert.Equal(t, 0, memoryOutbox.Len("files"))
+	assert.Len(t, memoryOutbox.Records("files:dead-letter"), 1)
+}
+
+func TestReplayDeadLettersShouldMoveEventsBackToStream(t *testing.T) {
+	// Prepare
+	memoryOutbox := outbox.NewMemoryOutbox()
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, memoryOutbox.Push("files", event))
+	assert.Nil(t, memoryOutbox.Push("files:dead-letter", event))
+
+	// Arrange
+	sut, err := New(&flakyBroker{}, memoryOutbox, journal.NewMemoryJournal(), "files", make(chan models.Event), retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	// Action
+	count, err := sut.ReplayDeadLetters()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 2, memoryOutbox.Len("files"))
+	assert.Equal(t, 0, memoryOutbox.Len("files:dead-letter"))
+}
+
+func TestDiscardDeadLettersShouldRecordFilesAsFailed(t *testing.T) {
+	// Prepare
+	info := models.FileInfo{Name: "file.json", FilePath: "/data/file.json", Key: "file.json", Size: 1}
+	entry := models.NewJournalEntry(info, "files", models.FileMoved)
+
+	memoryJournal := journal.NewMemoryJournal()
+	assert.Nil(t, memoryJournal.Record(entry))
+
+	event, err := models.NewEvent("files", "success", nil)
+	assert.Nil(t, err)
+	event.CorrelationID = entry.ID()
+
+	memoryOutbox := outbox.NewMemoryOutbox()
+	assert.Nil(t, memoryOutbox.Push("files:dead-letter", event))
+
+	// Arrange
+	sut, err := New(&flakyBroker{}, memoryOutbox, memoryJournal, "files", make(chan models.Event), retry.Policy{}, time.Hour, metrics.NewSender(1, "files"))
+	assert.Nil(t, err)
+
+	// Action
+	count, err := sut.DiscardDeadLetters()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0, memoryOutbox.Len("files:dead-letter"))
+	assert.False(t, sut.Queued(entry.ID()))
+
+	discarded, _ := memoryJournal.Get(info)
+	assert.Equal(t, models.FileFailed, discarded.State)
+}
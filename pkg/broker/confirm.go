@@ -0,0 +1,178 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// Outcome of a published message, returned is set when the broker couldn't route it.
+type confirmation struct {
+	ack      bool
+	returned *amqp.Return
+}
+
+// Match the broker confirmations and returns of a channel in confirm mode with the published messages.
+// The delivery tags follow the publish order, so the messages must be published while holding the lock.
+// The returned messages don't have a delivery tag, they are matched by the message id.
+type confirmer struct {
+	sync.Mutex
+	nextTag  uint64
+	pending  map[uint64]chan confirmation
+	returned map[uint64]amqp.Return
+	tags     map[string]uint64
+	closed   bool
+}
+
+func newConfirmer(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) *confirmer {
+	c := &confirmer{
+		pending:  make(map[uint64]chan confirmation),
+		returned: make(map[uint64]amqp.Return),
+		tags:     make(map[string]uint64),
+	}
+
+	go c.listen(confirms, returns)
+
+	return c
+}
+
+// Reserve the delivery tag of the next published message, the channel is closed without a value
+// when the amqp channel is closed before the broker confirms the message.
+func (c *confirmer) expect(messageID string) (uint64, <-chan confirmation) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.nextTag++
+	wait := make(chan confirmation, 1)
+
+	if c.closed {
+		close(wait)
+
+		return c.nextTag, wait
+	}
+
+	c.pending[c.nextTag] = wait
+	c.tags[messageID] = c.nextTag
+
+	return c.nextTag, wait
+}
+
+// Release the tag of a message that was not published, must be called before publishing another message.
+func (c *confirmer) cancel(tag uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.remove(tag)
+
+	if tag == c.nextTag {
+		c.nextTag--
+	}
+}
+
+// Stop waiting for the confirmation of a message, a late confirmation is discarded.
+func (c *confirmer) forget(tag uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.remove(tag)
+}
+
+// Must be called with the lock held.
+func (c *confirmer) remove(tag uint64) {
+	delete(c.pending, tag)
+	delete(c.returned, tag)
+
+	for messageID, messageTag := range c.tags {
+		if messageTag == tag {
+			delete(c.tags, messageID)
+		}
+	}
+}
+
+func (c *confirmer) isClosed() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.closed
+}
+
+func (c *confirmer) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	defer c.close()
+
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+
+				continue
+			}
+
+			c.onReturn(ret)
+
+		case confirm, ok := <-confirms:
+			if !ok {
+				return
+			}
+
+			// The broker sends the return before the confirmation of the same message.
+			c.drainReturns(returns)
+			c.onConfirm(confirm)
+		}
+	}
+}
+
+func (c *confirmer) drainReturns(returns <-chan amqp.Return) {
+	for returns != nil {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+
+			c.onReturn(ret)
+		default:
+			return
+		}
+	}
+}
+
+func (c *confirmer) onReturn(ret amqp.Return) {
+	c.Lock()
+	defer c.Unlock()
+
+	if tag, ok := c.tags[ret.MessageId]; ok {
+		c.returned[tag] = ret
+	}
+}
+
+func (c *confirmer) onConfirm(confirm amqp.Confirmation) {
+	c.Lock()
+	defer c.Unlock()
+
+	wait, ok := c.pending[confirm.DeliveryTag]
+	if !ok {
+		return
+	}
+
+	result := confirmation{ack: confirm.Ack}
+	if ret, returned := c.returned[confirm.DeliveryTag]; returned {
+		result.returned = &ret
+	}
+
+	c.remove(confirm.DeliveryTag)
+
+	wait <- result
+}
+
+func (c *confirmer) close() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.closed = true
+
+	for tag, wait := range c.pending {
+		close(wait)
+		delete(c.pending, tag)
+	}
+}
@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmerShouldMatchConfirmationsByDeliveryTag(t *testing.T) {
+	// Prepare
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return)
+
+	// Arrange
+	sut := newConfirmer(confirms, returns)
+
+	firstTag, first := sut.expect("first")
+	secondTag, second := sut.expect("second")
+
+	// Action
+	confirms <- amqp.Confirmation{DeliveryTag: firstTag, Ack: true}
+	confirms <- amqp.Confirmation{DeliveryTag: secondTag, Ack: false}
+
+	// Assert
+	assert.Equal(t, confirmation{ack: true}, <-first)
+	assert.Equal(t, confirmation{ack: false}, <-second)
+}
+
+func TestConfirmerShouldFlagReturnedMessages(t *testing.T) {
+	// Prepare
+	confirms := make(chan amqp.Confirmation, 1)
+	returns := make(chan amqp.Return, 1)
+
+	// Arrange
+	sut := newConfirmer(confirms, returns)
+
+	tag, wait := sut.expect("a1b2")
+
+	// Action
+	returns <- amqp.Return{MessageId: "a1b2", ReplyCode: 312, ReplyText: "NO_ROUTE"}
+	confirms <- amqp.Confirmation{DeliveryTag: tag, Ack: true}
+
+	// Assert
+	result := <-wait
+	assert.True(t, result.ack)
+	assert.NotNil(t, result.returned)
+	assert.Equal(t, "NO_ROUTE", result.returned.ReplyText)
+}
+
+func TestConfirmerShouldReuseTagOfCanceledMessage(t *testing.T) {
+	// Arrange
+	sut := newConfirmer(make(chan amqp.Confirmation), make(chan amqp.Return))
+
+	tag, _ := sut.expect("first")
+
+	// Action
+	sut.cancel(tag)
+	nextTag, _ := sut.expect("second")
+
+	// Assert
+	assert.Equal(t, tag, nextTag)
+}
+
+func TestConfirmerShouldReleasePendingWhenChannelIsClosed(t *testing.T) {
+	// Prepare
+	confirms := make(chan amqp.Confirmation)
+
+	// Arrange
+	sut := newConfirmer(confirms, make(chan amqp.Return))
+
+	_, wait := sut.expect("first")
+
+	// Action
+	close(confirms)
+
+	// Assert
+	_, ok := <-wait
+	assert.False(t, ok)
+}
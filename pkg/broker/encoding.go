@@ -0,0 +1,158 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Formats of the sent messages.
+const (
+	// Only the event data as JSON
+	FormatJSON = "json"
+	// CloudEvents 1.0 envelope as JSON, with the event data at the data attribute
+	FormatCloudEventsStructured = "cloudevents-structured"
+	// Event data as JSON, with the CloudEvents 1.0 attributes as message headers
+	FormatCloudEventsBinary = "cloudevents-binary"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsTypePrefix  = "collector.file."
+	defaultEventSource     = "/collector"
+
+	contentTypeJSON        = "application/json"
+	contentTypeCloudEvents = "application/cloudevents+json; charset=UTF-8"
+)
+
+var ErrUnknownEventFormat = errors.New("unknown event format")
+
+// Encoded event, the CloudEvents attributes are only set by the binary mode.
+type message struct {
+	ID            string
+	CorrelationID string
+	Time          time.Time
+	Body          []byte
+	ContentType   string
+	Attributes    map[string]string
+	Headers       map[string]string
+}
+
+// CloudEvents attributes of the structured mode.
+type cloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject,omitempty"`
+	Time            string `json:"time,omitempty"`
+	DataContentType string `json:"datacontenttype"`
+	Data            any    `json:"data"`
+}
+
+// Check the format, an empty format is the same as json.
+func validateFormat(format string) error {
+	switch normalizeFormat(format) {
+	case FormatJSON, FormatCloudEventsStructured, FormatCloudEventsBinary:
+		return nil
+	default:
+		return errors.Wrapf(ErrUnknownEventFormat, "'%s'", format)
+	}
+}
+
+func normalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		return FormatJSON
+	}
+
+	return format
+}
+
+// Encode the event in the format, the binary mode attributes are named with the prefix.
+func encodeEvent(event Event, format, headerPrefix string) (message, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return message{}, fmt.Errorf("couldn't encode event data, %w", err)
+	}
+
+	ce := newCloudEvent(event, nil)
+	msg := message{
+		ID:            ce.ID,
+		CorrelationID: event.CorrelationID,
+		Time:          event.Time,
+		Body:          data,
+		ContentType:   contentTypeJSON,
+		Headers:       event.Headers,
+	}
+
+	switch normalizeFormat(format) {
+	case FormatCloudEventsStructured:
+		ce.Data = json.RawMessage(data)
+
+		if msg.Body, err = json.Marshal(ce); err != nil {
+			return message{}, err
+		}
+
+		msg.ContentType = contentTypeCloudEvents
+
+	case FormatCloudEventsBinary:
+		msg.Attributes = map[string]string{
+			headerPrefix + "specversion": ce.SpecVersion,
+			headerPrefix + "id":          ce.ID,
+			headerPrefix + "source":      ce.Source,
+			headerPrefix + "type":        ce.Type,
+		}
+
+		if ce.Subject != "" {
+			msg.Attributes[headerPrefix+"subject"] = ce.Subject
+		}
+
+		if ce.Time != "" {
+			msg.Attributes[headerPrefix+"time"] = ce.Time
+		}
+
+	case FormatJSON:
+		// The data is sent as it is.
+
+	default:
+		return message{}, errors.Wrapf(ErrUnknownEventFormat, "'%s'", format)
+	}
+
+	if msg.Time.IsZero() {
+		msg.Time = time.Now().UTC()
+	}
+
+	return msg, nil
+}
+
+// Events recovered from old outbox records don't have an id, a new one is generated for each attempt.
+func newCloudEvent(event Event, data any) cloudEvent {
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              event.ID,
+		Source:          event.Source,
+		Type:            cloudEventsTypePrefix + event.Key,
+		Subject:         event.Subject,
+		DataContentType: contentTypeJSON,
+		Data:            data,
+	}
+
+	if ce.ID == "" {
+		ce.ID = uuid.NewString()
+	}
+
+	if ce.Source == "" {
+		ce.Source = defaultEventSource
+	}
+
+	if !event.Time.IsZero() {
+		ce.Time = event.Time.UTC().Format(time.RFC3339Nano)
+	}
+
+	return ce
+}
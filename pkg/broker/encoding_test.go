@@ -0,0 +1,148 @@
+package broker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEvent() Event {
+	return Event{
+		ID:      "a1b2",
+		Topic:   "files",
+		Key:     "success",
+		Source:  "/collector/host/senders/1",
+		Subject: "domain_1/file.json",
+		Time:    time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC),
+		Data:    map[string]string{"file_key": "domain_1/file.json"},
+
+		CorrelationID: "/data/file.json:10:0",
+		Headers:       map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+}
+
+func TestEncodeEventShouldSendOnlyDataWhenFormatIsJSON(t *testing.T) {
+	// Action
+	msg, err := encodeEvent(newTestEvent(), "", amqpHeaderPrefix)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"file_key":"domain_1/file.json"}`, string(msg.Body))
+	assert.Equal(t, contentTypeJSON, msg.ContentType)
+	assert.Empty(t, msg.Attributes)
+}
+
+func TestEncodeEventShouldWrapDataWhenFormatIsStructured(t *testing.T) {
+	// Action
+	msg, err := encodeEvent(newTestEvent(), FormatCloudEventsStructured, amqpHeaderPrefix)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, contentTypeCloudEvents, msg.ContentType)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "a1b2",
+		"source": "/collector/host/senders/1",
+		"type": "collector.file.success",
+		"subject": "domain_1/file.json",
+		"time": "2022-05-01T10:00:00Z",
+		"datacontenttype": "application/json",
+		"data": {"file_key": "domain_1/file.json"}
+	}`, string(msg.Body))
+}
+
+func TestEncodeEventShouldSendAttributesAsHeadersWhenFormatIsBinary(t *testing.T) {
+	// Action
+	msg, err := encodeEvent(newTestEvent(), FormatCloudEventsBinary, sqsAttributePrefix)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"file_key":"domain_1/file.json"}`, string(msg.Body))
+	assert.Equal(t, map[string]string{
+		"ce_specversion": "1.0",
+		"ce_id":          "a1b2",
+		"ce_source":      "/collector/host/senders/1",
+		"ce_type":        "collector.file.success",
+		"ce_subject":     "domain_1/file.json",
+		"ce_time":        "2022-05-01T10:00:00Z",
+	}, msg.Attributes)
+}
+
+func TestEncodeEventShouldGenerateIDWhenEventDoesNotHaveOne(t *testing.T) {
+	// Prepare
+	event := newTestEvent()
+	event.ID = ""
+
+	// Action
+	msg, err := encodeEvent(event, FormatCloudEventsStructured, amqpHeaderPrefix)
+	assert.Nil(t, err)
+
+	// Assert
+	var ce cloudEvent
+	assert.Nil(t, json.Unmarshal(msg.Body, &ce))
+	assert.NotEmpty(t, ce.ID)
+}
+
+func TestValidateFormatShouldReturnErrorWhenFormatIsUnknown(t *testing.T) {
+	// Action
+	err := validateFormat("xml")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrUnknownEventFormat)
+}
+
+func TestAMQPHeadersShouldKeepAttributesWhenNamesClash(t *testing.T) {
+	// Prepare
+	event := newTestEvent()
+	event.Headers["cloudEvents:id"] = "other"
+
+	msg, err := encodeEvent(event, FormatCloudEventsBinary, amqpHeaderPrefix)
+	assert.Nil(t, err)
+
+	// Action
+	headers := amqpHeaders(msg)
+
+	// Assert
+	assert.Equal(t, "a1b2", headers["cloudEvents:id"])
+	assert.Equal(t, event.Headers["traceparent"], headers["traceparent"])
+}
+
+func TestSQSAttributesShouldMapMessageProperties(t *testing.T) {
+	// Prepare
+	msg, err := encodeEvent(newTestEvent(), FormatJSON, sqsAttributePrefix)
+	assert.Nil(t, err)
+
+	// Action
+	attributes := sqsAttributes(msg)
+
+	// Assert
+	assert.Equal(t, "application/json", *attributes["content-type"].StringValue)
+	assert.Equal(t, "a1b2", *attributes["message-id"].StringValue)
+	assert.Equal(t, "2022-05-01T10:00:00Z", *attributes["timestamp"].StringValue)
+	assert.Equal(t, "/data/file.json:10:0", *attributes["correlation-id"].StringValue)
+	assert.Equal(t, "String", *attributes["traceparent"].DataType)
+}
+
+func TestSQSAttributesShouldDiscardHeadersExceedingLimit(t *testing.T) {
+	// Prepare
+	event := newTestEvent()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		event.Headers[name] = name
+	}
+
+	msg, err := encodeEvent(event, FormatCloudEventsBinary, sqsAttributePrefix)
+	assert.Nil(t, err)
+
+	// Action
+	attributes := sqsAttributes(msg)
+
+	// Assert
+	assert.Len(t, attributes, sqsMaxAttributes)
+	assert.Contains(t, attributes, "ce_id")
+	assert.Contains(t, attributes, "correlation-id")
+	assert.Contains(t, attributes, "traceparent")
+	assert.Contains(t, attributes, "a")
+	assert.NotContains(t, attributes, "b")
+}
@@ -0,0 +1,59 @@
+package broker
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownBrokerType = errors.New("unknown broker type")
+
+type Client interface {
+	SendEvent(Event) error
+	HealthCheck(context.Context) error
+	Close()
+}
+
+type Factory func(cfg Config) (Client, error)
+
+// Registered broker factories, indexed by the BROKER_TYPE value.
+var (
+	factoriesMu sync.RWMutex          // nolint:gochecknoglobals
+	factories   = map[string]Factory{ // nolint:gochecknoglobals
+		"rabbitmq": func(cfg Config) (Client, error) {
+			return NewRabbitMqClient(cfg)
+		},
+		"sqs": func(cfg Config) (Client, error) {
+			return NewSQSClient(cfg, cfg.Region)
+		},
+		"memory": func(cfg Config) (Client, error) {
+			return NewMemoryBroker()
+		},
+		"none": func(cfg Config) (Client, error) {
+			return NewNoneBroker(), nil
+		},
+	}
+)
+
+// Register a new broker factory, an existing factory with the same name is replaced.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	factories[strings.ToLower(name)] = factory
+}
+
+// Create the broker client configured by cfg.Type.
+func New(cfg Config) (Client, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[strings.ToLower(strings.TrimSpace(cfg.Type))]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownBrokerType, "'%s'", cfg.Type)
+	}
+
+	return factory(cfg)
+}
@@ -0,0 +1,30 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewShouldReturnMemoryBrokerWhenTypeIsMemory(t *testing.T) {
+	// Arrange
+	cfg := Config{Type: "memory"}
+
+	// Action
+	client, err := New(cfg)
+	assert.Nil(t, err)
+
+	// Assert
+	assert.IsType(t, &MemoryBroker{}, client)
+}
+
+func TestNewShouldReturnErrorWhenTypeIsUnknown(t *testing.T) {
+	// Arrange
+	cfg := Config{Type: "unknown"}
+
+	// Action
+	_, err := New(cfg)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrUnknownBrokerType)
+}
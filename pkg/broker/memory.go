@@ -1,5 +1,7 @@
 package broker
 
+import "context"
+
 type MemoryBroker struct {
 	Events map[string][]Event
 }
@@ -19,3 +21,11 @@ func (mb *MemoryBroker) SendEvent(event Event) error {
 
 	return nil
 }
+
+func (mb *MemoryBroker) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Don't do anything, just keep compatibility.
+func (mb *MemoryBroker) Close() {
+}
@@ -1,6 +1,8 @@
 package broker
 
 import (
+	"context"
+
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
 )
 
@@ -21,3 +23,7 @@ func (n *NoneBroker) SendEvent(event Event) error {
 
 	return nil
 }
+
+func (n *NoneBroker) HealthCheck(ctx context.Context) error {
+	return nil
+}
@@ -1,29 +1,46 @@
 package broker
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/streadway/amqp"
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
 )
 
 const (
-	maxConnectionRetries = 5
-	retryConnectionDelay = 1
+	maxConnectionRetries  = 5
+	retryConnectionDelay  = 1
+	defaultConfirmTimeout = 5 * time.Second
+	// Prefix of the CloudEvents attributes on the binary mode, as the AMQP binding
+	amqpHeaderPrefix = "cloudEvents:"
+)
+
+var (
+	ErrEventNacked     = errors.New("event nacked by the broker")
+	ErrEventUnroutable = errors.New("event unroutable")
+	ErrConfirmTimeout  = errors.New("timeout waiting for the broker confirmation")
 )
 
 type RabbitMQClient struct {
+	sync.Mutex
 	cfg        Config
 	connection *amqp.Connection
 	channel    *amqp.Channel
+	confirmer  *confirmer
 	errChannel chan *amqp.Error
 }
 
 func NewRabbitMqClient(cfg Config) (*RabbitMQClient, error) {
+	if err := validateFormat(cfg.EventFormat); err != nil {
+		return nil, err
+	}
+
 	client := &RabbitMQClient{
 		cfg:        cfg,
 		errChannel: make(chan *amqp.Error, 1),
@@ -37,80 +54,202 @@ func NewRabbitMqClient(cfg Config) (*RabbitMQClient, error) {
 }
 
 func (mq *RabbitMQClient) Close() {
-	mq.channel.Close()
+	mq.Lock()
+	defer mq.Unlock()
+
+	if mq.channel != nil {
+		mq.channel.Close()
+	}
+
 	mq.connection.Close()
 }
 
-func (mq *RabbitMQClient) SendEvent(event Event) error {
-	if err := mq.connect(); err != nil {
+// Publish the event as a mandatory message and wait for the broker confirmation, an error is returned
+// when the broker nacks the message, can't route it to any queue or doesn't confirm it in time.
+// The unroutable events fail again until the bindings change, so the error is permanent and isn't retried.
+func (mq *RabbitMQClient) SendEvent(event Event) (err error) {
+	event, endSpan := startPublishSpan(event, "rabbitmq.publish")
+	defer func() { endSpan(err) }()
+
+	msg, err := encodeEvent(event, mq.cfg.EventFormat, amqpHeaderPrefix)
+	if err != nil {
+		logger.Errorf("Couldn't encode event: %s", err)
+
 		return err
 	}
 
-	body, err := json.Marshal(event.Data)
+	confirmer, tag, wait, err := mq.publish(event, msg)
 	if err != nil {
-		logger.Errorf("Couldn't decode event data: %s", err)
+		if !errors.Is(err, amqp.ErrClosed) {
+			logger.Errorf("Failed to publish event, %s", err)
 
-		return err
+			return err
+		}
+
+		logger.Warningf("[RabbitMQ] Connection error, retrying to send event %+v", event)
+
+		if confirmer, tag, wait, err = mq.publish(event, msg); err != nil {
+			logger.Errorf("Failed to publish event, %s", err)
+
+			return err
+		}
 	}
 
-	err = mq.channel.Publish(event.Topic, event.Key, false, false, amqp.Publishing{
-		Body: body,
+	timer := time.NewTimer(mq.confirmTimeout())
+	defer timer.Stop()
+
+	select {
+	case result, ok := <-wait:
+		if !ok {
+			return fmt.Errorf("event not confirmed, %w", amqp.ErrClosed)
+		}
+
+		if result.returned != nil {
+			logger.Warningf("[RabbitMQ] Event returned by the broker, %s (%d), exchange '%s', key '%s'",
+				result.returned.ReplyText, result.returned.ReplyCode, event.Topic, event.Key)
+
+			return retry.Permanent(fmt.Errorf("%w, exchange '%s', key '%s': %s",
+				ErrEventUnroutable, event.Topic, event.Key, result.returned.ReplyText))
+		}
+
+		if !result.ack {
+			return fmt.Errorf("%w, exchange '%s', key '%s'", ErrEventNacked, event.Topic, event.Key)
+		}
+
+		return nil
+
+	case <-timer.C:
+		confirmer.forget(tag)
+
+		return fmt.Errorf("%w, exchange '%s', key '%s'", ErrConfirmTimeout, event.Topic, event.Key)
+	}
+}
+
+// Publish the message holding the lock, so the delivery tags follow the publish order.
+func (mq *RabbitMQClient) publish(event Event, msg message) (*confirmer, uint64, <-chan confirmation, error) {
+	mq.Lock()
+	defer mq.Unlock()
+
+	if err := mq.connect(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	confirmer := mq.confirmer
+	tag, wait := confirmer.expect(msg.ID)
+
+	err := mq.channel.Publish(event.Topic, event.Key, true, false, amqp.Publishing{
+		MessageId:     msg.ID,
+		CorrelationId: msg.CorrelationID,
+		Timestamp:     msg.Time,
+		Type:          event.Key,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		Headers:       amqpHeaders(msg),
+		Body:          msg.Body,
 	})
 	if err != nil {
+		confirmer.cancel(tag)
+
 		if errors.Is(err, amqp.ErrClosed) {
-			logger.Warningf("[RabbitMQ] Connection error, retrying to send event %+v", event)
+			mq.channel = nil
+		}
 
-			if retryErr := mq.SendEvent(event); retryErr != nil {
-				return retryErr
-			}
+		return nil, 0, nil, err
+	}
 
-			return nil
-		}
+	return confirmer, tag, wait, nil
+}
 
-		logger.Errorf("Failed to publish event, %s", err)
+// The event headers and the CloudEvents attributes, the attributes are kept when the names clash.
+func amqpHeaders(msg message) amqp.Table {
+	if len(msg.Headers) == 0 && len(msg.Attributes) == 0 {
+		return nil
+	}
 
-		return err
+	table := amqp.Table{}
+
+	for name, value := range msg.Headers {
+		table[name] = value
+	}
+
+	for name, value := range msg.Attributes {
+		table[name] = value
+	}
+
+	return table
+}
+
+func (mq *RabbitMQClient) confirmTimeout() time.Duration {
+	if mq.cfg.ConfirmTimeout <= 0 {
+		return defaultConfirmTimeout
+	}
+
+	return mq.cfg.ConfirmTimeout
+}
+
+// Check if the connection is open, a closed connection is being re-established.
+func (mq *RabbitMQClient) HealthCheck(ctx context.Context) error {
+	mq.Lock()
+	defer mq.Unlock()
+
+	if mq.connection == nil || mq.connection.IsClosed() {
+		return amqp.ErrClosed
 	}
 
 	return nil
 }
 
+// Open the connection and a channel in confirm mode, an open connection is reused when only the channel was closed.
 func (mq *RabbitMQClient) connect() error {
-	if mq.connection != nil && !mq.connection.IsClosed() {
-		return nil
+	if mq.connection == nil || mq.connection.IsClosed() {
+		uri := fmt.Sprintf("amqp://%s:%s@%s", mq.cfg.User, mq.cfg.Password, net.JoinHostPort(mq.cfg.Host, mq.cfg.Port))
+
+		con, err := amqp.Dial(uri)
+		if err != nil {
+			return err
+		}
+
+		mq.connection = con
+		mq.channel = nil
 	}
 
-	uri := fmt.Sprintf("amqp://%s:%s@%s", mq.cfg.User, mq.cfg.Password, net.JoinHostPort(mq.cfg.Host, mq.cfg.Port))
+	if mq.channel != nil && !mq.confirmer.isClosed() {
+		return nil
+	}
 
-	con, err := amqp.Dial(uri)
+	channel, err := mq.connection.Channel()
 	if err != nil {
 		return err
 	}
 
-	channel, err := con.Channel()
-	if err != nil {
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+
 		return err
 	}
 
-	mq.errChannel = channel.NotifyClose(make(chan *amqp.Error))
+	errChannel := channel.NotifyClose(make(chan *amqp.Error, 1))
+	mq.confirmer = newConfirmer(
+		channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		channel.NotifyReturn(make(chan amqp.Return, 1)),
+	)
 
-	con.IsClosed()
-	mq.connection = con
 	mq.channel = channel
+	mq.errChannel = errChannel
 
-	go mq.handleConnectionError()
+	go mq.handleConnectionError(channel, errChannel)
 
 	return nil
 }
 
-func (mq *RabbitMQClient) handleConnectionError() {
-	for range mq.errChannel {
+func (mq *RabbitMQClient) handleConnectionError(channel *amqp.Channel, errChannel chan *amqp.Error) {
+	for range errChannel {
 		logger.Error("RabbitMQ connection is closed, trying stablish a new connection..")
 
-		for i := 0; i < maxConnectionRetries; i++ {
-			mq.connection = nil
+		var err error
 
-			err := mq.connect()
+		for i := 0; i < maxConnectionRetries; i++ {
+			err = mq.reconnect(channel)
 			if err == nil {
 				logger.Error("RabbitMQ connection re-established with success")
 
@@ -121,8 +260,20 @@ func (mq *RabbitMQClient) handleConnectionError() {
 			time.Sleep(time.Second * retryConnectionDelay)
 		}
 
-		if mq.channel == nil {
+		if err != nil {
 			logger.Panicf("Couldn't reconnect to RabbitMQ")
 		}
 	}
 }
+
+// Replace the failed channel, nothing is done when it was already replaced by a publish.
+func (mq *RabbitMQClient) reconnect(failed *amqp.Channel) error {
+	mq.Lock()
+	defer mq.Unlock()
+
+	if mq.channel == failed {
+		mq.channel = nil
+	}
+
+	return mq.connect()
+}
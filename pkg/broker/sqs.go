@@ -1,8 +1,10 @@
 package broker
 
 import (
-	"encoding/json"
+	"context"
 	"net"
+	"sort"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -10,13 +12,25 @@ import (
 	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
 )
 
+const (
+	// Prefix of the CloudEvents attributes on the binary mode, SQS attribute names don't accept colons
+	sqsAttributePrefix = "ce_"
+	sqsMaxAttributes   = 10
+)
+
 type SQSClient struct {
 	session *session.Session
+	format  string
 }
 
 func NewSQSClient(cfg Config, region string) (*SQSClient, error) {
+	if err := validateFormat(cfg.EventFormat); err != nil {
+		return nil, err
+	}
+
 	uri := net.JoinHostPort(cfg.Host, cfg.Port)
 	client := &SQSClient{
+		format: cfg.EventFormat,
 		session: session.Must(session.NewSession(&aws.Config{
 			Region:   aws.String(region),
 			Endpoint: aws.String(uri),
@@ -30,9 +44,14 @@ func NewSQSClient(cfg Config, region string) (*SQSClient, error) {
 func (svc *SQSClient) Close() {
 }
 
-func (svc *SQSClient) SendEvent(event Event) error {
-	eventBody, err := svc.getEventBody(event.Data)
+func (svc *SQSClient) SendEvent(event Event) (err error) {
+	event, endSpan := startPublishSpan(event, "sqs.sendMessage")
+	defer func() { endSpan(err) }()
+
+	msg, err := encodeEvent(event, svc.format, sqsAttributePrefix)
 	if err != nil {
+		logger.Errorf("Couldn't encode event: %s", err)
+
 		return err
 	}
 
@@ -45,21 +64,77 @@ func (svc *SQSClient) SendEvent(event Event) error {
 
 	_, err = sqsSvc.SendMessage(
 		&sqs.SendMessageInput{
-			MessageBody: eventBody,
-			QueueUrl:    queueURL.QueueUrl,
+			MessageBody:       aws.String(string(msg.Body)),
+			MessageAttributes: sqsAttributes(msg),
+			QueueUrl:          queueURL.QueueUrl,
 		},
 	)
 
 	return err
 }
 
-func (svc *SQSClient) getEventBody(data any) (*string, error) {
-	eventData, err := json.Marshal(data)
-	if err != nil {
-		logger.Errorf("Couldn't decode event data: %s", err)
+// Check if the SQS endpoint is reachable, the queues are resolved by the event topic when sending.
+func (svc *SQSClient) HealthCheck(ctx context.Context) error {
+	_, err := sqs.New(svc.session).ListQueuesWithContext(ctx, &sqs.ListQueuesInput{MaxResults: aws.Int64(1)})
 
-		return nil, err
+	return err
+}
+
+// The message properties, the CloudEvents attributes, the trace context and the event headers, in this priority order.
+// SQS accepts at most 10 attributes, the ones exceeding the limit are discarded.
+func sqsAttributes(msg message) map[string]*sqs.MessageAttributeValue {
+	names := []string{"content-type"}
+	values := map[string]string{"content-type": msg.ContentType}
+
+	add := func(name, value string) {
+		if _, ok := values[name]; ok || value == "" {
+			return
+		}
+
+		names = append(names, name)
+		values[name] = value
+	}
+
+	// The binary mode attributes already have the id and time.
+	if len(msg.Attributes) == 0 {
+		add("message-id", msg.ID)
+		add("timestamp", msg.Time.UTC().Format(time.RFC3339Nano))
 	}
 
-	return aws.String(string(eventData)), nil
+	for _, name := range sortedKeys(msg.Attributes) {
+		add(name, msg.Attributes[name])
+	}
+
+	add("correlation-id", msg.CorrelationID)
+
+	// The trace context is kept before the other headers.
+	add("traceparent", msg.Headers["traceparent"])
+	add("tracestate", msg.Headers["tracestate"])
+
+	for _, name := range sortedKeys(msg.Headers) {
+		add(name, msg.Headers[name])
+	}
+
+	if len(names) > sqsMaxAttributes {
+		logger.Warningf("[SQS] Message %s has %d attributes, discarding %v", msg.ID, len(names), names[sqsMaxAttributes:])
+		names = names[:sqsMaxAttributes]
+	}
+
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(names))
+	for _, name := range names {
+		attributes[name] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(values[name])}
+	}
+
+	return attributes
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
 }
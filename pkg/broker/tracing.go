@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"context"
+
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/trace"
+)
+
+// Start the producer span of the event, as a child of the span that produced it, and set the span
+// context on the event headers. The returned function ends the span with the publish result.
+func startPublishSpan(event Event, name string) (Event, func(error)) {
+	ctx := trace.Extract(context.Background(), event.TraceContext)
+	ctx, span := trace.NewProducerSpan(ctx, name)
+
+	trace.AddSpanTags(span, map[string]string{"topic": event.Topic, "key": event.Key, "eventID": event.ID})
+
+	traceContext := trace.Inject(ctx)
+	if len(traceContext) == 0 {
+		// Without a tracer the received trace context is sent as it is.
+		traceContext = event.TraceContext
+	}
+
+	headers := make(map[string]string, len(event.Headers)+len(traceContext))
+
+	for name, value := range event.Headers {
+		headers[name] = value
+	}
+
+	for name, value := range traceContext {
+		headers[name] = value
+	}
+
+	event.Headers = headers
+
+	return event, func(err error) {
+		if err != nil {
+			trace.AddSpanError(span, err)
+			trace.FailSpan(span, "Failed to publish event")
+		}
+
+		span.End()
+	}
+}
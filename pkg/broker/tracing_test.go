@@ -0,0 +1,64 @@
+package broker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func useTracer(t *testing.T) {
+	t.Helper()
+
+	otel.SetTracerProvider(tracesdk.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// The global provider keeps delegating to the first provider set, so a noop one is set back.
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oteltrace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+}
+
+func TestStartPublishSpanShouldContinueTraceOfEvent(t *testing.T) {
+	// Prepare
+	useTracer(t)
+
+	ctx, span := trace.NewSpan(context.Background(), "publisher.processFile")
+	defer span.End()
+
+	event := newTestEvent()
+	event.TraceContext = trace.Inject(ctx)
+
+	// Action
+	event, endSpan := startPublishSpan(event, "rabbitmq.publish")
+	endSpan(nil)
+
+	// Assert
+	parent := strings.Split(event.TraceContext["traceparent"], "-")
+	child := strings.Split(event.Headers["traceparent"], "-")
+
+	assert.Len(t, child, 4)
+	assert.Equal(t, parent[1], child[1])
+	assert.NotEqual(t, parent[2], child[2])
+}
+
+func TestStartPublishSpanShouldForwardTraceContextWithoutTracer(t *testing.T) {
+	// Prepare
+	event := newTestEvent()
+	event.Headers = nil
+	event.TraceContext = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+
+	// Action
+	event, endSpan := startPublishSpan(event, "rabbitmq.publish")
+	endSpan(nil)
+
+	// Assert
+	assert.Equal(t, event.TraceContext["traceparent"], event.Headers["traceparent"])
+}
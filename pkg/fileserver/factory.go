@@ -0,0 +1,78 @@
+package fileserver
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownFileServerType = errors.New("unknown file server type")
+
+type Client interface {
+	Glob(context.Context, string, ...string) ([]string, error)
+	Open(context.Context, string) (io.ReadSeekCloser, error)
+	Move(context.Context, string, string) error
+	Remove(context.Context, string) error
+	WriteFile(context.Context, string, []byte) error
+	Stat(context.Context, string) (fs.FileInfo, error)
+	AcquireLock(context.Context, string) (Locker, error)
+	HealthCheck(context.Context) error
+}
+
+type Factory func(cfg Config) (Client, error)
+
+// Registered file server factories, indexed by the FILE_SERVER_TYPE value.
+var (
+	factoriesMu sync.RWMutex          // nolint:gochecknoglobals
+	factories   = map[string]Factory{ // nolint:gochecknoglobals
+		"local": func(cfg Config) (Client, error) {
+			return NewLocalFileServer(cfg)
+		},
+		"sftp": func(cfg Config) (Client, error) {
+			return NewSFTP(cfg, splitList(cfg.KeyExchanges)...)
+		},
+		"ftp": func(cfg Config) (Client, error) {
+			return NewFTP(cfg)
+		},
+		"s3": func(cfg Config) (Client, error) {
+			return NewS3FileServer(cfg)
+		},
+	}
+)
+
+// Register a new file server factory, an existing factory with the same name is replaced.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	factories[strings.ToLower(name)] = factory
+}
+
+// Create the file server client configured by cfg.Type.
+func New(cfg Config) (Client, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[strings.ToLower(strings.TrimSpace(cfg.Type))]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownFileServerType, "'%s'", cfg.Type)
+	}
+
+	return factory(cfg)
+}
+
+func splitList(value string) []string {
+	items := []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
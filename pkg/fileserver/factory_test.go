@@ -0,0 +1,51 @@
+package fileserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewShouldReturnLocalFileServerWhenTypeIsLocal(t *testing.T) {
+	// Arrange
+	cfg := Config{Type: "Local"}
+
+	// Action
+	client, err := New(cfg)
+	assert.Nil(t, err)
+
+	// Assert
+	assert.IsType(t, &LocalFileServer{}, client)
+}
+
+func TestNewShouldReturnErrorWhenTypeIsUnknown(t *testing.T) {
+	// Arrange
+	cfg := Config{Type: "unknown"}
+
+	// Action
+	_, err := New(cfg)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrUnknownFileServerType)
+}
+
+func TestRegisterShouldAddNewFactory(t *testing.T) {
+	// Arrange
+	expected := newSut()
+	Register("custom", func(cfg Config) (Client, error) {
+		return expected, nil
+	})
+
+	t.Cleanup(func() {
+		factoriesMu.Lock()
+		delete(factories, "custom")
+		factoriesMu.Unlock()
+	})
+
+	// Action
+	client, err := New(Config{Type: "custom"})
+	assert.Nil(t, err)
+
+	// Assert
+	assert.Equal(t, expected, client)
+}
@@ -0,0 +1,513 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/drakkan/goftp"
+	"github.com/pkg/errors"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+// TLS modes of the FTP connection.
+const (
+	FTPTLSNone = "none"
+	// Upgrade the plain connection with AUTH TLS, the usual FTPS
+	FTPTLSExplicit = "explicit"
+	// Connect with TLS, usually at the port 990
+	FTPTLSImplicit = "implicit"
+)
+
+// File inside the lock directory with the lock lease.
+const ftpLeaseFile = "lease"
+
+var ErrUnknownTLSMode = errors.New("unknown FTP TLS mode")
+
+// FTP and FTPS file server, the client keeps a pool of connections that is safe for concurrent use.
+type FTPFileServer struct {
+	config Config
+	client *goftp.Client
+	locker *fileLocker
+}
+
+func NewFTP(cfg Config) (*FTPFileServer, error) {
+	ftpCfg, err := ftpClientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := goftp.DialConfig(ftpCfg, cfg.Server)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ftp dial: %s", ErrConnectionFailed)
+	}
+
+	server := &FTPFileServer{config: cfg, client: client}
+	server.locker = newFileLocker(ftpLockStore{server: server}, cfg.LockOwner, cfg.LockLease)
+
+	// The connections are opened on demand, the first one checks the server address and the credentials.
+	if err := server.HealthCheck(context.Background()); err != nil {
+		client.Close()
+
+		return nil, errors.Wrapf(err, "ftp login: %s", ErrConnectionFailed)
+	}
+
+	return server, nil
+}
+
+func ftpClientConfig(cfg Config) (goftp.Config, error) {
+	size := cfg.MaxConnections
+	if size <= 0 {
+		size = defaultConnections
+	}
+
+	ftpCfg := goftp.Config{
+		User:               cfg.User,
+		Password:           cfg.Password,
+		ConnectionsPerHost: size,
+		Timeout:            cfg.Timeout,
+		ActiveTransfers:    cfg.FTPActiveMode,
+		ActiveListenAddr:   cfg.FTPActiveListenAddr,
+	}
+
+	switch mode := strings.ToLower(strings.TrimSpace(cfg.FTPTLSMode)); mode {
+	case "", FTPTLSNone:
+		return ftpCfg, nil
+
+	case FTPTLSExplicit, FTPTLSImplicit:
+		tlsCfg, err := ftpTLSConfig(cfg)
+		if err != nil {
+			return goftp.Config{}, err
+		}
+
+		ftpCfg.TLSConfig = tlsCfg
+		ftpCfg.TLSMode = goftp.TLSExplicit
+
+		if mode == FTPTLSImplicit {
+			ftpCfg.TLSMode = goftp.TLSImplicit
+		}
+
+		return ftpCfg, nil
+
+	default:
+		return goftp.Config{}, errors.Wrapf(ErrUnknownTLSMode, "'%s'", cfg.FTPTLSMode)
+	}
+}
+
+func ftpTLSConfig(cfg Config) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(cfg.Server)
+	if err != nil {
+		host = cfg.Server
+	}
+
+	tlsCfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify, // nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+		// Most servers require the data connections to resume the control connection session
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ftp read CA file: %s", ErrConnectionFailed)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Wrapf(ErrConnectionFailed, "ftp CA file '%s' has no certificates", cfg.TLSCAFile)
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	return tlsCfg, nil
+}
+
+// Return the files matching the pattern, ignoring the ones matching any exclude pattern.
+// FTP has no glob command, so the directories are listed from the pattern base directory.
+func (fs *FTPFileServer) Glob(ctx context.Context, pattern string, exclude ...string) ([]string, error) {
+	pattern = path.Clean(pattern)
+
+	// A pattern without ** only matches files with its number of path segments.
+	maxDepth := -1
+	if !isRecursivePattern(pattern) {
+		maxDepth = strings.Count(pattern, "/")
+	}
+
+	files := []string{}
+
+	if err := fs.walk(ctx, GlobBase(pattern), pattern, exclude, maxDepth, &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (fs *FTPFileServer) walk(
+	ctx context.Context, dir, pattern string, excludes []string, maxDepth int, files *[]string,
+) error {
+	var entries []os.FileInfo
+
+	err := ftpCall(ctx, func() error {
+		var err error
+		entries, err = fs.client.ReadDir(dir)
+
+		return err
+	})
+	if err != nil {
+		if err = ftpError(err, "readdir", dir); os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, entry := range entries {
+		fp := path.Join(dir, path.Base(entry.Name()))
+
+		if isLockFile(fp) || isExcluded(fp, excludes) {
+			continue
+		}
+
+		if !entry.IsDir() {
+			if matchPattern(pattern, fp) {
+				*files = append(*files, fp)
+			}
+
+			continue
+		}
+
+		if maxDepth < 0 || strings.Count(fp, "/") < maxDepth {
+			if err := fs.walk(ctx, fp, pattern, excludes, maxDepth, files); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Open the file for reading, each seek to another offset starts a new transfer from it.
+// The transfer is aborted when the context is done.
+func (fs *FTPFileServer) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, error) {
+	info, err := fs.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: filePath, Err: errors.New("is a directory")}
+	}
+
+	return &ftpReader{ctx: ctx, client: fs.client, path: filePath, size: info.Size()}, nil
+}
+
+func (fs *FTPFileServer) Remove(ctx context.Context, filePath string) error {
+	return ftpChange(ctx, func() error {
+		return ftpError(fs.client.Delete(filePath), "remove", filePath)
+	})
+}
+
+func (fs *FTPFileServer) Move(ctx context.Context, oldname, newname string) error {
+	return ftpChange(ctx, func() error {
+		if err := fs.mkdirAll(path.Dir(newname)); err != nil {
+			return err
+		}
+
+		return ftpError(fs.client.Rename(oldname, newname), "rename", oldname)
+	})
+}
+
+func (fs *FTPFileServer) WriteFile(ctx context.Context, filePath string, data []byte) error {
+	return ftpChange(ctx, func() error {
+		if err := fs.mkdirAll(path.Dir(filePath)); err != nil {
+			return err
+		}
+
+		return ftpError(fs.client.Store(filePath, bytes.NewReader(data)), "write", filePath)
+	})
+}
+
+func (fs *FTPFileServer) Stat(ctx context.Context, filePath string) (fs.FileInfo, error) {
+	var info os.FileInfo
+
+	err := ftpCall(ctx, func() error {
+		var err error
+		info, err = fs.client.Stat(filePath)
+
+		return ftpError(err, "stat", filePath)
+	})
+
+	return info, err
+}
+
+// FTP has no file locking, the file is locked with a lock directory next to it, created with
+// the atomic MKD command, which is shared by the replicas reading the same directory.
+func (fs *FTPFileServer) AcquireLock(ctx context.Context, filePath string) (Locker, error) {
+	lock, err := fs.locker.acquire(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another replica could have processed the file before releasing the lock.
+	if _, err := fs.Stat(ctx, filePath); err != nil {
+		if unlockErr := lock.Unlock(); unlockErr != nil {
+			logger.Warningf("Failed to release the lock of '%s', %s", filePath, unlockErr)
+		}
+
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// Check if the server answers a command, opening a connection when there isn't an idle one.
+func (fs *FTPFileServer) HealthCheck(ctx context.Context) error {
+	return ftpCall(ctx, func() error {
+		_, err := fs.client.Getwd()
+
+		return err
+	})
+}
+
+func (fs *FTPFileServer) Close() error {
+	return fs.client.Close()
+}
+
+// Create the directory and its parents, the existing ones are ignored.
+func (fs *FTPFileServer) mkdirAll(dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+
+	if info, err := fs.client.Stat(dir); err == nil && info.IsDir() {
+		return nil
+	}
+
+	if err := fs.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	if _, err := fs.client.Mkdir(dir); err != nil {
+		// Another process could have created it meanwhile.
+		if info, statErr := fs.client.Stat(dir); statErr == nil && info.IsDir() {
+			return nil
+		}
+
+		return ftpError(err, "mkdir", dir)
+	}
+
+	return nil
+}
+
+// The FTP client doesn't support contexts, so the call returns when the context is done and the command
+// finishes in the background, bounded by the client timeout. Only used by the commands that don't change
+// the server, the transfers are aborted by closing their pipe.
+func ftpCall(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run a command that changes the server, only when the context isn't done yet. Once started the command isn't
+// detached from the caller like on ftpCall, it runs until it finishes, bounded by the client timeout, so the
+// caller doesn't retry a change that went through and the next commands don't run alongside it.
+func ftpChange(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return fn()
+}
+
+// FTP reports a missing file with the 550 reply, which is converted to a not exist error.
+func ftpError(err error, op, filePath string) error {
+	var ftpErr goftp.Error
+	if errors.As(err, &ftpErr) && ftpErr.Code() == 550 {
+		return &os.PathError{Op: op, Path: filePath, Err: os.ErrNotExist}
+	}
+
+	return err
+}
+
+// Remote file read by a transfer from the current offset, a seek to another offset closes the
+// transfer and the next read starts a new one.
+type ftpReader struct {
+	ctx    context.Context
+	client *goftp.Client
+	path   string
+	size   int64
+	offset int64
+	body   *io.PipeReader
+	done   chan struct{}
+}
+
+func (r *ftpReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if r.body == nil {
+		r.start()
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	return n, err
+}
+
+func (r *ftpReader) start() {
+	body, writer := io.Pipe()
+	done := make(chan struct{})
+	offset := r.offset
+
+	go func() {
+		defer close(done)
+
+		_, err := r.client.TransferFromOffset(r.path, writer, nil, offset)
+		writer.CloseWithError(ftpError(err, "read", r.path))
+	}()
+
+	// The transfer fails writing to the closed pipe, aborting it.
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			writer.CloseWithError(r.ctx.Err())
+		case <-done:
+		}
+	}()
+
+	r.body = body
+	r.done = done
+}
+
+func (r *ftpReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.offset, errors.New("ftp seek: invalid whence")
+	}
+
+	if offset < 0 {
+		return r.offset, errors.New("ftp seek: negative position")
+	}
+
+	if offset != r.offset {
+		r.stop()
+		r.offset = offset
+	}
+
+	return offset, nil
+}
+
+func (r *ftpReader) Close() error {
+	r.stop()
+
+	return nil
+}
+
+// Abort the running transfer, its connection is discarded by the client.
+func (r *ftpReader) stop() {
+	if r.body == nil {
+		return
+	}
+
+	r.body.Close()
+	<-r.done
+
+	r.body = nil
+	r.done = nil
+}
+
+// Lock directories at the FTP server, MKD fails when the directory already exists, so it is used
+// as the exclusive create. The lease is written to a file inside the directory.
+type ftpLockStore struct {
+	server *FTPFileServer
+}
+
+func (s ftpLockStore) CreateExclusive(lockPath string, data []byte) error {
+	if _, err := s.server.client.Mkdir(lockPath); err != nil {
+		return err
+	}
+
+	if err := s.WriteFile(lockPath, data); err != nil {
+		// A lock directory without its lease blocks the file until it expires.
+		_ = s.Remove(lockPath)
+
+		return err
+	}
+
+	return nil
+}
+
+// A lock directory without the lease, like one being created, returns no data and the directory modification time.
+func (s ftpLockStore) ReadFile(lockPath string) ([]byte, time.Time, error) {
+	info, err := s.server.Stat(context.Background(), lockPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	buf := bytes.Buffer{}
+
+	if err := s.server.client.Retrieve(path.Join(lockPath, ftpLeaseFile), &buf); err != nil {
+		if os.IsNotExist(ftpError(err, "read", lockPath)) {
+			return nil, info.ModTime(), nil
+		}
+
+		return nil, time.Time{}, err
+	}
+
+	return buf.Bytes(), info.ModTime(), nil
+}
+
+func (s ftpLockStore) WriteFile(lockPath string, data []byte) error {
+	return s.server.client.Store(path.Join(lockPath, ftpLeaseFile), bytes.NewReader(data))
+}
+
+func (s ftpLockStore) Remove(lockPath string) error {
+	if err := ftpError(s.server.client.Delete(path.Join(lockPath, ftpLeaseFile)), "remove", lockPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return ftpError(s.server.client.Rmdir(lockPath), "remove", lockPath)
+}
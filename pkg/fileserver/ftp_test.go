@@ -0,0 +1,349 @@
+package fileserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// In-process FTP server, serving a directory of the local file system.
+type testFTPDriver struct {
+	root     string
+	settings *ftpserver.Settings
+	tls      *tls.Config
+}
+
+func (d *testFTPDriver) GetSettings() (*ftpserver.Settings, error) {
+	return d.settings, nil
+}
+
+func (d *testFTPDriver) ClientConnected(cc ftpserver.ClientContext) (string, error) {
+	return "test server", nil
+}
+
+func (d *testFTPDriver) ClientDisconnected(cc ftpserver.ClientContext) {}
+
+func (d *testFTPDriver) AuthUser(cc ftpserver.ClientContext, user, pass string) (ftpserver.ClientDriver, error) {
+	if user != "collector" || pass != "secret" {
+		return nil, errInvalidCredentials
+	}
+
+	return afero.NewBasePathFs(afero.NewOsFs(), d.root), nil
+}
+
+func (d *testFTPDriver) GetTLSConfig() (*tls.Config, error) {
+	if d.tls == nil {
+		return nil, errors.New("tls isn't configured")
+	}
+
+	return d.tls, nil
+}
+
+// Start a FTP server at the directory, returning the config of a client connected to it.
+func startFTPServer(t *testing.T, root string, tlsMode ftpserver.TLSRequirement) Config {
+	t.Helper()
+
+	driver := &testFTPDriver{
+		root: root,
+		settings: &ftpserver.Settings{
+			ListenAddr:              "127.0.0.1:0",
+			TLSRequired:             tlsMode,
+			ActiveTransferPortNon20: true,
+		},
+	}
+
+	if tlsMode != ftpserver.ClearOrEncrypted {
+		driver.tls = newTestTLSConfig(t)
+	}
+
+	server := ftpserver.NewFtpServer(driver)
+	assert.Nil(t, server.Listen())
+
+	go server.Serve() // nolint:errcheck
+
+	t.Cleanup(func() { _ = server.Stop() })
+
+	return Config{
+		Type:           "ftp",
+		Server:         server.Addr(),
+		User:           "collector",
+		Password:       "secret",
+		MaxConnections: 2,
+		Timeout:        5 * time.Second,
+		LockLease:      time.Minute,
+	}
+}
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+func newFTPSut(t *testing.T, cfg Config) *FTPFileServer {
+	t.Helper()
+
+	sut, err := NewFTP(cfg)
+	assert.Nil(t, err)
+
+	t.Cleanup(func() { sut.Close() })
+
+	return sut
+}
+
+func writeTestFiles(t *testing.T, root string, files ...string) {
+	t.Helper()
+
+	for _, file := range files {
+		fp := filepath.Join(root, filepath.FromSlash(file))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(fp), os.ModePerm))
+		assert.Nil(t, os.WriteFile(fp, []byte("0123456789"), 0o644))
+	}
+}
+
+func TestFTPGlobShouldMatchPatternDepth(t *testing.T) {
+	// Prepare
+	root := t.TempDir()
+	writeTestFiles(t, root, "in/a.csv", "in/b.txt", "in/sub/c.csv", "in/sub/deep/d.csv")
+
+	// Arrange
+	sut := newFTPSut(t, startFTPServer(t, root, ftpserver.ClearOrEncrypted))
+
+	tests := []struct {
+		pattern  string
+		excludes []string
+		expected []string
+	}{
+		{pattern: "/in/*.csv", expected: []string{"/in/a.csv"}},
+		{pattern: "/in/*/*.csv", expected: []string{"/in/sub/c.csv"}},
+		{pattern: "/in/**/*.csv", expected: []string{"/in/a.csv", "/in/sub/c.csv", "/in/sub/deep/d.csv"}},
+		{pattern: "/in/**/*.csv", excludes: []string{"/in/sub/deep"}, expected: []string{"/in/a.csv", "/in/sub/c.csv"}},
+		{pattern: "/missing/*.csv", expected: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			// Action
+			files, err := sut.Glob(context.Background(), tc.pattern, tc.excludes...)
+
+			// Assert
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, tc.expected, files)
+		})
+	}
+}
+
+func TestFTPShouldReturnWhenContextIsDone(t *testing.T) {
+	// Prepare
+	root := t.TempDir()
+	writeTestFiles(t, root, "in/a.csv")
+
+	// Arrange
+	sut := newFTPSut(t, startFTPServer(t, root, ftpserver.ClearOrEncrypted))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	file, err := sut.Open(ctx, "/in/a.csv")
+	assert.Nil(t, err)
+
+	defer file.Close()
+
+	// Action
+	cancel()
+
+	_, readErr := io.ReadAll(file)
+	_, globErr := sut.Glob(ctx, "/in/*.csv")
+	moveErr := sut.Move(ctx, "/in/a.csv", "/out/a.csv")
+
+	// Assert
+	assert.ErrorIs(t, readErr, context.Canceled)
+	assert.ErrorIs(t, globErr, context.Canceled)
+	assert.ErrorIs(t, moveErr, context.Canceled)
+	assert.FileExists(t, filepath.Join(root, "in", "a.csv"))
+}
+
+// Context done right after the command starts, the first check still reports it as active.
+type doneOnStartContext struct {
+	context.Context
+	checks int32
+}
+
+func (c *doneOnStartContext) Err() error {
+	if atomic.AddInt32(&c.checks, 1) == 1 {
+		return nil
+	}
+
+	return c.Context.Err()
+}
+
+func TestFTPMoveShouldReturnResultWhenContextIsDoneWhileRunning(t *testing.T) {
+	// Prepare
+	root := t.TempDir()
+	writeTestFiles(t, root, "in/a.csv")
+
+	// Arrange
+	sut := newFTPSut(t, startFTPServer(t, root, ftpserver.ClearOrEncrypted))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Action
+	err := sut.Move(&doneOnStartContext{Context: canceled}, "/in/a.csv", "/out/a.csv")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(root, "out", "a.csv"))
+}
+
+func TestFTPOpenShouldSupportSeek(t *testing.T) {
+	// Prepare
+	root := t.TempDir()
+	writeTestFiles(t, root, "in/a.csv")
+
+	// Arrange
+	sut := newFTPSut(t, startFTPServer(t, root, ftpserver.ClearOrEncrypted))
+
+	file, err := sut.Open(context.Background(), "/in/a.csv")
+	assert.Nil(t, err)
+
+	defer file.Close()
+
+	// Action
+	all, err := io.ReadAll(file)
+	assert.Nil(t, err)
+
+	position, err := file.Seek(-4, io.SeekEnd)
+	assert.Nil(t, err)
+
+	tail, err := io.ReadAll(file)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(all))
+	assert.Equal(t, int64(6), position)
+	assert.Equal(t, "6789", string(tail))
+}
+
+func TestFTPMoveShouldCreateTargetDirectory(t *testing.T) {
+	// Prepare
+	root := t.TempDir()
+	writeTestFiles(t, root, "in/a.csv")
+
+	// Arrange
+	sut := newFTPSut(t, startFTPServer(t, root, ftpserver.ClearOrEncrypted))
+
+	// Action
+	err := sut.Move(context.Background(), "/in/a.csv", "/done/2022/a.csv")
+
+	// Assert
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(root, "done", "2022", "a.csv"))
+
+	_, err = sut.Stat(context.Background(), "/in/a.csv")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFTPLockShouldBeExclusiveBetweenReplicas(t *testing.T) {
+	// Prepare
+	root := t.TempDir()
+	writeTestFiles(t, root, "in/a.csv")
+
+	cfg := startFTPServer(t, root, ftpserver.ClearOrEncrypted)
+
+	// Arrange
+	cfg.LockOwner = "replica-1"
+	first := newFTPSut(t, cfg)
+
+	cfg.LockOwner = "replica-2"
+	second := newFTPSut(t, cfg)
+
+	lock, err := first.AcquireLock(context.Background(), "/in/a.csv")
+	assert.Nil(t, err)
+
+	// Action
+	_, err = second.AcquireLock(context.Background(), "/in/a.csv")
+
+	// Assert
+	assert.ErrorIs(t, err, ErrFileLocked)
+
+	files, err := second.Glob(context.Background(), "/in/*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/in/a.csv"}, files)
+
+	assert.Nil(t, lock.Unlock())
+	assert.NoDirExists(t, lockFilePath(filepath.Join(root, "in", "a.csv")))
+}
+
+func TestFTPShouldConnectWithTLSAndActiveMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		tlsMode string
+		server  ftpserver.TLSRequirement
+		active  bool
+	}{
+		{name: "explicit tls", tlsMode: FTPTLSExplicit, server: ftpserver.MandatoryEncryption},
+		{name: "implicit tls", tlsMode: FTPTLSImplicit, server: ftpserver.ImplicitEncryption},
+		{name: "active mode", tlsMode: FTPTLSNone, server: ftpserver.ClearOrEncrypted, active: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Prepare
+			root := t.TempDir()
+			writeTestFiles(t, root, "in/a.csv")
+
+			// Arrange
+			cfg := startFTPServer(t, root, tc.server)
+			cfg.FTPTLSMode = tc.tlsMode
+			cfg.FTPActiveMode = tc.active
+			cfg.TLSInsecureSkipVerify = true
+
+			sut := newFTPSut(t, cfg)
+
+			// Action
+			files, err := sut.Glob(context.Background(), "/in/*.csv")
+
+			// Assert
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"/in/a.csv"}, files)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package fileserver
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Check if the pattern needs to walk through the directories, the standard glob doesn't support **.
+func isRecursivePattern(pattern string) bool {
+	return strings.Contains(pattern, "**")
+}
+
+// Return the directory part of the pattern before the first glob meta character, with slash separators.
+// The file servers walk from it and the collector computes the relative keys from it.
+func GlobBase(pattern string) string {
+	pattern = filepath.ToSlash(pattern)
+
+	idx := strings.IndexAny(pattern, "*?[{")
+	if idx < 0 {
+		return path.Dir(pattern)
+	}
+
+	return path.Dir(pattern[:idx+1])
+}
+
+// Match the path against the pattern, ** matches any number of directories.
+func matchPattern(pattern, filePath string) bool {
+	match, err := doublestar.Match(filepath.ToSlash(pattern), filepath.ToSlash(filePath))
+
+	return err == nil && match
+}
+
+// Check if the path matches any of the exclude patterns.
+func isExcluded(filePath string, excludes []string) bool {
+	for _, exclude := range excludes {
+		if matchPattern(exclude, filePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check if the pattern is valid, supporting ** and {a,b} alternatives.
+func ValidatePattern(pattern string) bool {
+	return doublestar.ValidatePattern(filepath.ToSlash(pattern))
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
 )
 
 type LocalFileServer struct {
@@ -22,28 +23,81 @@ func NewLocalFileServer(cfg Config) (*LocalFileServer, error) {
 	}, nil
 }
 
-func (fs *LocalFileServer) Glob(ctx context.Context, pattern string) ([]string, error) {
+// Return the absolute path of the files matching the pattern, ignoring the ones matching any exclude pattern.
+// Relative patterns are resolved from the working directory.
+func (fs *LocalFileServer) Glob(ctx context.Context, pattern string, exclude ...string) ([]string, error) {
+	absPattern, err := filepath.Abs(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	absExcludes := make([]string, 0, len(exclude))
+
+	for _, excludePattern := range exclude {
+		absExclude, err := filepath.Abs(excludePattern)
+		if err != nil {
+			return nil, err
+		}
+
+		absExcludes = append(absExcludes, absExclude)
+	}
+
+	if isRecursivePattern(absPattern) {
+		return walkLocal(absPattern, absExcludes)
+	}
+
 	files := []string{}
 
-	matchs, err := filepath.Glob(pattern)
+	matchs, err := filepath.Glob(absPattern)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, match := range matchs {
-		if f, _ := os.Stat(match); !f.IsDir() {
-			absFilePath, err := filepath.Abs(match)
-			if err != nil {
-				return nil, err
-			}
-
-			files = append(files, absFilePath)
+		if f, err := os.Stat(match); err == nil && !f.IsDir() && !isExcluded(match, absExcludes) {
+			files = append(files, match)
 		}
 	}
 
 	return files, nil
 }
 
+// Walk through the pattern base directory matching each file, excluded directories are skipped.
+func walkLocal(pattern string, excludes []string) ([]string, error) {
+	files := []string{}
+
+	err := filepath.WalkDir(filepath.FromSlash(GlobBase(pattern)), func(fp string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if isExcluded(fp, excludes) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !entry.IsDir() && matchPattern(pattern, fp) {
+			files = append(files, fp)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// The local file system is always available, the collected directories are checked by the collector.
+func (fs *LocalFileServer) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 func (fs *LocalFileServer) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, error) {
 	return os.Open(filePath)
 }
@@ -61,6 +115,15 @@ func (fs *LocalFileServer) Move(ctx context.Context, oldname, newname string) er
 	return os.Rename(oldname, newname)
 }
 
+func (fs *LocalFileServer) WriteFile(ctx context.Context, filePath string, data []byte) error {
+	dirName, _ := filepath.Split(filePath)
+	if err := os.MkdirAll(dirName, os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, data, 0o644) // nolint:gosec
+}
+
 func (fs *LocalFileServer) AcquireLock(ctx context.Context, filePath string) (Locker, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, err
@@ -68,10 +131,15 @@ func (fs *LocalFileServer) AcquireLock(ctx context.Context, filePath string) (Lo
 
 	locker := flock.New(filePath)
 
-	if _, err := locker.TryLock(); err != nil {
+	locked, err := locker.TryLock()
+	if err != nil {
 		return nil, err
 	}
 
+	if !locked {
+		return nil, errors.Wrapf(ErrFileLocked, "'%s'", filePath)
+	}
+
 	return locker, nil
 }
 
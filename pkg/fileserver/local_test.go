@@ -34,6 +34,10 @@ func newSut() *LocalFileServer {
 func createTempFile(fileName string) (string, error) {
 	fp := filepath.Join(tmpDir, fileName)
 
+	if err := os.MkdirAll(filepath.Dir(fp), os.ModePerm); err != nil {
+		return "", err
+	}
+
 	err := ioutil.WriteFile(fp, []byte{}, fs.ModePerm)
 	if err != nil {
 		return "", err
@@ -122,6 +126,63 @@ func TestGlobShouldReturnOnlyAbsPath(t *testing.T) {
 	}
 }
 
+func TestGlobShouldMatchRecursivePattern(t *testing.T) {
+	// Prepare
+	sut := newSut()
+
+	// Arrange
+	rootFile, err := createTempFile("test_recursive_glob_root.csv")
+	assert.Nil(t, err)
+
+	nestedFile, err := createTempFile(filepath.Join("recursive", "nested", "test_recursive_glob_nested.csv"))
+	assert.Nil(t, err)
+
+	ignoredFile, err := createTempFile(filepath.Join("recursive", "test_recursive_glob_ignored.txt"))
+	assert.Nil(t, err)
+
+	// Action
+	collectedFiles, err := sut.Glob(context.TODO(), filepath.Join(tmpDir, "**", "test_recursive_glob_*.csv"))
+	assert.Nil(t, err)
+
+	// Assert
+	assert.Contains(t, collectedFiles, rootFile)
+	assert.Contains(t, collectedFiles, nestedFile)
+	assert.NotContains(t, collectedFiles, ignoredFile)
+}
+
+func TestGlobShouldIgnoreExcludedFiles(t *testing.T) {
+	// Prepare
+	sut := newSut()
+
+	// Arrange
+	expectedFile, err := createTempFile(filepath.Join("exclude", "test_exclude_collected.json"))
+	assert.Nil(t, err)
+
+	ignoredFile, err := createTempFile(filepath.Join("exclude", "test_exclude_ignored.partial.json"))
+	assert.Nil(t, err)
+
+	ignoredDirFile, err := createTempFile(filepath.Join("exclude", "tmp", "test_exclude_tmp.json"))
+	assert.Nil(t, err)
+
+	excludes := []string{
+		filepath.Join(tmpDir, "**", "*.partial.json"),
+		filepath.Join(tmpDir, "exclude", "tmp"),
+	}
+
+	// Action
+	flatFiles, err := sut.Glob(context.TODO(), filepath.Join(tmpDir, "exclude", "*.json"), excludes...)
+	assert.Nil(t, err)
+
+	recursiveFiles, err := sut.Glob(context.TODO(), filepath.Join(tmpDir, "exclude", "**", "*.json"), excludes...)
+	assert.Nil(t, err)
+
+	// Assert
+	assert.Equal(t, []string{expectedFile}, flatFiles)
+	assert.Equal(t, []string{expectedFile}, recursiveFiles)
+	assert.NotContains(t, recursiveFiles, ignoredFile)
+	assert.NotContains(t, recursiveFiles, ignoredDirFile)
+}
+
 func TestRemoveFileDeleteFile(t *testing.T) {
 	// Prepare
 	sut := newSut()
@@ -182,3 +243,18 @@ func TestMoveShouldCreateFolders(t *testing.T) {
 	assert.NoFileExists(t, file)
 	assert.FileExists(t, newpath)
 }
+
+func TestWriteFileShouldCreateFolders(t *testing.T) {
+	// Arrange
+	sut := newSut()
+	filePath := filepath.Join(tmpDir, "test_write_file_should_create_folders", "file.json")
+
+	// Action
+	err := sut.WriteFile(context.TODO(), filePath, []byte("{}"))
+	assert.Nil(t, err)
+
+	// Assert
+	data, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("{}"), data)
+}
@@ -0,0 +1,290 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+// Prefix and suffix of the lock files, created next to the locked file as .<name>.collector-lock,
+// so they aren't mistaken for the files collected.
+const (
+	lockFilePrefix = "."
+	lockFileSuffix = ".collector-lock"
+)
+
+const defaultLockLease = time.Minute
+
+var (
+	ErrFileLocked = models.ErrFileLocked
+	ErrLockLost   = models.ErrLockLost
+)
+
+// Content of a lock file, the token identifies the lock acquisition and the owner the replica holding it.
+type lockLease struct {
+	Owner     string    `json:"owner"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Operations on the lock files, CreateExclusive must fail when the file already exists.
+type lockStore interface {
+	CreateExclusive(path string, data []byte) error
+	ReadFile(path string) ([]byte, time.Time, error)
+	WriteFile(path string, data []byte) error
+	Remove(path string) error
+}
+
+// Lock the files of a remote source with lock files, so the replicas sharing the source don't process
+// the same file. The lease is renewed while the lock is held and a lock with an expired lease, like the
+// one left by a stopped replica, is taken over. The expiration is checked with the local clock, so the
+// replicas clocks must be synchronized.
+type fileLocker struct {
+	store lockStore
+	owner string
+	lease time.Duration
+}
+
+func newFileLocker(store lockStore, owner string, lease time.Duration) *fileLocker {
+	if strings.TrimSpace(owner) == "" {
+		owner = defaultLockOwner()
+	}
+
+	if lease <= 0 {
+		lease = defaultLockLease
+	}
+
+	return &fileLocker{store: store, owner: owner, lease: lease}
+}
+
+// The host name and the process id, unique for each replica.
+func defaultLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Create the lock file of the file, returns ErrFileLocked when another owner holds a valid lease.
+func (l *fileLocker) acquire(filePath string) (*fileLock, error) {
+	lock := &fileLock{
+		locker: l,
+		path:   lockFilePath(filePath),
+		token:  uuid.NewString(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+
+	// The second attempt is made after removing a stale lock or when the lock was released meanwhile.
+	for attempt := 0; attempt < 2; attempt++ {
+		data, err := l.encode(lock.token)
+		if err != nil {
+			return nil, err
+		}
+
+		createErr := l.store.CreateExclusive(lock.path, data)
+		if createErr == nil {
+			return l.verify(lock, filePath)
+		}
+
+		// Some servers don't tell apart an existing file from other failures, so the lock is read to check it.
+		current, err := l.read(lock.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(createErr, "create lock file '%s'", lock.path)
+		}
+
+		if time.Now().Before(current.ExpiresAt) {
+			return nil, errors.Wrapf(ErrFileLocked, "'%s' is locked by '%s' until %s", filePath, current.Owner, current.ExpiresAt)
+		}
+
+		logger.Warningf("Taking over the lock of '%s' held by '%s', it expired at %s", filePath, current.Owner, current.ExpiresAt)
+
+		if err := l.removeStale(lock.path, current); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errors.Wrapf(ErrFileLocked, "'%s'", filePath)
+}
+
+// Read the created lock back, the servers without an exclusive create overwrite the lock of another owner.
+func (l *fileLocker) verify(lock *fileLock, filePath string) (*fileLock, error) {
+	owned, err := lock.owned()
+	if err != nil {
+		return nil, errors.Wrapf(err, "read created lock file '%s'", lock.path)
+	}
+
+	if !owned {
+		return nil, errors.Wrapf(ErrFileLocked, "'%s' was locked by another owner at the same time", filePath)
+	}
+
+	go lock.renew()
+
+	return lock, nil
+}
+
+// Remove the lock only when it still holds the stale lease, another owner could have taken it over after
+// it was read. Two owners may still remove it at the same time, then the renewal of the first one reports
+// the lock as lost.
+func (l *fileLocker) removeStale(path string, stale lockLease) error {
+	current, err := l.read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "read stale lock file '%s'", path)
+	}
+
+	if current.Token != stale.Token || !current.ExpiresAt.Equal(stale.ExpiresAt) {
+		return errors.Wrapf(ErrFileLocked, "'%s' was taken over by '%s'", path, current.Owner)
+	}
+
+	if err := l.store.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "remove stale lock file '%s'", path)
+	}
+
+	return nil
+}
+
+func (l *fileLocker) encode(token string) ([]byte, error) {
+	return json.Marshal(lockLease{Owner: l.owner, Token: token, ExpiresAt: time.Now().Add(l.lease).UTC()})
+}
+
+// Read the lease of a lock file, a lock file that couldn't be parsed, like one being written,
+// expires a lease after its last modification.
+func (l *fileLocker) read(path string) (lockLease, error) {
+	data, modTime, err := l.store.ReadFile(path)
+	if err != nil {
+		return lockLease{}, err
+	}
+
+	var lease lockLease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return lockLease{ExpiresAt: modTime.Add(l.lease)}, nil
+	}
+
+	return lease, nil
+}
+
+// Lock file held by this process, the lease is renewed until it is unlocked.
+type fileLock struct {
+	locker *fileLocker
+	path   string
+	token  string
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	// Closed by the renewal when the lock is taken over by another owner
+	lost chan struct{}
+}
+
+// Closed when the lock is taken over by another owner, the file must not be processed anymore.
+func (f *fileLock) Lost() <-chan struct{} {
+	return f.lost
+}
+
+func (f *fileLock) Unlock() error {
+	f.once.Do(func() { close(f.stop) })
+	<-f.done
+
+	select {
+	case <-f.lost:
+		return errors.Wrapf(ErrLockLost, "'%s'", f.path)
+	default:
+	}
+
+	owned, err := f.owned()
+	if err != nil {
+		return err
+	}
+
+	if !owned {
+		return errors.Wrapf(ErrLockLost, "'%s'", f.path)
+	}
+
+	return f.locker.store.Remove(f.path)
+}
+
+// Renew the lease before it expires, stops when the lock is taken over by another owner.
+func (f *fileLock) renew() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(f.locker.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+
+		owned, err := f.owned()
+		if err != nil {
+			logger.Warningf("Failed to check the lock '%s', %s", f.path, err)
+
+			continue
+		}
+
+		if !owned {
+			logger.Errorf("Lock '%s' was taken over by another owner", f.path)
+			close(f.lost)
+
+			return
+		}
+
+		data, err := f.locker.encode(f.token)
+		if err == nil {
+			err = f.locker.store.WriteFile(f.path, data)
+		}
+
+		if err != nil {
+			logger.Warningf("Failed to renew the lock '%s', %s", f.path, err)
+		}
+	}
+}
+
+func (f *fileLock) owned() (bool, error) {
+	current, err := f.locker.read(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return current.Token == f.token, nil
+}
+
+// Path of the lock file of the file.
+func lockFilePath(filePath string) string {
+	dir, name := path.Split(filePath)
+
+	return dir + lockFilePrefix + name + lockFileSuffix
+}
+
+// Check if the path is a lock file created by the locker, other files ending with .lock are collected.
+func isLockFile(filePath string) bool {
+	name := path.Base(filePath)
+
+	return len(name) > len(lockFilePrefix)+len(lockFileSuffix) &&
+		strings.HasPrefix(name, lockFilePrefix) && strings.HasSuffix(name, lockFileSuffix)
+}
@@ -0,0 +1,252 @@
+package fileserver
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Lock files at the local file system, os.O_EXCL behaves like the SFTP exclusive create.
+type osLockStore struct{}
+
+func (osLockStore) CreateExclusive(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+func (osLockStore) ReadFile(path string) ([]byte, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	return data, info.ModTime(), err
+}
+
+func (osLockStore) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (osLockStore) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func readLease(t *testing.T, path string) lockLease {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	var lease lockLease
+	assert.Nil(t, json.Unmarshal(data, &lease))
+
+	return lease
+}
+
+func TestLockFileShouldBeExclusiveBetweenOwners(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+
+	// Arrange
+	first := newFileLocker(osLockStore{}, "replica-1", time.Minute)
+	second := newFileLocker(osLockStore{}, "replica-2", time.Minute)
+
+	lock, err := first.acquire(filePath)
+	assert.Nil(t, err)
+
+	// Action
+	_, err = second.acquire(filePath)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrFileLocked)
+	assert.Equal(t, "replica-1", readLease(t, lockFilePath(filePath)).Owner)
+
+	assert.Nil(t, lock.Unlock())
+	assert.NoFileExists(t, lockFilePath(filePath))
+}
+
+func TestLockFileShouldTakeOverExpiredLease(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+
+	// Arrange
+	stale, err := json.Marshal(lockLease{Owner: "stopped", Token: "old", ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(lockFilePath(filePath), stale, 0o644))
+
+	sut := newFileLocker(osLockStore{}, "replica-1", time.Minute)
+
+	// Action
+	lock, err := sut.acquire(filePath)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "replica-1", readLease(t, lockFilePath(filePath)).Owner)
+	assert.Nil(t, lock.Unlock())
+}
+
+func TestLockFileShouldRenewLeaseWhileHeld(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+	lease := 150 * time.Millisecond
+
+	// Arrange
+	first := newFileLocker(osLockStore{}, "replica-1", lease)
+	second := newFileLocker(osLockStore{}, "replica-2", lease)
+
+	lock, err := first.acquire(filePath)
+	assert.Nil(t, err)
+
+	// Action
+	time.Sleep(2 * lease)
+	_, err = second.acquire(filePath)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrFileLocked)
+	assert.Nil(t, lock.Unlock())
+}
+
+func TestLockFileShouldReportLockTakenOver(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+
+	// Arrange
+	sut := newFileLocker(osLockStore{}, "replica-1", time.Minute)
+
+	lock, err := sut.acquire(filePath)
+	assert.Nil(t, err)
+
+	other, err := json.Marshal(lockLease{Owner: "replica-2", Token: "other", ExpiresAt: time.Now().Add(time.Minute)})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(lockFilePath(filePath), other, 0o644))
+
+	// Action
+	err = lock.Unlock()
+
+	// Assert
+	assert.ErrorIs(t, err, ErrLockLost)
+	assert.Equal(t, "replica-2", readLease(t, lockFilePath(filePath)).Owner)
+}
+
+// Runs the hooks once after a create or a read, like another owner changing the lock meanwhile.
+type racingLockStore struct {
+	osLockStore
+	afterCreate func(path string)
+	afterRead   func(path string)
+}
+
+func (s *racingLockStore) CreateExclusive(path string, data []byte) error {
+	err := s.osLockStore.CreateExclusive(path, data)
+	if err == nil && s.afterCreate != nil {
+		hook := s.afterCreate
+		s.afterCreate = nil
+		hook(path)
+	}
+
+	return err
+}
+
+func (s *racingLockStore) ReadFile(path string) ([]byte, time.Time, error) {
+	data, modTime, err := s.osLockStore.ReadFile(path)
+	if s.afterRead != nil {
+		hook := s.afterRead
+		s.afterRead = nil
+		hook(path)
+	}
+
+	return data, modTime, err
+}
+
+func writeLease(t *testing.T, path string, lease lockLease) {
+	t.Helper()
+
+	data, err := json.Marshal(lease)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, data, 0o644))
+}
+
+func TestLockFileShouldNotRemoveLockTakenOverMeanwhile(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+	writeLease(t, lockFilePath(filePath), lockLease{Owner: "stopped", Token: "old", ExpiresAt: time.Now().Add(-time.Second)})
+
+	// Arrange
+	store := &racingLockStore{afterRead: func(path string) {
+		writeLease(t, path, lockLease{Owner: "replica-2", Token: "new", ExpiresAt: time.Now().Add(time.Minute)})
+	}}
+	sut := newFileLocker(store, "replica-1", time.Minute)
+
+	// Action
+	_, err := sut.acquire(filePath)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrFileLocked)
+	assert.Equal(t, "replica-2", readLease(t, lockFilePath(filePath)).Owner)
+}
+
+func TestLockFileShouldVerifyTokenAfterCreate(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+
+	// Arrange
+	store := &racingLockStore{afterCreate: func(path string) {
+		writeLease(t, path, lockLease{Owner: "replica-2", Token: "other", ExpiresAt: time.Now().Add(time.Minute)})
+	}}
+	sut := newFileLocker(store, "replica-1", time.Minute)
+
+	// Action
+	_, err := sut.acquire(filePath)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrFileLocked)
+	assert.Equal(t, "replica-2", readLease(t, lockFilePath(filePath)).Owner)
+}
+
+func TestLockFileShouldCloseLostWhenTakenOver(t *testing.T) {
+	// Prepare
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+	lease := 150 * time.Millisecond
+
+	// Arrange
+	sut := newFileLocker(osLockStore{}, "replica-1", lease)
+
+	lock, err := sut.acquire(filePath)
+	assert.Nil(t, err)
+
+	// Action
+	writeLease(t, lockFilePath(filePath), lockLease{Owner: "replica-2", Token: "other", ExpiresAt: time.Now().Add(time.Minute)})
+
+	// Assert
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock wasn't reported as lost")
+	}
+
+	assert.ErrorIs(t, lock.Unlock(), ErrLockLost)
+}
+
+func TestIsLockFileShouldMatchOnlyLockFilesOfTheLocker(t *testing.T) {
+	// Assert
+	assert.True(t, isLockFile(lockFilePath("/in/a.csv")))
+	assert.True(t, isLockFile(lockFilePath("a.csv")))
+	assert.False(t, isLockFile("/in/a.csv.lock"))
+	assert.False(t, isLockFile("/in/package.lock"))
+	assert.False(t, isLockFile("/in/.collector-lock"))
+}
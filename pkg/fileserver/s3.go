@@ -0,0 +1,484 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+var ErrLockRaceLost = errors.New("lock object was overwritten by another owner")
+
+// S3 bucket as a file server, the file paths are the object keys, a leading slash is ignored.
+// S3 has no directories, a pattern is matched against the keys listed by its base prefix.
+type S3FileServer struct {
+	config Config
+	client *s3.S3
+	locker *fileLocker
+}
+
+func NewS3FileServer(cfg Config) (*S3FileServer, error) {
+	awsCfg := &aws.Config{
+		Region:           aws.String(cfg.S3Region),
+		S3ForcePathStyle: aws.Bool(cfg.S3PathStyle),
+	}
+
+	if cfg.S3Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.S3Endpoint)
+	}
+
+	// Without static credentials the default chain is used: environment, shared files and the instance role.
+	if cfg.S3AccessKeyID != "" {
+		awsCfg.Credentials = credentials.NewStaticCredentials(cfg.S3AccessKeyID, cfg.S3SecretAccessKey, "")
+	}
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "s3 session: %s", ErrConnectionFailed)
+	}
+
+	server := &S3FileServer{config: cfg, client: s3.New(sess)}
+	server.locker = newFileLocker(s3LockStore{server: server}, cfg.LockOwner, cfg.LockLease)
+
+	if err := server.HealthCheck(context.Background()); err != nil {
+		return nil, errors.Wrapf(err, "s3 bucket '%s': %s", cfg.S3Bucket, ErrConnectionFailed)
+	}
+
+	return server, nil
+}
+
+// Return the objects matching the pattern, ignoring the ones matching any exclude pattern.
+// An exclude pattern matching a key prefix, like a directory, excludes all the objects below it.
+func (fs *S3FileServer) Glob(ctx context.Context, pattern string, exclude ...string) ([]string, error) {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	pattern = path.Clean(pattern)
+	rooted := strings.HasPrefix(pattern, "/")
+
+	prefix := s3Key(GlobBase(pattern))
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(fs.config.S3Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	// A pattern matching only the objects at the prefix level doesn't need to list the ones below it.
+	if !isRecursivePattern(pattern) && !strings.Contains(strings.TrimPrefix(s3Key(pattern), prefix), "/") {
+		input.Delimiter = aws.String("/")
+	}
+
+	files := []string{}
+
+	err := fs.client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			fp := aws.StringValue(object.Key)
+
+			// Keys ending with a slash are the empty "directories" created by the consoles.
+			if strings.HasSuffix(fp, "/") {
+				continue
+			}
+
+			if rooted {
+				fp = "/" + fp
+			}
+
+			if isLockFile(fp) || isS3Excluded(fp, exclude) || !matchPattern(pattern, fp) {
+				continue
+			}
+
+			files = append(files, fp)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, s3Error(err, "glob", pattern)
+	}
+
+	return files, nil
+}
+
+func isS3Excluded(filePath string, excludes []string) bool {
+	for dir := filePath; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if isExcluded(dir, excludes) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Open the object for reading, each seek to another offset starts a new ranged request from it.
+// The reads are made on the object version returned by Stat, a change meanwhile fails the read.
+// The requests are bound to the context and each read to the operation timeout.
+func (fs *S3FileServer) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, error) {
+	info, err := fs.Stat(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	head, _ := info.Sys().(*s3.HeadObjectOutput)
+
+	return &s3Reader{
+		ctx:    ctx,
+		server: fs,
+		path:   filePath,
+		etag:   head.ETag,
+		size:   info.Size(),
+	}, nil
+}
+
+func (fs *S3FileServer) Remove(ctx context.Context, filePath string) error {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	_, err := fs.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(fs.config.S3Bucket),
+		Key:    aws.String(s3Key(filePath)),
+	})
+
+	return s3Error(err, "remove", filePath)
+}
+
+// S3 has no rename, the object is copied to the new key and removed. A single copy supports objects up to 5 GB.
+func (fs *S3FileServer) Move(ctx context.Context, oldname, newname string) error {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	source := (&url.URL{Path: fs.config.S3Bucket + "/" + s3Key(oldname)}).EscapedPath()
+
+	_, err := fs.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(fs.config.S3Bucket),
+		Key:        aws.String(s3Key(newname)),
+		CopySource: aws.String(source),
+	})
+	if err != nil {
+		return s3Error(err, "rename", oldname)
+	}
+
+	_, err = fs.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(fs.config.S3Bucket),
+		Key:    aws.String(s3Key(oldname)),
+	})
+
+	return s3Error(err, "rename", oldname)
+}
+
+func (fs *S3FileServer) WriteFile(ctx context.Context, filePath string, data []byte) error {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	_, err := fs.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(fs.config.S3Bucket),
+		Key:    aws.String(s3Key(filePath)),
+		Body:   bytes.NewReader(data),
+	})
+
+	return s3Error(err, "write", filePath)
+}
+
+func (fs *S3FileServer) Stat(ctx context.Context, filePath string) (fs.FileInfo, error) {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	head, err := fs.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(fs.config.S3Bucket),
+		Key:    aws.String(s3Key(filePath)),
+	})
+	if err != nil {
+		return nil, s3Error(err, "stat", filePath)
+	}
+
+	return &s3FileInfo{name: path.Base(filePath), head: head}, nil
+}
+
+// S3 has no file locking, the file is locked with a lock object next to it, created with a conditional
+// write when S3ConditionalWrites is enabled.
+func (fs *S3FileServer) AcquireLock(ctx context.Context, filePath string) (Locker, error) {
+	lock, err := fs.locker.acquire(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another replica could have processed the file before releasing the lock.
+	if _, err := fs.Stat(ctx, filePath); err != nil {
+		if unlockErr := lock.Unlock(); unlockErr != nil {
+			logger.Warningf("Failed to release the lock of '%s', %s", filePath, unlockErr)
+		}
+
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// Check if the bucket exists and is accessible.
+func (fs *S3FileServer) HealthCheck(ctx context.Context) error {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	_, err := fs.client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(fs.config.S3Bucket)})
+
+	return err
+}
+
+func (fs *S3FileServer) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if fs.config.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, fs.config.Timeout)
+}
+
+func s3Key(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filePath), "/")
+}
+
+// S3 reports a missing object with NoSuchKey, or only the 404 status on HEAD requests, which are converted
+// to a not exist error.
+func s3Error(err error, op, filePath string) error {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && (reqErr.StatusCode() == http.StatusNotFound || reqErr.Code() == s3.ErrCodeNoSuchKey) {
+		return &os.PathError{Op: op, Path: filePath, Err: os.ErrNotExist}
+	}
+
+	return err
+}
+
+// Object metadata returned by the HEAD request.
+type s3FileInfo struct {
+	name string
+	head *s3.HeadObjectOutput
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return aws.Int64Value(i.head.ContentLength) }
+func (i *s3FileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i *s3FileInfo) ModTime() time.Time { return aws.TimeValue(i.head.LastModified) }
+func (i *s3FileInfo) IsDir() bool        { return false }
+func (i *s3FileInfo) Sys() interface{}   { return i.head }
+
+// Remote object read by a ranged request from the current offset, a seek to another offset closes
+// the response body and the next read sends a new request.
+type s3Reader struct {
+	ctx    context.Context
+	server *S3FileServer
+	path   string
+	etag   *string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+	// Cancels the request of the current body
+	cancel context.CancelFunc
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		if err := r.start(); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+
+	err := r.withTimeout(func() error {
+		var err error
+		n, err = r.body.Read(p)
+
+		return err
+	})
+	r.offset += int64(n)
+
+	return n, err
+}
+
+func (r *s3Reader) start() error {
+	ctx, cancel := context.WithCancel(r.ctx)
+
+	var output *s3.GetObjectOutput
+
+	err := r.withTimeoutCancel(cancel, func() error {
+		var err error
+		output, err = r.server.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(r.server.config.S3Bucket),
+			Key:     aws.String(s3Key(r.path)),
+			Range:   aws.String("bytes=" + strconv.FormatInt(r.offset, 10) + "-"),
+			IfMatch: r.etag,
+		})
+
+		return err
+	})
+	if err != nil {
+		cancel()
+
+		return s3Error(err, "read", r.path)
+	}
+
+	r.body = output.Body
+	r.cancel = cancel
+
+	return nil
+}
+
+func (r *s3Reader) withTimeout(fn func() error) error {
+	return r.withTimeoutCancel(r.cancel, fn)
+}
+
+// The request is canceled when fn doesn't return within the operation timeout.
+func (r *s3Reader) withTimeoutCancel(cancel context.CancelFunc, fn func() error) error {
+	if r.server.config.Timeout <= 0 {
+		return fn()
+	}
+
+	timer := time.AfterFunc(r.server.config.Timeout, cancel)
+	err := fn()
+
+	// The timer can't be stopped once it has fired, then the request was canceled.
+	if !timer.Stop() {
+		return errors.Wrapf(context.DeadlineExceeded, "s3 read '%s'", r.path)
+	}
+
+	return err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.offset, errors.New("s3 seek: invalid whence")
+	}
+
+	if offset < 0 {
+		return r.offset, errors.New("s3 seek: negative position")
+	}
+
+	if offset != r.offset {
+		r.stop()
+		r.offset = offset
+	}
+
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	r.stop()
+
+	return nil
+}
+
+func (r *s3Reader) stop() {
+	if r.body == nil {
+		return
+	}
+
+	r.body.Close()
+	r.cancel()
+
+	r.body = nil
+	r.cancel = nil
+}
+
+// Lock objects at the bucket. With conditional writes the lock is created with If-None-Match: *, which S3
+// rejects when the object exists. Otherwise the object is checked before the write and read back after it,
+// which narrows, but doesn't close, the window where two owners create the same lock.
+type s3LockStore struct {
+	server *S3FileServer
+}
+
+func (s s3LockStore) CreateExclusive(lockPath string, data []byte) error {
+	if !s.server.config.S3ConditionalWrites {
+		return s.createChecked(lockPath, data)
+	}
+
+	ctx, cancel := s.server.withTimeout(context.Background())
+	defer cancel()
+
+	req, _ := s.server.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(s.server.config.S3Bucket),
+		Key:    aws.String(s3Key(lockPath)),
+		Body:   bytes.NewReader(data),
+	})
+	req.SetContext(ctx)
+	req.HTTPRequest.Header.Set("If-None-Match", "*")
+
+	return req.Send()
+}
+
+func (s s3LockStore) createChecked(lockPath string, data []byte) error {
+	ctx := context.Background()
+
+	if _, err := s.server.Stat(ctx, lockPath); err == nil {
+		return &os.PathError{Op: "create", Path: lockPath, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := s.WriteFile(lockPath, data); err != nil {
+		return err
+	}
+
+	current, _, err := s.ReadFile(lockPath)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(current, data) {
+		return errors.Wrapf(ErrLockRaceLost, "'%s'", lockPath)
+	}
+
+	return nil
+}
+
+func (s s3LockStore) ReadFile(lockPath string) ([]byte, time.Time, error) {
+	ctx, cancel := s.server.withTimeout(context.Background())
+	defer cancel()
+
+	output, err := s.server.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.server.config.S3Bucket),
+		Key:    aws.String(s3Key(lockPath)),
+	})
+	if err != nil {
+		return nil, time.Time{}, s3Error(err, "read", lockPath)
+	}
+
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+
+	return data, aws.TimeValue(output.LastModified), err
+}
+
+func (s s3LockStore) WriteFile(lockPath string, data []byte) error {
+	return s.server.WriteFile(context.Background(), lockPath, data)
+}
+
+func (s s3LockStore) Remove(lockPath string) error {
+	return s.server.Remove(context.Background(), lockPath)
+}
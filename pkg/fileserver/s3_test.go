@@ -0,0 +1,243 @@
+package fileserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBucket = "collector"
+
+// In-memory S3 server, gofakes3 doesn't support conditional writes, so If-None-Match: * is checked before
+// the PUT requests.
+func startS3Server(t *testing.T) (Config, *s3mem.Backend) {
+	t.Helper()
+
+	backend := s3mem.New()
+	assert.Nil(t, backend.CreateBucket(testBucket))
+
+	handler := gofakes3.New(backend).Server()
+
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("If-None-Match") != "*" {
+			handler.ServeHTTP(w, r)
+
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/")
+		if _, err := backend.HeadObject(testBucket, key); err == nil {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = w.Write([]byte(`<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`))
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return Config{
+		Type:                "s3",
+		S3Bucket:            testBucket,
+		S3Region:            "us-east-1",
+		S3Endpoint:          server.URL,
+		S3PathStyle:         true,
+		S3AccessKeyID:       "collector",
+		S3SecretAccessKey:   "secret",
+		S3ConditionalWrites: true,
+		Timeout:             5 * time.Second,
+		LockLease:           time.Minute,
+	}, backend
+}
+
+func writeTestObjects(t *testing.T, backend *s3mem.Backend, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		data := []byte("0123456789")
+		_, err := backend.PutObject(testBucket, key, map[string]string{}, bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+	}
+}
+
+func newS3Sut(t *testing.T, cfg Config) *S3FileServer {
+	t.Helper()
+
+	sut, err := NewS3FileServer(cfg)
+	assert.Nil(t, err)
+
+	return sut
+}
+
+func TestS3GlobShouldMatchPatternDepth(t *testing.T) {
+	// Prepare
+	cfg, backend := startS3Server(t)
+	writeTestObjects(t, backend, "in/a.csv", "in/b.txt", "in/sub/c.csv", "in/sub/deep/d.csv", "in/e.csv.lock")
+
+	// Arrange
+	sut := newS3Sut(t, cfg)
+
+	tests := []struct {
+		pattern  string
+		excludes []string
+		expected []string
+	}{
+		{pattern: "/in/*.csv", expected: []string{"/in/a.csv"}},
+		{pattern: "in/*.csv", expected: []string{"in/a.csv"}},
+		{pattern: "/in/*/*.csv", expected: []string{"/in/sub/c.csv"}},
+		{pattern: "/in/**/*.csv", expected: []string{"/in/a.csv", "/in/sub/c.csv", "/in/sub/deep/d.csv"}},
+		{pattern: "/in/**/*.csv", excludes: []string{"/in/sub/deep"}, expected: []string{"/in/a.csv", "/in/sub/c.csv"}},
+		{pattern: "/missing/*.csv", expected: []string{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			// Action
+			files, err := sut.Glob(context.Background(), tc.pattern, tc.excludes...)
+
+			// Assert
+			assert.Nil(t, err)
+			assert.ElementsMatch(t, tc.expected, files)
+		})
+	}
+}
+
+func TestS3OpenShouldSupportSeek(t *testing.T) {
+	// Prepare
+	cfg, backend := startS3Server(t)
+	writeTestObjects(t, backend, "in/a.csv")
+
+	// Arrange
+	sut := newS3Sut(t, cfg)
+
+	file, err := sut.Open(context.Background(), "/in/a.csv")
+	assert.Nil(t, err)
+
+	defer file.Close()
+
+	// Action
+	all, err := io.ReadAll(file)
+	assert.Nil(t, err)
+
+	position, err := file.Seek(-4, io.SeekEnd)
+	assert.Nil(t, err)
+
+	tail, err := io.ReadAll(file)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, "0123456789", string(all))
+	assert.Equal(t, int64(6), position)
+	assert.Equal(t, "6789", string(tail))
+}
+
+func TestS3OpenShouldNotReadWhenContextIsDone(t *testing.T) {
+	// Prepare
+	cfg, backend := startS3Server(t)
+	writeTestObjects(t, backend, "in/a.csv")
+
+	// Arrange
+	sut := newS3Sut(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	file, err := sut.Open(ctx, "/in/a.csv")
+	assert.Nil(t, err)
+
+	defer file.Close()
+
+	// Action
+	cancel()
+
+	data, err := io.ReadAll(file)
+
+	// Assert
+	assert.NotNil(t, err)
+	assert.Empty(t, data)
+}
+
+func TestS3MoveShouldCopyAndRemoveObject(t *testing.T) {
+	// Prepare
+	cfg, backend := startS3Server(t)
+	writeTestObjects(t, backend, "in/a file.csv")
+
+	// Arrange
+	sut := newS3Sut(t, cfg)
+
+	// Action
+	err := sut.Move(context.Background(), "/in/a file.csv", "/done/2022/a file.csv")
+
+	// Assert
+	assert.Nil(t, err)
+
+	info, err := sut.Stat(context.Background(), "/done/2022/a file.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "a file.csv", info.Name())
+	assert.Equal(t, int64(10), info.Size())
+
+	_, err = sut.Stat(context.Background(), "/in/a file.csv")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestS3LockShouldBeExclusiveBetweenReplicas(t *testing.T) {
+	tests := []struct {
+		name        string
+		conditional bool
+	}{
+		{name: "conditional writes", conditional: true},
+		{name: "lock object check", conditional: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Prepare
+			cfg, backend := startS3Server(t)
+			writeTestObjects(t, backend, "in/a.csv")
+
+			// Arrange
+			cfg.S3ConditionalWrites = tc.conditional
+
+			cfg.LockOwner = "replica-1"
+			first := newS3Sut(t, cfg)
+
+			cfg.LockOwner = "replica-2"
+			second := newS3Sut(t, cfg)
+
+			lock, err := first.AcquireLock(context.Background(), "/in/a.csv")
+			assert.Nil(t, err)
+
+			// Action
+			_, err = second.AcquireLock(context.Background(), "/in/a.csv")
+
+			// Assert
+			assert.ErrorIs(t, err, ErrFileLocked)
+
+			files, err := second.Glob(context.Background(), "/in/*")
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"/in/a.csv"}, files)
+
+			assert.Nil(t, lock.Unlock())
+
+			_, err = first.Stat(context.Background(), lockFilePath("/in/a.csv"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
@@ -5,18 +5,31 @@ import (
 	"io"
 	"io/fs"
 	"net"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/pkg/sftp"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
 	"golang.org/x/crypto/ssh"
 )
 
+const (
+	defaultConnections  = 4
+	minConnections      = 2
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// SFTP file server safe for concurrent use, the operations share a bounded pool of connections.
 type SFTPFileServer struct {
 	config       Config
 	KeyExchanges []string
-	sshClient    *ssh.Client
-	sftpClient   *sftp.Client
+	sshConfig    *ssh.ClientConfig
+	agent        *sshAgent
+	pool         *sftpPool
+	locker       *fileLocker
 }
 
 func NewSFTP(cfg Config, keyExchanges ...string) (*SFTPFileServer, error) {
@@ -25,27 +38,79 @@ func NewSFTP(cfg Config, keyExchanges ...string) (*SFTPFileServer, error) {
 		KeyExchanges: keyExchanges,
 	}
 
-	if err := client.connect(); err != nil {
+	sshConfig, agent, err := sshClientConfig(cfg, keyExchanges)
+	if err != nil {
+		return nil, err
+	}
+
+	client.sshConfig = sshConfig
+	client.agent = agent
+
+	if err := client.init(client.dial); err != nil {
+		agent.Close()
+
 		return nil, err
 	}
 
 	return client, nil
 }
 
-func (fs *SFTPFileServer) Glob(ctx context.Context, pattern string) ([]string, error) {
-	if err := fs.connect(); err != nil {
-		return nil, err
+func (fs *SFTPFileServer) init(dial sftpDialer) error {
+	size := fs.config.MaxConnections
+	if size <= 0 {
+		size = defaultConnections
 	}
 
+	fs.pool = newSFTPPool(dial, size, retry.Policy{
+		MaxAttempts: fs.config.ReconnectAttempts,
+		BaseBackoff: fs.config.ReconnectBackoff,
+		MaxBackoff:  maxReconnectBackoff,
+		Jitter:      0.2,
+	})
+	fs.locker = newFileLocker(sftpLockStore{server: fs}, fs.config.LockOwner, fs.config.LockLease)
+
+	// The first connection checks the server address and the credentials.
+	return fs.HealthCheck(context.Background())
+}
+
+// Return the files matching the pattern, ignoring the ones matching any exclude pattern.
+func (fs *SFTPFileServer) Glob(ctx context.Context, pattern string, exclude ...string) ([]string, error) {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	var files []string
+
+	err := fs.pool.run(ctx, func(client *sftp.Client) error {
+		var err error
+
+		if isRecursivePattern(pattern) {
+			files, err = walk(client, pattern, exclude)
+
+			return err
+		}
+
+		files, err = glob(client, pattern, exclude)
+
+		return err
+	})
+
+	return files, err
+}
+
+func glob(client *sftp.Client, pattern string, excludes []string) ([]string, error) {
 	files := []string{}
 
-	matchs, err := fs.sftpClient.Glob(pattern)
+	matchs, err := client.Glob(pattern)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, match := range matchs {
-		if f, _ := fs.sftpClient.Stat(match); !f.IsDir() {
+		if isLockFile(match) || isExcluded(match, excludes) {
+			continue
+		}
+
+		if f, err := client.Stat(match); err == nil && !f.IsDir() {
 			files = append(files, match)
 		}
 	}
@@ -53,96 +118,271 @@ func (fs *SFTPFileServer) Glob(ctx context.Context, pattern string) ([]string, e
 	return files, nil
 }
 
+// Walk through the pattern base directory matching each file, excluded directories are skipped.
+func walk(client *sftp.Client, pattern string, excludes []string) ([]string, error) {
+	files := []string{}
+	walker := client.Walk(GlobBase(pattern))
+
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		fp := walker.Path()
+
+		if isExcluded(fp, excludes) {
+			if walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+
+			continue
+		}
+
+		if !walker.Stat().IsDir() && !isLockFile(fp) && matchPattern(pattern, fp) {
+			files = append(files, fp)
+		}
+	}
+
+	return files, nil
+}
+
+// Open the file for reading, its connection is kept out of the pool until the file is closed.
 func (fs *SFTPFileServer) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, error) {
-	if err := fs.connect(); err != nil {
+	openCtx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	var file *sftp.File
+
+	conn, err := fs.pool.hold(openCtx, func(client *sftp.Client) error {
+		var err error
+		file, err = client.Open(filePath)
+
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return fs.sftpClient.Open(filePath)
+	return &sftpFile{File: file, ctx: ctx, timeout: fs.withTimeout, conn: conn, pool: fs.pool}, nil
 }
 
 func (fs *SFTPFileServer) Remove(ctx context.Context, filePath string) error {
-	if err := fs.connect(); err != nil {
-		return err
-	}
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
 
-	return fs.sftpClient.Remove(filePath)
+	return fs.pool.run(ctx, func(client *sftp.Client) error {
+		return client.Remove(filePath)
+	})
 }
 
 func (fs *SFTPFileServer) Move(ctx context.Context, oldname, newname string) error {
-	if err := fs.connect(); err != nil {
-		return err
-	}
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
 
-	dirName, _ := filepath.Split(newname)
-	if err := fs.sftpClient.MkdirAll(dirName); err != nil {
-		return err
-	}
+	return fs.pool.run(ctx, func(client *sftp.Client) error {
+		dirName, _ := filepath.Split(newname)
+		if err := client.MkdirAll(dirName); err != nil {
+			return err
+		}
 
-	if err := fs.sftpClient.MkdirAll(dirName); err != nil {
-		return err
-	}
+		return client.Rename(oldname, newname)
+	})
+}
 
-	return fs.sftpClient.Rename(oldname, newname)
+func (fs *SFTPFileServer) WriteFile(ctx context.Context, filePath string, data []byte) error {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	return fs.pool.run(ctx, func(client *sftp.Client) error {
+		dirName, _ := filepath.Split(filePath)
+		if err := client.MkdirAll(dirName); err != nil {
+			return err
+		}
+
+		file, err := client.Create(filePath)
+		if err != nil {
+			return err
+		}
+
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+
+			return err
+		}
+
+		return file.Close()
+	})
 }
 
 func (fs *SFTPFileServer) Stat(ctx context.Context, filePath string) (fs.FileInfo, error) {
-	if err := fs.connect(); err != nil {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	var info os.FileInfo
+
+	err := fs.pool.run(ctx, func(client *sftp.Client) error {
+		var err error
+		info, err = client.Stat(filePath)
+
+		return err
+	})
+
+	return info, err
+}
+
+// SFTP has no native file locking, the file is locked with a lock file next to it, which is shared
+// by the replicas reading the same directory. The lock files are ignored by Glob.
+func (fs *SFTPFileServer) AcquireLock(ctx context.Context, filePath string) (Locker, error) {
+	lock, err := fs.locker.acquire(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another replica could have processed the file before releasing the lock.
+	if _, err := fs.Stat(ctx, filePath); err != nil {
+		if unlockErr := lock.Unlock(); unlockErr != nil {
+			logger.Warningf("Failed to release the lock of '%s', %s", filePath, unlockErr)
+		}
+
 		return nil, err
 	}
 
-	return fs.sftpClient.Stat(filePath)
+	return lock, nil
 }
 
-func (fs *SFTPFileServer) Lock(ctx context.Context, filePath string) error {
-	return nil
+// Check if the server answers a request, reconnecting when the connection was lost.
+func (fs *SFTPFileServer) HealthCheck(ctx context.Context) error {
+	ctx, cancel := fs.withTimeout(ctx)
+	defer cancel()
+
+	return fs.pool.run(ctx, func(client *sftp.Client) error {
+		_, err := client.Getwd()
+
+		return err
+	})
 }
 
-func (fs *SFTPFileServer) Unlock(ctx context.Context, filepath string) error {
+// Close the idle connections and the ssh-agent, the connections in use are closed when their operation finishes.
+func (fs *SFTPFileServer) Close() error {
+	fs.pool.close()
+	fs.agent.Close()
+
 	return nil
 }
 
-func (fs *SFTPFileServer) connect() error {
-	if fs.sshClient != nil {
-		_, _, err := fs.sshClient.SendRequest("keepalive", true, nil)
-		if err == nil {
-			return nil
-		}
+// Limit the operation by the configured timeout, besides the context deadline.
+func (fs *SFTPFileServer) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if fs.config.Timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
 
-	auth := ssh.Password(fs.config.Password)
+	return context.WithTimeout(ctx, fs.config.Timeout)
+}
 
-	if fs.config.PrivateKey != "" {
-		signer, err := ssh.ParsePrivateKey([]byte(fs.config.PrivateKey))
-		if err != nil {
-			return errors.Wrapf(err, "ssh parse private key: %s", ErrConnectionFailed)
-		}
+// Open a SSH connection and start its SFTP session.
+func (fs *SFTPFileServer) dial(ctx context.Context) (*sftpConn, error) {
+	var dialer net.Dialer
 
-		auth = ssh.PublicKeys(signer)
+	netConn, err := dialer.DialContext(ctx, "tcp", fs.config.Server)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ssh dial: %s", ErrConnectionFailed)
 	}
 
-	cfg := &ssh.ClientConfig{
-		User:            fs.config.User,
-		Auth:            []ssh.AuthMethod{auth},
-		HostKeyCallback: hostKeyCallback,
+	// The handshake isn't canceled by the context, so it is limited by the connection deadline.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = netConn.SetDeadline(deadline)
 	}
 
-	sshclient, err := ssh.Dial("tcp", fs.config.Server, cfg)
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, fs.config.Server, fs.sshConfig)
 	if err != nil {
-		return errors.Wrapf(err, "ssh dial: %s", ErrConnectionFailed)
+		netConn.Close()
+
+		return nil, errors.Wrapf(err, "ssh dial: %s", ErrConnectionFailed)
 	}
 
-	SFTPFileServer, err := sftp.NewClient(sshclient)
+	_ = netConn.SetDeadline(time.Time{})
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	options := []sftp.ClientOption{}
+	if fs.config.MaxConcurrentRequests > 0 {
+		options = append(options, sftp.MaxConcurrentRequestsPerFile(fs.config.MaxConcurrentRequests))
+	}
+
+	sftpClient, err := sftp.NewClient(sshClient, options...)
 	if err != nil {
-		return errors.Wrapf(err, "sftp new client: %s", ErrConnectionFailed)
+		sshClient.Close()
+
+		return nil, errors.Wrapf(err, "sftp new client: %s", ErrConnectionFailed)
 	}
 
-	fs.sshClient = sshclient
-	fs.sftpClient = SFTPFileServer
+	return &sftpConn{ssh: sshClient, sftp: sftpClient}, nil
+}
 
-	return nil
+// Lock files stored at the SFTP server.
+type sftpLockStore struct {
+	server *SFTPFileServer
 }
 
-func hostKeyCallback(_ string, _ net.Addr, _ ssh.PublicKey) error {
-	return nil
+func (s sftpLockStore) CreateExclusive(path string, data []byte) error {
+	ctx, cancel := s.server.withTimeout(context.Background())
+	defer cancel()
+
+	return s.server.pool.run(ctx, func(client *sftp.Client) error {
+		file, err := client.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		if err != nil {
+			return err
+		}
+
+		if _, err := file.Write(data); err != nil {
+			// A lock file created without its lease would block the file until it expires.
+			file.Close()
+			_ = client.Remove(path)
+
+			return err
+		}
+
+		return file.Close()
+	})
+}
+
+func (s sftpLockStore) ReadFile(path string) ([]byte, time.Time, error) {
+	ctx, cancel := s.server.withTimeout(context.Background())
+	defer cancel()
+
+	var (
+		data    []byte
+		modTime time.Time
+	)
+
+	err := s.server.pool.run(ctx, func(client *sftp.Client) error {
+		file, err := client.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		modTime = info.ModTime()
+		data, err = io.ReadAll(file)
+
+		return err
+	})
+
+	return data, modTime, err
+}
+
+func (s sftpLockStore) WriteFile(path string, data []byte) error {
+	return s.server.WriteFile(context.Background(), path, data)
+}
+
+func (s sftpLockStore) Remove(path string) error {
+	return s.server.Remove(context.Background(), path)
 }
@@ -0,0 +1,298 @@
+package fileserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrPoolClosed = errors.New("sftp connection pool is closed")
+
+// SSH connection with its SFTP session, the ssh client isn't set when the session runs over a pipe.
+type sftpConn struct {
+	ssh  *ssh.Client
+	sftp *sftp.Client
+}
+
+// The SSH connection is closed first, the SFTP client waits for its pending requests while the transport is open.
+func (c *sftpConn) close() {
+	if c.ssh != nil {
+		c.ssh.Close()
+	}
+
+	c.sftp.Close()
+}
+
+type sftpDialer func(ctx context.Context) (*sftpConn, error)
+
+// Bounded pool of SFTP sessions shared by the file server operations. A connection is opened only when
+// there isn't an idle one, up to the pool size, and a lost connection is discarded and replaced.
+// The files being read hold a connection until they are closed, so one connection is kept for the
+// short operations, like the lock renewals, Stat and Glob.
+type sftpPool struct {
+	dial  sftpDialer
+	retry retry.Policy
+	// Holds a value for each borrowed connection, so the open connections never exceed its capacity
+	slots chan struct{}
+	// Holds a value for each connection held by a file, its capacity is one less than the pool size
+	holders chan struct{}
+	mu      sync.Mutex
+	idle    []*sftpConn
+	closed  bool
+}
+
+func newSFTPPool(dial sftpDialer, size int, reconnect retry.Policy) *sftpPool {
+	if size < minConnections {
+		size = minConnections
+	}
+
+	return &sftpPool{
+		dial:    dial,
+		retry:   reconnect,
+		slots:   make(chan struct{}, size),
+		holders: make(chan struct{}, size-1),
+	}
+}
+
+// Run fn with a connection of the pool, fn runs again with a new connection when the connection was lost.
+// When the context is done first, the connection is closed to interrupt fn.
+func (p *sftpPool) run(ctx context.Context, fn func(*sftp.Client) error) error {
+	conn, err := p.borrow(ctx, fn)
+	if err != nil {
+		return err
+	}
+
+	p.put(conn, false)
+
+	return nil
+}
+
+// Like run, but the connection is kept after fn succeeds, it must be returned to the pool with release.
+// It waits while the other connections are held, so the short operations always have one.
+func (p *sftpPool) hold(ctx context.Context, fn func(*sftp.Client) error) (*sftpConn, error) {
+	select {
+	case p.holders <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	conn, err := p.borrow(ctx, fn)
+	if err != nil {
+		<-p.holders
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Return a held connection to the pool.
+func (p *sftpPool) release(conn *sftpConn, broken bool) {
+	p.put(conn, broken)
+	<-p.holders
+}
+
+// Run fn with a connection, which is kept when fn succeeds.
+func (p *sftpPool) borrow(ctx context.Context, fn func(*sftp.Client) error) (*sftpConn, error) {
+	for attempt := 1; ; attempt++ {
+		conn, err := p.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		err = call(ctx, conn, fn)
+		if err == nil {
+			return conn, nil
+		}
+
+		lost := ctx.Err() != nil || isConnectionLost(err)
+		p.put(conn, lost)
+
+		if !lost || ctx.Err() != nil || attempt > 1 {
+			return nil, err
+		}
+
+		logger.Warningf("SFTP connection lost, trying again with a new connection, %s", err)
+	}
+}
+
+// Borrow an idle connection or open a new one, waiting while all the connections are borrowed.
+func (p *sftpPool) get(ctx context.Context) (*sftpConn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+
+		return nil, ErrPoolClosed
+	}
+
+	if n := len(p.idle); n > 0 {
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		return conn, nil
+	}
+
+	p.mu.Unlock()
+
+	var conn *sftpConn
+
+	err := p.retry.Do(ctx, func(attempt int) error {
+		var err error
+
+		conn, err = p.dial(ctx)
+		if err != nil && attempt < p.retry.MaxAttempts {
+			logger.Warningf("Attempt %d/%d to connect to the SFTP server failed, %s", attempt, p.retry.MaxAttempts, err)
+		}
+
+		return err
+	})
+	if err != nil {
+		<-p.slots
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Return a borrowed connection, a broken connection is closed.
+func (p *sftpPool) put(conn *sftpConn, broken bool) {
+	defer func() { <-p.slots }()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if broken || p.closed {
+		conn.close()
+
+		return
+	}
+
+	p.idle = append(p.idle, conn)
+}
+
+// Close the idle connections, the borrowed ones are closed when they are returned.
+func (p *sftpPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	for _, conn := range p.idle {
+		conn.close()
+	}
+
+	p.idle = nil
+}
+
+// The SFTP client doesn't support contexts, so the connection is closed to interrupt a canceled call.
+func call(ctx context.Context, conn *sftpConn, fn func(*sftp.Client) error) error {
+	if ctx.Done() == nil {
+		return fn(conn.sftp)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn(conn.sftp)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		conn.close()
+		<-done
+
+		return ctx.Err()
+	}
+}
+
+func isConnectionLost(err error) bool {
+	var netErr net.Error
+
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &netErr)
+}
+
+// File of a pooled connection, the connection is returned to the pool when the file is closed.
+// The reads are bound to the context of Open and the operation timeout, the connection is closed
+// to interrupt them.
+type sftpFile struct {
+	*sftp.File
+	ctx     context.Context
+	timeout func(context.Context) (context.Context, context.CancelFunc)
+	conn    *sftpConn
+	pool    *sftpPool
+	broken  bool
+	once    sync.Once
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	var n int
+
+	err := f.call(func() error {
+		var err error
+		n, err = f.File.Read(p)
+
+		return err
+	})
+
+	return n, err
+}
+
+// The end offset is read from the server.
+func (f *sftpFile) Seek(offset int64, whence int) (int64, error) {
+	var position int64
+
+	err := f.call(func() error {
+		var err error
+		position, err = f.File.Seek(offset, whence)
+
+		return err
+	})
+
+	return position, err
+}
+
+func (f *sftpFile) call(fn func() error) error {
+	ctx, cancel := f.timeout(f.ctx)
+	defer cancel()
+
+	err := call(ctx, f.conn, func(*sftp.Client) error { return fn() })
+	if err != nil && ctx.Err() != nil {
+		f.broken = true
+	}
+
+	return err
+}
+
+func (f *sftpFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(func() { f.pool.release(f.conn, f.broken) })
+
+	return err
+}
@@ -0,0 +1,231 @@
+package fileserver
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/retry"
+)
+
+// Server side of a pipe connection.
+type pipeConn struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (c pipeConn) Close() error {
+	c.PipeReader.Close()
+
+	return c.PipeWriter.Close()
+}
+
+// Open SFTP sessions served in memory, over the local file system, counting the dials.
+func pipeDialer(t *testing.T, dials *int32) sftpDialer {
+	t.Helper()
+
+	return func(ctx context.Context) (*sftpConn, error) {
+		clientReader, serverWriter := io.Pipe()
+		serverReader, clientWriter := io.Pipe()
+
+		server, err := sftp.NewServer(pipeConn{serverReader, serverWriter})
+		if err != nil {
+			return nil, err
+		}
+
+		// The server doesn't close the pipe when the client closes, which the client waits for.
+		go func() {
+			_ = server.Serve()
+			server.Close()
+		}()
+
+		client, err := sftp.NewClientPipe(clientReader, clientWriter)
+		if err != nil {
+			return nil, err
+		}
+
+		atomic.AddInt32(dials, 1)
+
+		return &sftpConn{sftp: client}, nil
+	}
+}
+
+func getwd(client *sftp.Client) error {
+	_, err := client.Getwd()
+
+	return err
+}
+
+func TestSFTPPoolShouldNotOpenMoreConnectionsThanItsSize(t *testing.T) {
+	// Prepare
+	var dials, running, maxRunning int32
+
+	// Arrange
+	sut := newSFTPPool(pipeDialer(t, &dials), 2, retry.Policy{})
+	defer sut.close()
+
+	wg := sync.WaitGroup{}
+
+	// Action
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := sut.run(context.Background(), func(client *sftp.Client) error {
+				current := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+						break
+					}
+				}
+
+				time.Sleep(10 * time.Millisecond)
+
+				return getwd(client)
+			})
+			assert.Nil(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxRunning))
+}
+
+func TestSFTPPoolShouldReplaceLostConnection(t *testing.T) {
+	// Prepare
+	var dials int32
+
+	// Arrange
+	sut := newSFTPPool(pipeDialer(t, &dials), 1, retry.Policy{})
+	defer sut.close()
+
+	assert.Nil(t, sut.run(context.Background(), getwd))
+	sut.idle[0].sftp.Close()
+
+	// Action
+	err := sut.run(context.Background(), getwd)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+}
+
+func TestSFTPPoolShouldInterruptCallWhenContextIsDone(t *testing.T) {
+	// Prepare
+	var dials int32
+
+	// Arrange
+	sut := newSFTPPool(pipeDialer(t, &dials), 1, retry.Policy{})
+	defer sut.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Action
+	err := sut.run(ctx, func(client *sftp.Client) error {
+		// Blocks until the connection is closed.
+		return client.Wait()
+	})
+
+	// Assert
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, sut.run(context.Background(), getwd))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+}
+
+func TestSFTPGlobShouldIgnoreLockFiles(t *testing.T) {
+	// Prepare
+	var dials int32
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file.csv")
+	assert.Nil(t, os.WriteFile(filePath, []byte("a,b"), 0o644))
+
+	// Arrange
+	sut := &SFTPFileServer{config: Config{MaxConnections: 2, LockLease: time.Minute}}
+	assert.Nil(t, sut.init(pipeDialer(t, &dials)))
+
+	defer sut.Close()
+
+	lock, err := sut.AcquireLock(context.Background(), filePath)
+	assert.Nil(t, err)
+
+	// Action
+	files, err := sut.Glob(context.Background(), filepath.Join(dir, "*"))
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filePath}, files)
+	assert.FileExists(t, lockFilePath(filePath))
+
+	assert.Nil(t, lock.Unlock())
+	assert.NoFileExists(t, lockFilePath(filePath))
+}
+
+func TestSFTPPoolShouldKeepConnectionForShortOperations(t *testing.T) {
+	// Prepare
+	var dials int32
+
+	// Arrange
+	sut := newSFTPPool(pipeDialer(t, &dials), 2, retry.Policy{})
+	defer sut.close()
+
+	held, err := sut.hold(context.Background(), getwd)
+	assert.Nil(t, err)
+
+	defer sut.release(held, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Action
+	_, holdErr := sut.hold(ctx, getwd)
+	runErr := sut.run(context.Background(), getwd)
+
+	// Assert
+	assert.ErrorIs(t, holdErr, context.DeadlineExceeded)
+	assert.Nil(t, runErr)
+}
+
+func TestSFTPFileShouldInterruptReadWhenContextIsDone(t *testing.T) {
+	// Prepare
+	var dials int32
+
+	filePath := filepath.Join(t.TempDir(), "file.csv")
+	assert.Nil(t, os.WriteFile(filePath, []byte("a,b"), 0o644))
+
+	sut := &SFTPFileServer{config: Config{MaxConnections: 2}}
+	assert.Nil(t, sut.init(pipeDialer(t, &dials)))
+
+	defer sut.Close()
+
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+
+	file, err := sut.Open(ctx, filePath)
+	assert.Nil(t, err)
+
+	// Action
+	cancel()
+	_, err = io.ReadAll(file)
+
+	// Assert
+	assert.ErrorIs(t, err, context.Canceled)
+	file.Close()
+	assert.Nil(t, sut.HealthCheck(context.Background()))
+}
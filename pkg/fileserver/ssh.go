@@ -0,0 +1,242 @@
+package fileserver
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	ErrHostKeyMismatch      = errors.New("host key doesn't match the pinned fingerprints")
+	ErrHostKeyNotConfigured = errors.New("host key verification isn't configured")
+)
+
+// Client config of the SSH connections, the algorithms lists are only set when configured,
+// otherwise the library defaults are used. The ssh-agent is returned when it is used, it must be
+// closed with the file server.
+func sshClientConfig(cfg Config, keyExchanges []string) (*ssh.ClientConfig, *sshAgent, error) {
+	hostKey, err := sshHostKeyCallback(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth, agentClient, err := sshAuthMethods(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sshCfg := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+	}
+
+	if len(keyExchanges) == 0 {
+		keyExchanges = splitList(cfg.KeyExchanges)
+	}
+
+	sshCfg.KeyExchanges = nilIfEmpty(keyExchanges)
+	sshCfg.Ciphers = nilIfEmpty(splitList(cfg.Ciphers))
+	sshCfg.MACs = nilIfEmpty(splitList(cfg.MACs))
+	sshCfg.HostKeyAlgorithms = nilIfEmpty(splitList(cfg.HostKeyAlgorithms))
+
+	return sshCfg, agentClient, nil
+}
+
+// The methods are tried in order: ssh-agent, private key, password and keyboard-interactive,
+// which answers every question with the password.
+func sshAuthMethods(cfg Config) ([]ssh.AuthMethod, *sshAgent, error) {
+	methods := []ssh.AuthMethod{}
+
+	var agentClient *sshAgent
+
+	if cfg.UseAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, errors.Wrap(ErrConnectionFailed, "ssh agent: SSH_AUTH_SOCK is not set")
+		}
+
+		agentClient = &sshAgent{socket: socket}
+		if _, err := agentClient.Signers(); err != nil {
+			return nil, nil, err
+		}
+
+		methods = append(methods, ssh.PublicKeysCallback(agentClient.Signers))
+	}
+
+	privateKey := []byte(cfg.PrivateKey)
+
+	if cfg.PrivateKeyFile != "" {
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			agentClient.Close()
+
+			return nil, nil, errors.Wrapf(err, "ssh read private key: %s", ErrConnectionFailed)
+		}
+
+		privateKey = data
+	}
+
+	if len(privateKey) > 0 {
+		signer, err := parsePrivateKey(privateKey, cfg.PrivateKeyPassphrase)
+		if err != nil {
+			agentClient.Close()
+
+			return nil, nil, errors.Wrapf(err, "ssh parse private key: %s", ErrConnectionFailed)
+		}
+
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if cfg.Password != "" {
+		password := cfg.Password
+
+		methods = append(methods,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+
+				return answers, nil
+			}),
+		)
+	}
+
+	return methods, agentClient, nil
+}
+
+// Connection to the ssh-agent, dialed again when a request fails, e.g. after the agent restarted.
+type sshAgent struct {
+	socket string
+	mutex  sync.Mutex
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// Keys of the agent, used on each SSH handshake.
+func (a *sshAgent) Signers() ([]ssh.Signer, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// The second attempt is made on a new connection, the current one could be broken.
+	for attempt := 0; ; attempt++ {
+		if a.client == nil {
+			conn, err := net.Dial("unix", a.socket)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ssh agent: %s", ErrConnectionFailed)
+			}
+
+			a.conn, a.client = conn, agent.NewClient(conn)
+		}
+
+		signers, err := a.client.Signers()
+		if err == nil || attempt > 0 {
+			return signers, errors.Wrapf(err, "ssh agent: %s", ErrConnectionFailed)
+		}
+
+		a.close()
+	}
+}
+
+// Close the agent connection, a nil agent is ignored.
+func (a *sshAgent) Close() {
+	if a == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.close()
+}
+
+func (a *sshAgent) close() {
+	if a.conn != nil {
+		a.conn.Close()
+	}
+
+	a.conn, a.client = nil, nil
+}
+
+func parsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+	if passphrase == "" {
+		return ssh.ParsePrivateKey(key)
+	}
+
+	return ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+}
+
+// Verify the server key with the pinned fingerprints and the known_hosts files, a key matching a
+// fingerprint is accepted without checking the files. Without both any key is accepted only when
+// InsecureIgnoreHostKey is enabled, otherwise it fails.
+func sshHostKeyCallback(cfg Config) (ssh.HostKeyCallback, error) {
+	fingerprints := splitList(cfg.HostKeyFingerprints)
+	files := splitList(cfg.KnownHosts)
+
+	if len(fingerprints) == 0 && len(files) == 0 {
+		if !cfg.InsecureIgnoreHostKey {
+			return nil, errors.Wrap(
+				ErrHostKeyNotConfigured,
+				"set FILE_SERVER_KNOWN_HOSTS, FILE_SERVER_HOST_KEY_FINGERPRINTS or FILE_SERVER_INSECURE_IGNORE_HOST_KEY",
+			)
+		}
+
+		logger.Warningf("The SFTP server host key isn't verified, any key is accepted")
+
+		return ssh.InsecureIgnoreHostKey(), nil // nolint:gosec
+	}
+
+	var knownHosts ssh.HostKeyCallback
+
+	if len(files) > 0 {
+		callback, err := knownhosts.New(files...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ssh known hosts: %s", ErrConnectionFailed)
+		}
+
+		knownHosts = callback
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if matchFingerprint(key, fingerprints) {
+			return nil
+		}
+
+		if knownHosts != nil {
+			return knownHosts(hostname, remote, key)
+		}
+
+		return errors.Wrapf(ErrHostKeyMismatch, "'%s' has the key %s", hostname, ssh.FingerprintSHA256(key))
+	}, nil
+}
+
+// The fingerprints are informed like ssh-keygen -l, SHA256:<base64> or the legacy MD5 hex pairs.
+func matchFingerprint(key ssh.PublicKey, fingerprints []string) bool {
+	sha256 := ssh.FingerprintSHA256(key)
+	md5 := ssh.FingerprintLegacyMD5(key)
+
+	for _, fingerprint := range fingerprints {
+		if fingerprint == sha256 || strings.EqualFold(strings.TrimPrefix(fingerprint, "MD5:"), md5) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nilIfEmpty(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+
+	return list
+}
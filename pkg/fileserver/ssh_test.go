@@ -0,0 +1,176 @@
+package fileserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var testAddr = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22} // nolint:gochecknoglobals
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	key, err := ssh.NewPublicKey(pub)
+	assert.Nil(t, err)
+
+	return key
+}
+
+func TestHostKeyCallbackShouldAcceptOnlyPinnedFingerprints(t *testing.T) {
+	// Prepare
+	pinned := newHostKey(t)
+	other := newHostKey(t)
+
+	// Arrange
+	sut, err := sshHostKeyCallback(Config{HostKeyFingerprints: ssh.FingerprintSHA256(pinned)})
+	assert.Nil(t, err)
+
+	// Action
+	pinnedErr := sut("sftp.example.com:22", testAddr, pinned)
+	otherErr := sut("sftp.example.com:22", testAddr, other)
+
+	// Assert
+	assert.Nil(t, pinnedErr)
+	assert.ErrorIs(t, otherErr, ErrHostKeyMismatch)
+}
+
+func TestHostKeyCallbackShouldFailWhenVerificationIsNotConfigured(t *testing.T) {
+	// Action
+	_, err := sshHostKeyCallback(Config{})
+	insecure, insecureErr := sshHostKeyCallback(Config{InsecureIgnoreHostKey: true})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrHostKeyNotConfigured)
+	assert.Nil(t, insecureErr)
+	assert.Nil(t, insecure("sftp.example.com:22", testAddr, newHostKey(t)))
+}
+
+func TestHostKeyCallbackShouldCheckKnownHostsFile(t *testing.T) {
+	// Prepare
+	known := newHostKey(t)
+	other := newHostKey(t)
+
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize("sftp.example.com:22")}, known)
+	assert.Nil(t, os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600))
+
+	// Arrange
+	sut, err := sshHostKeyCallback(Config{KnownHosts: knownHostsFile})
+	assert.Nil(t, err)
+
+	// Action
+	knownErr := sut("sftp.example.com:22", testAddr, known)
+	otherErr := sut("sftp.example.com:22", testAddr, other)
+
+	// Assert
+	assert.Nil(t, knownErr)
+	assert.NotNil(t, otherErr)
+}
+
+func TestSSHClientConfigShouldApplyConfiguredAlgorithms(t *testing.T) {
+	// Arrange
+	cfg := Config{
+		User:         "collector",
+		Password:     "secret",
+		KeyExchanges: "diffie-hellman-group1-sha1",
+		Ciphers:      "aes128-cbc, 3des-cbc",
+		MACs:         "hmac-sha1",
+
+		InsecureIgnoreHostKey: true,
+	}
+
+	// Action
+	sshCfg, _, err := sshClientConfig(cfg, nil)
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"diffie-hellman-group1-sha1"}, sshCfg.KeyExchanges)
+	assert.Equal(t, []string{"aes128-cbc", "3des-cbc"}, sshCfg.Ciphers)
+	assert.Equal(t, []string{"hmac-sha1"}, sshCfg.MACs)
+	assert.Nil(t, sshCfg.HostKeyAlgorithms)
+	assert.Len(t, sshCfg.Auth, 2)
+}
+
+func TestSSHAuthMethodsShouldReadEncryptedPrivateKeyFile(t *testing.T) {
+	// Prepare
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	block, err := x509.EncryptPEMBlock( // nolint:staticcheck
+		rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), []byte("passphrase"), x509.PEMCipherAES256,
+	)
+	assert.Nil(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "id_rsa")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+
+	// Action
+	methods, _, err := sshAuthMethods(Config{PrivateKeyFile: keyFile, PrivateKeyPassphrase: "passphrase"})
+	_, _, wrongErr := sshAuthMethods(Config{PrivateKeyFile: keyFile, PrivateKeyPassphrase: "wrong"})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Len(t, methods, 1)
+	// The legacy PEM encryption detects a wrong passphrase only by the padding, which is valid by chance
+	// on some keys, then the decrypted key fails to parse instead.
+	assert.Contains(t, wrongErr.Error(), "ssh parse private key")
+}
+
+func TestSSHAgentShouldDialAgainWhenConnectionIsBroken(t *testing.T) {
+	// Prepare
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	keyring := agent.NewKeyring()
+	assert.Nil(t, keyring.Add(agent.AddedKey{PrivateKey: private}))
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() { _ = agent.ServeAgent(keyring, conn) }()
+		}
+	}()
+
+	// Arrange
+	sut := &sshAgent{socket: socket}
+	defer sut.Close()
+
+	_, err = sut.Signers()
+	assert.Nil(t, err)
+
+	sut.conn.Close()
+
+	// Action
+	signers, err := sut.Signers()
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Len(t, signers, 1)
+
+	sut.Close()
+	assert.Nil(t, sut.conn)
+}
@@ -0,0 +1,205 @@
+package fileserver
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+type watchedPattern struct {
+	pattern    string
+	absPattern string
+	base       string
+	recursive  bool
+}
+
+type localWatcher struct {
+	watcher  *fsnotify.Watcher
+	patterns []watchedPattern
+	excludes []string
+	events   chan models.WatchEvent
+}
+
+// Watch the directories of the patterns, sending the files created, written or moved into them
+// until the context is done. Patterns with globs on the directories watch all the subdirectories.
+func (fs *LocalFileServer) Watch(
+	ctx context.Context, patterns []string, exclude ...string,
+) (<-chan models.WatchEvent, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	lw := &localWatcher{
+		watcher: watcher,
+		events:  make(chan models.WatchEvent, 100),
+	}
+
+	for _, excludePattern := range exclude {
+		absExclude, err := filepath.Abs(excludePattern)
+		if err != nil {
+			watcher.Close()
+
+			return nil, err
+		}
+
+		lw.excludes = append(lw.excludes, absExclude)
+	}
+
+	for _, pattern := range patterns {
+		absPattern, err := filepath.Abs(pattern)
+		if err != nil {
+			watcher.Close()
+
+			return nil, err
+		}
+
+		base := GlobBase(absPattern)
+		wp := watchedPattern{
+			pattern:    pattern,
+			absPattern: absPattern,
+			base:       filepath.FromSlash(base),
+			recursive:  path.Dir(filepath.ToSlash(absPattern)) != base,
+		}
+		lw.patterns = append(lw.patterns, wp)
+
+		if err := lw.add(ctx, wp.base, wp.recursive, false); err != nil {
+			watcher.Close()
+
+			return nil, err
+		}
+	}
+
+	go lw.run(ctx)
+
+	return lw.events, nil
+}
+
+// Watch the directory, and all its subdirectories when recursive. The files found are only
+// sent for directories created after the watch started.
+func (lw *localWatcher) add(ctx context.Context, dir string, recursive, sendFiles bool) error {
+	if !recursive {
+		if err := lw.watcher.Add(dir); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	return filepath.WalkDir(dir, func(fp string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if isExcluded(fp, lw.excludes) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.IsDir() {
+			return lw.watcher.Add(fp)
+		}
+
+		if sendFiles {
+			lw.send(ctx, fp)
+		}
+
+		return nil
+	})
+}
+
+func (lw *localWatcher) run(ctx context.Context) {
+	defer close(lw.events)
+	defer lw.watcher.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case err, ok := <-lw.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			logger.Warningf("[Watcher] Error watching files, %s", err)
+
+		case event, ok := <-lw.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+
+			if info.IsDir() {
+				lw.addDir(ctx, event.Name)
+
+				continue
+			}
+
+			lw.send(ctx, event.Name)
+		}
+	}
+}
+
+// Start watching the directory created inside a recursive pattern base.
+func (lw *localWatcher) addDir(ctx context.Context, dir string) {
+	for _, wp := range lw.patterns {
+		if !wp.recursive || !isSubPath(wp.base, dir) {
+			continue
+		}
+
+		if err := lw.add(ctx, dir, true, true); err != nil {
+			logger.Warningf("[Watcher] Failed to watch directory '%s', %s", dir, err)
+		}
+
+		return
+	}
+}
+
+// Send the file with the first pattern that matches it.
+func (lw *localWatcher) send(ctx context.Context, filePath string) {
+	if isExcluded(filePath, lw.excludes) {
+		return
+	}
+
+	for _, wp := range lw.patterns {
+		if !matchPattern(wp.absPattern, filePath) {
+			continue
+		}
+
+		select {
+		case lw.events <- models.WatchEvent{FilePath: filePath, Pattern: wp.pattern}:
+		case <-ctx.Done():
+		}
+
+		return
+	}
+}
+
+func isSubPath(base, filePath string) bool {
+	rel, err := filepath.Rel(base, filePath)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,94 @@
+package fileserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+func receiveEvent(t *testing.T, events <-chan models.WatchEvent) models.WatchEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watch event")
+	}
+
+	return models.WatchEvent{}
+}
+
+func TestWatchShouldSendWrittenFiles(t *testing.T) {
+	// Prepare
+	sut := newSut()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Arrange
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "*.json")
+
+	events, err := sut.Watch(ctx, []string{pattern})
+	assert.Nil(t, err)
+
+	// Action
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("ignored"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "file.json"), []byte("{}"), 0o644))
+
+	// Assert
+	event := receiveEvent(t, events)
+	assert.Equal(t, filepath.Join(dir, "file.json"), event.FilePath)
+	assert.Equal(t, pattern, event.Pattern)
+}
+
+func TestWatchShouldWatchNewSubdirectoriesOfRecursivePatterns(t *testing.T) {
+	// Prepare
+	sut := newSut()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Arrange
+	dir := t.TempDir()
+	pattern := filepath.Join(dir, "**", "*.json")
+
+	events, err := sut.Watch(ctx, []string{pattern}, filepath.Join(dir, "tmp"))
+	assert.Nil(t, err)
+
+	// Action
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "tmp"), os.ModePerm))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tmp", "ignored.json"), []byte("{}"), 0o644))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "nested"), os.ModePerm))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "nested", "file.json"), []byte("{}"), 0o644))
+
+	// Assert
+	event := receiveEvent(t, events)
+	assert.Equal(t, filepath.Join(dir, "nested", "file.json"), event.FilePath)
+}
+
+func TestWatchShouldCloseEventsWhenContextIsDone(t *testing.T) {
+	// Prepare
+	sut := newSut()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Arrange
+	events, err := sut.Watch(ctx, []string{filepath.Join(t.TempDir(), "*.json")})
+	assert.Nil(t, err)
+
+	// Action
+	cancel()
+
+	// Assert
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the events channel to be closed")
+	}
+}
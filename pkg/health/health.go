@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type Checker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// Adapter to use ordinary functions as checkers.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) HealthCheck(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result of the checks, the status is ok only when every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Named checks, safe to be changed while they are running.
+type Checks struct {
+	sync.RWMutex
+	checks map[string]Checker
+}
+
+func NewChecks() *Checks {
+	return &Checks{checks: make(map[string]Checker)}
+}
+
+// Add the check, an existing check with the same name is replaced.
+func (c *Checks) Add(name string, checker Checker) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checks[name] = checker
+}
+
+func (c *Checks) Remove(name string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.checks, name)
+}
+
+// Run all the checks concurrently, each one is canceled when the timeout is reached.
+func (c *Checks) Run(ctx context.Context, timeout time.Duration) Report {
+	c.RLock()
+	checks := make(map[string]Checker, len(c.checks))
+	for name, checker := range c.checks {
+		checks[name] = checker
+	}
+	c.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]string, len(checks))}
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+
+	for name, checker := range checks {
+		wg.Add(1)
+
+		go func(name string, checker Checker) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			result := StatusOK
+			if err := checker.HealthCheck(checkCtx); err != nil {
+				result = err.Error()
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			report.Checks[name] = result
+			if result != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, checker)
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+// Handler responding the report as json, with status 503 when any check fails.
+func (c *Checks) Handler(timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context(), timeout)
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
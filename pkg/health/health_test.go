@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunShouldReportEachCheck(t *testing.T) {
+	// Arrange
+	sut := NewChecks()
+	sut.Add("broker", CheckerFunc(func(ctx context.Context) error { return nil }))
+	sut.Add("storage", CheckerFunc(func(ctx context.Context) error { return errors.New("bucket not found") }))
+
+	// Action
+	report := sut.Run(context.Background(), time.Second)
+
+	// Assert
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, map[string]string{"broker": StatusOK, "storage": "bucket not found"}, report.Checks)
+}
+
+func TestRunShouldCancelChecksAfterTimeout(t *testing.T) {
+	// Arrange
+	sut := NewChecks()
+	sut.Add("slow", CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}))
+
+	// Action
+	report := sut.Run(context.Background(), 10*time.Millisecond)
+
+	// Assert
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"])
+}
+
+func TestHandlerShouldRespondServiceUnavailableWhenCheckFails(t *testing.T) {
+	// Arrange
+	sut := NewChecks()
+	sut.Add("broker", CheckerFunc(func(ctx context.Context) error { return errors.New("connection closed") }))
+
+	// Action
+	recorder := httptest.NewRecorder()
+	sut.Handler(time.Second).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	// Assert
+	var report Report
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&report))
+	assert.Equal(t, "connection closed", report.Checks["broker"])
+}
+
+func TestHandlerShouldRespondOkWithoutChecks(t *testing.T) {
+	// Arrange
+	sut := NewChecks()
+
+	// Action
+	recorder := httptest.NewRecorder()
+	sut.Handler(time.Second).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
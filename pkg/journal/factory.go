@@ -0,0 +1,25 @@
+package journal
+
+import "github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+
+type Journal interface {
+	Get(FileInfo) (Entry, bool)
+	Record(Entry) error
+	Advance(string, State, State) (bool, error)
+	Entries(State) []Entry
+	Close() error
+}
+
+// Create the journal configured by cfg, a memory journal is used when it is disabled.
+func New(cfg Config) (Journal, error) {
+	if !cfg.Enabled {
+		logger.Warning("Journal is disabled, processing state is lost on restart")
+
+		journal := NewMemoryJournal()
+		journal.startPruning(retention(cfg))
+
+		return journal, nil
+	}
+
+	return NewFileJournal(cfg)
+}
@@ -0,0 +1,187 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+const journalFileName = "journal.log"
+
+// Append-only journal, each change is written as a JSON line and synced to disk
+// before being applied. The file is compacted on open and whenever expired entries
+// are removed, keeping only the last state of each file.
+type FileJournal struct {
+	*MemoryJournal
+	path string
+	file *os.File
+}
+
+func NewFileJournal(cfg Config) (*FileJournal, error) {
+	if err := os.MkdirAll(cfg.Directory, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	journalPath := filepath.Join(cfg.Directory, journalFileName)
+
+	memoryJournal := NewMemoryJournal()
+	if err := load(journalPath, memoryJournal.entries); err != nil {
+		return nil, err
+	}
+
+	removeExpired(memoryJournal.entries, retention(cfg))
+
+	file, err := compact(journalPath, memoryJournal.entries)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &FileJournal{
+		MemoryJournal: memoryJournal,
+		path:          journalPath,
+		file:          file,
+	}
+	memoryJournal.persist = journal.write
+	memoryJournal.rewrite = journal.rewrite
+	memoryJournal.startPruning(retention(cfg))
+
+	return journal, nil
+}
+
+func (fj *FileJournal) Close() error {
+	if err := fj.MemoryJournal.Close(); err != nil {
+		return err
+	}
+
+	fj.Lock()
+	defer fj.Unlock()
+
+	return fj.file.Close()
+}
+
+func (fj *FileJournal) write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fj.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return fj.file.Sync()
+}
+
+// Replace the journal file by one with only the entries, the writes continue on the new file.
+func (fj *FileJournal) rewrite(entries map[string]Entry) error {
+	file, err := compact(fj.path, entries)
+	if err != nil {
+		return err
+	}
+
+	if err := fj.file.Close(); err != nil {
+		logger.Warningf("[Journal] Failed to close the compacted file, %s", err)
+	}
+
+	fj.file = file
+
+	return nil
+}
+
+func retention(cfg Config) time.Duration {
+	return time.Duration(cfg.RetentionHours) * time.Hour
+}
+
+func load(journalPath string, entries map[string]Entry) error {
+	file, err := os.Open(journalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), 1024*1024)
+
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A partial line is left behind when the process dies in the middle of a write.
+			logger.Warningf("[Journal] Ignoring invalid entry '%s', %s", scanner.Text(), err)
+
+			continue
+		}
+
+		entries[entry.ID()] = entry
+	}
+
+	return scanner.Err()
+}
+
+// Remove the entries of the finished files not changed within the retention, a file moved but whose event
+// wasn't published yet has its event kept at the outbox. Return how many entries were removed.
+func removeExpired(entries map[string]Entry, retention time.Duration) int {
+	if retention <= 0 {
+		return 0
+	}
+
+	removed := 0
+
+	for id, entry := range entries {
+		if entry.State.IsDone() && time.Since(entry.UpdatedAt) > retention {
+			delete(entries, id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Rewrite the journal with the current entries, the new file replace the old one atomically
+// and is returned open to append the next changes.
+func compact(journalPath string, entries map[string]Entry) (*os.File, error) {
+	tmpPath := journalPath + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_TRUNC|os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+
+			return nil, err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, journalPath); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,200 @@
+package journal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+func newFileInfo(name string) FileInfo {
+	return FileInfo{
+		Name:     name,
+		FilePath: filepath.Join("/data", name),
+		Key:      name,
+		Size:     10,
+		ModTime:  time.Now(),
+	}
+}
+
+func newSut(dir string) *FileJournal {
+	journal, err := NewFileJournal(Config{Enabled: true, Directory: dir})
+	if err != nil {
+		panic(err)
+	}
+
+	return journal
+}
+
+func TestFileJournalShouldRestoreEntriesAfterReopen(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	info := newFileInfo("file.json")
+
+	// Arrange
+	sut := newSut(dir)
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileUploading)))
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileUploaded)))
+	assert.Nil(t, sut.Close())
+
+	// Action
+	sut = newSut(dir)
+	defer sut.Close()
+
+	// Assert
+	entry, ok := sut.Get(info)
+	assert.True(t, ok)
+	assert.Equal(t, models.FileUploaded, entry.State)
+	assert.Equal(t, "files", entry.Topic)
+}
+
+func TestFileJournalShouldCompactEntriesOnOpen(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	info := newFileInfo("file.json")
+
+	// Arrange
+	sut := newSut(dir)
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileCollected)))
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileUploading)))
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileUploaded)))
+	assert.Nil(t, sut.Close())
+
+	// Action
+	sut = newSut(dir)
+	defer sut.Close()
+
+	// Assert
+	data, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bytes.Count(data, []byte("\n")))
+}
+
+func TestFileJournalShouldIgnorePartialEntries(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	info := newFileInfo("file.json")
+
+	// Arrange
+	sut := newSut(dir)
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileMoved)))
+	_, err := sut.file.WriteString(`{"Name":"other`)
+	assert.Nil(t, err)
+	assert.Nil(t, sut.Close())
+
+	// Action
+	sut = newSut(dir)
+	defer sut.Close()
+
+	// Assert
+	entry, ok := sut.Get(info)
+	assert.True(t, ok)
+	assert.Equal(t, models.FileMoved, entry.State)
+}
+
+func TestFileJournalShouldRemoveExpiredEntries(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	info := newFileInfo("file.json")
+	movedInfo := newFileInfo("moved.json")
+	uploadingInfo := newFileInfo("uploading.json")
+
+	// Arrange
+	sut := newSut(dir)
+
+	for file, state := range map[FileInfo]State{
+		info:          models.FilePublished,
+		movedInfo:     models.FileMoved,
+		uploadingInfo: models.FileUploading,
+	} {
+		entry := models.NewJournalEntry(file, "files", state)
+		entry.UpdatedAt = time.Now().Add(-2 * time.Hour)
+		assert.Nil(t, sut.Record(entry))
+	}
+
+	assert.Nil(t, sut.Close())
+
+	// Action
+	sut, err := NewFileJournal(Config{Enabled: true, Directory: dir, RetentionHours: 1})
+	assert.Nil(t, err)
+	defer sut.Close()
+
+	// Assert
+	_, ok := sut.Get(info)
+	assert.False(t, ok)
+
+	_, ok = sut.Get(movedInfo)
+	assert.False(t, ok)
+
+	_, ok = sut.Get(uploadingInfo)
+	assert.True(t, ok)
+}
+
+func TestFileJournalShouldRemoveExpiredEntriesWhileOpen(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+	info := newFileInfo("file.json")
+	uploadingInfo := newFileInfo("uploading.json")
+	collectedInfo := newFileInfo("collected.json")
+
+	sut, err := NewFileJournal(Config{Enabled: true, Directory: dir, RetentionHours: 1})
+	assert.Nil(t, err)
+
+	// Arrange
+	for file, state := range map[FileInfo]State{
+		info:          models.FilePublished,
+		uploadingInfo: models.FileUploading,
+	} {
+		entry := models.NewJournalEntry(file, "files", state)
+		entry.UpdatedAt = time.Now().Add(-2 * time.Hour)
+		assert.Nil(t, sut.Record(entry))
+	}
+
+	// Action
+	err = sut.prune(time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, sut.Record(models.NewJournalEntry(collectedInfo, "files", models.FileCollected)))
+
+	// Assert
+	_, ok := sut.Get(info)
+	assert.False(t, ok)
+
+	data, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")))
+
+	assert.Nil(t, sut.Close())
+
+	sut = newSut(dir)
+	defer sut.Close()
+
+	_, ok = sut.Get(uploadingInfo)
+	assert.True(t, ok)
+
+	_, ok = sut.Get(collectedInfo)
+	assert.True(t, ok)
+}
+
+func TestAdvanceShouldChangeStateOnlyOnce(t *testing.T) {
+	// Prepare
+	info := newFileInfo("file.json")
+
+	// Arrange
+	sut := NewMemoryJournal()
+	assert.Nil(t, sut.Record(models.NewJournalEntry(info, "files", models.FileMoved)))
+
+	// Action
+	first, err := sut.Advance(models.JournalID(info), models.FileMoved, models.FilePublished)
+	assert.Nil(t, err)
+
+	second, err := sut.Advance(models.JournalID(info), models.FileMoved, models.FilePublished)
+	assert.Nil(t, err)
+
+	// Assert
+	assert.True(t, first)
+	assert.False(t, second)
+}
@@ -0,0 +1,13 @@
+package journal
+
+import (
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+type (
+	Config   = config.JournalConfig
+	Entry    = models.JournalEntry
+	FileInfo = models.FileInfo
+	State    = models.FileState
+)
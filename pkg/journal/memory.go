@@ -0,0 +1,173 @@
+package journal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+// Longest interval between the removals of the expired entries.
+const maxPruneInterval = time.Hour
+
+type MemoryJournal struct {
+	sync.Mutex
+	entries map[string]Entry
+	// Called with the lock held before an entry is changed, the change is discarded when it fails
+	persist func(Entry) error
+	// Called with the lock held after expired entries are removed, to rewrite the persisted entries
+	rewrite func(map[string]Entry) error
+
+	stopPruning chan struct{}
+	pruned      chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{
+		entries: make(map[string]Entry),
+		persist: func(Entry) error { return nil },
+		rewrite: func(map[string]Entry) error { return nil },
+	}
+}
+
+func (mj *MemoryJournal) Get(info FileInfo) (Entry, bool) {
+	mj.Lock()
+	defer mj.Unlock()
+
+	entry, ok := mj.entries[models.JournalID(info)]
+
+	return entry, ok
+}
+
+func (mj *MemoryJournal) Record(entry Entry) error {
+	mj.Lock()
+	defer mj.Unlock()
+
+	return mj.record(entry)
+}
+
+// Change the state of the entry with the id only when it is at the expected state, return false if it isn't.
+func (mj *MemoryJournal) Advance(id string, from, to State) (bool, error) {
+	mj.Lock()
+	defer mj.Unlock()
+
+	entry, ok := mj.entries[id]
+	if !ok || entry.State != from {
+		return false, nil
+	}
+
+	entry.State = to
+	entry.UpdatedAt = time.Now()
+
+	if err := mj.record(entry); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Return all entries at the informed state.
+func (mj *MemoryJournal) Entries(state State) []Entry {
+	mj.Lock()
+	defer mj.Unlock()
+
+	entries := []Entry{}
+
+	for _, entry := range mj.entries {
+		if entry.State == state {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+func (mj *MemoryJournal) record(entry Entry) error {
+	current := mj.entries[entry.ID()]
+
+	if entry.Topic == "" {
+		entry.Topic = current.Topic
+	}
+
+	if entry.Checksum.IsEmpty() {
+		entry.Checksum = current.Checksum
+	}
+
+	if entry.CollectedAt.IsZero() {
+		entry.CollectedAt = current.CollectedAt
+	}
+
+	if entry.UploadedAt.IsZero() {
+		entry.UploadedAt = current.UploadedAt
+	}
+
+	if err := mj.persist(entry); err != nil {
+		return err
+	}
+
+	mj.entries[entry.ID()] = entry
+
+	return nil
+}
+
+// Stop removing the expired entries.
+func (mj *MemoryJournal) Close() error {
+	mj.closeOnce.Do(func() {
+		if mj.stopPruning != nil {
+			close(mj.stopPruning)
+			<-mj.pruned
+		}
+	})
+
+	return nil
+}
+
+// Remove the expired entries periodically while the journal is open, a retention of 0 keeps them forever.
+func (mj *MemoryJournal) startPruning(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	interval := retention
+	if interval > maxPruneInterval {
+		interval = maxPruneInterval
+	}
+
+	mj.stopPruning = make(chan struct{})
+	mj.pruned = make(chan struct{})
+
+	go func() {
+		defer close(mj.pruned)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-mj.stopPruning:
+				return
+			case <-ticker.C:
+				if err := mj.prune(retention); err != nil {
+					logger.Errorf("[Journal] Failed to remove the expired entries, %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// Remove the finished entries not changed within the retention, the journal is rewritten when any is removed.
+func (mj *MemoryJournal) prune(retention time.Duration) error {
+	mj.Lock()
+	defer mj.Unlock()
+
+	removed := removeExpired(mj.entries, retention)
+	if removed == 0 {
+		return nil
+	}
+
+	logger.Debugf("[Journal] %d expired entries removed", removed)
+
+	return mj.rewrite(mj.entries)
+}
@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "collector"
+
+var senderLabels = []string{"sender", "topic"}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	filesMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_matched_total",
+		Help:      "Files matched by each collect pattern.",
+	}, append(senderLabels, "pattern"))
+
+	filesUploaded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_uploaded_total",
+		Help:      "Files uploaded to the storage.",
+	}, senderLabels)
+
+	filesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_failed_total",
+		Help:      "Files that failed after all the attempts, by the stage that failed.",
+	}, append(senderLabels, "stage"))
+
+	bytesUploaded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_uploaded_total",
+		Help:      "Bytes uploaded to the storage.",
+	}, senderLabels)
+
+	uploadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_duration_seconds",
+		Help:      "Duration of the file uploads, including the checksum computation.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, senderLabels)
+
+	moveFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "move_failures_total",
+		Help:      "Failed attempts of the after upload action.",
+	}, append(senderLabels, "action"))
+
+	locksLost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "locks_lost_total",
+		Help:      "File locks taken over by another owner while the file was processed.",
+	}, senderLabels)
+
+	eventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_published_total",
+		Help:      "Events sent to the broker, by the file result.",
+	}, append(senderLabels, "result"))
+
+	eventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Events discarded after all the attempts to send them to the broker.",
+	}, append(senderLabels, "result"))
+
+	outboxEvents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "outbox_events",
+		Help:      "Events waiting at the outbox to be sent to the broker.",
+	}, senderLabels)
+
+	deadLetterEvents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dead_letter_events",
+		Help:      "Events at the outbox dead-letter stream, they aren't sent until replayed.",
+	}, senderLabels)
+
+	loopDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "loop_duration_seconds",
+		Help:      "Duration of the sender collect loops.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, senderLabels)
+
+	loopLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "loop_lag_seconds",
+		Help:      "Time the last collect loop exceeded the collect delay, 0 when it finished in time.",
+	}, senderLabels)
+
+	channels = &channelCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "channel_depth"),
+			"Items waiting on the sender channels.",
+			append(senderLabels, "channel"), nil,
+		),
+		depths: make(map[channelKey]*channelDepth),
+	}
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		filesMatched,
+		filesUploaded,
+		filesFailed,
+		bytesUploaded,
+		uploadDuration,
+		moveFailures,
+		locksLost,
+		eventsPublished,
+		eventsDropped,
+		outboxEvents,
+		deadLetterEvents,
+		loopDuration,
+		loopLag,
+		channels,
+	)
+}
+
+// Metrics of a sender, every metric is labeled with the sender id and event topic.
+type Sender struct {
+	id    string
+	topic string
+}
+
+func NewSender(id int, topic string) Sender {
+	return Sender{id: strconv.Itoa(id), topic: topic}
+}
+
+func (s Sender) FilesMatched(pattern string, count int) {
+	filesMatched.WithLabelValues(s.id, s.topic, pattern).Add(float64(count))
+}
+
+func (s Sender) FileUploaded(size int64, duration time.Duration) {
+	filesUploaded.WithLabelValues(s.id, s.topic).Inc()
+	bytesUploaded.WithLabelValues(s.id, s.topic).Add(float64(size))
+	uploadDuration.WithLabelValues(s.id, s.topic).Observe(duration.Seconds())
+}
+
+func (s Sender) FileFailed(stage string) {
+	filesFailed.WithLabelValues(s.id, s.topic, stage).Inc()
+}
+
+func (s Sender) MoveFailed(action string) {
+	moveFailures.WithLabelValues(s.id, s.topic, action).Inc()
+}
+
+func (s Sender) LockLost() {
+	locksLost.WithLabelValues(s.id, s.topic).Inc()
+}
+
+func (s Sender) EventPublished(result string) {
+	eventsPublished.WithLabelValues(s.id, s.topic, result).Inc()
+}
+
+func (s Sender) EventDropped(result string) {
+	eventsDropped.WithLabelValues(s.id, s.topic, result).Inc()
+}
+
+func (s Sender) OutboxSize(size int) {
+	outboxEvents.WithLabelValues(s.id, s.topic).Set(float64(size))
+}
+
+func (s Sender) DeadLetterSize(size int) {
+	deadLetterEvents.WithLabelValues(s.id, s.topic).Set(float64(size))
+}
+
+// Record the loop duration and how much it exceeded the collect delay.
+func (s Sender) LoopFinished(duration, delay time.Duration) {
+	loopDuration.WithLabelValues(s.id, s.topic).Observe(duration.Seconds())
+
+	lag := duration - delay
+	if lag < 0 {
+		lag = 0
+	}
+
+	loopLag.WithLabelValues(s.id, s.topic).Set(lag.Seconds())
+}
+
+// Report the depth of the channel on each scrape, a new call with the same name replaces the previous one.
+// The returned function stops reporting it, unless it was already replaced.
+func (s Sender) ObserveChannel(name string, depth func() int) func() {
+	key := channelKey{sender: s, channel: name}
+	observed := &channelDepth{depth: depth}
+
+	channels.Lock()
+	defer channels.Unlock()
+
+	channels.depths[key] = observed
+
+	return func() {
+		channels.Lock()
+		defer channels.Unlock()
+
+		if channels.depths[key] == observed {
+			delete(channels.depths, key)
+		}
+	}
+}
+
+type channelKey struct {
+	sender  Sender
+	channel string
+}
+
+type channelDepth struct {
+	depth func() int
+}
+
+// Collect the channel depths only when scraped, the channels can't be observed by events.
+type channelCollector struct {
+	sync.Mutex
+	desc   *prometheus.Desc
+	depths map[channelKey]*channelDepth
+}
+
+func (c *channelCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *channelCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+
+	for key, observed := range c.depths {
+		ch <- prometheus.MustNewConstMetric(
+			c.desc, prometheus.GaugeValue, float64(observed.depth()), key.sender.id, key.sender.topic, key.channel,
+		)
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(recorder.Body)
+	assert.Nil(t, err)
+
+	return string(body)
+}
+
+func TestHandlerShouldExposeSenderMetrics(t *testing.T) {
+	// Arrange
+	sut := NewSender(1, "files")
+
+	// Action
+	sut.FilesMatched("./data/*.json", 3)
+	sut.FileUploaded(1024, time.Second)
+	sut.EventPublished("success")
+
+	// Assert
+	body := scrape(t)
+	assert.Contains(t, body, `collector_files_matched_total{pattern="./data/*.json",sender="1",topic="files"} 3`)
+	assert.Contains(t, body, `collector_bytes_uploaded_total{sender="1",topic="files"} 1024`)
+	assert.Contains(t, body, `collector_events_published_total{result="success",sender="1",topic="files"} 1`)
+}
+
+func TestLoopFinishedShouldNotReportNegativeLag(t *testing.T) {
+	// Arrange
+	sut := NewSender(2, "files")
+
+	// Action
+	sut.LoopFinished(time.Second, 5*time.Second)
+
+	// Assert
+	assert.Contains(t, scrape(t), `collector_loop_lag_seconds{sender="2",topic="files"} 0`)
+}
+
+func TestObserveChannelShouldReportDepthOnScrape(t *testing.T) {
+	// Arrange
+	sut := NewSender(3, "files")
+	channel := make(chan int, 5)
+
+	sut.ObserveChannel("event", func() int { return len(channel) })
+
+	// Action
+	channel <- 1
+	channel <- 2
+
+	// Assert
+	assert.Contains(t, scrape(t), `collector_channel_depth{channel="event",sender="3",topic="files"} 2`)
+}
+
+func TestUnobserveChannelShouldStopReportingDepth(t *testing.T) {
+	// Arrange
+	sut := NewSender(4, "files")
+	unobserve := sut.ObserveChannel("event", func() int { return 1 })
+
+	// Action
+	unobserve()
+
+	// Assert
+	assert.NotContains(t, scrape(t), `collector_channel_depth{channel="event",sender="4",topic="files"}`)
+}
+
+func TestUnobserveChannelShouldKeepReplacedChannel(t *testing.T) {
+	// Arrange
+	sut := NewSender(5, "files")
+	unobserve := sut.ObserveChannel("event", func() int { return 1 })
+	sut.ObserveChannel("event", func() int { return 2 })
+
+	// Action
+	unobserve()
+
+	// Assert
+	assert.Contains(t, scrape(t), `collector_channel_depth{channel="event",sender="5",topic="files"} 2`)
+}
@@ -0,0 +1,25 @@
+package outbox
+
+import "github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+
+type Outbox interface {
+	Push(string, Event) error
+	Next(string) (Record, bool)
+	Ack(Record) error
+	Release(Record)
+	Len(string) int
+	Records(string) []Record
+	Durable() bool
+	Close() error
+}
+
+// Create the outbox configured by cfg, a memory outbox is used when it is disabled.
+func New(cfg Config) (Outbox, error) {
+	if !cfg.Enabled {
+		logger.Warning("Outbox is disabled, events waiting for the broker are lost on restart")
+
+		return NewMemoryOutbox(), nil
+	}
+
+	return NewFileOutbox(cfg)
+}
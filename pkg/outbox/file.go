@@ -0,0 +1,229 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/uesleicarvalhoo/go-collector-service/pkg/logger"
+)
+
+const outboxFileName = "outbox.log"
+
+const (
+	// Lines written to the file before it's compacted, besides compactRatio times the pending records.
+	compactMinLines = 1000
+	compactRatio    = 4
+)
+
+// Append-only outbox, each pushed record and each ack is written as a JSON line and synced
+// to disk before being applied. The file is compacted on open and whenever its lines exceed
+// compactRatio times the pending records, keeping only the records not acked, and truncated
+// whenever the last record is acked. Records never acked, like the ones at the dead-letter
+// streams, don't prevent the file from being compacted.
+type FileOutbox struct {
+	*MemoryOutbox
+	path  string
+	file  *os.File
+	lines int
+}
+
+func NewFileOutbox(cfg Config) (*FileOutbox, error) {
+	if err := os.MkdirAll(cfg.Directory, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	outboxPath := filepath.Join(cfg.Directory, outboxFileName)
+
+	records, err := load(outboxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := compact(outboxPath, records)
+	if err != nil {
+		return nil, err
+	}
+
+	memoryOutbox := NewMemoryOutbox()
+
+	for _, record := range records {
+		memoryOutbox.streams[record.Stream] = append(memoryOutbox.streams[record.Stream], record)
+		memoryOutbox.lastID = record.ID
+	}
+
+	if len(records) > 0 {
+		logger.Infof("[Outbox] %d events waiting to be sent to the broker", len(records))
+	}
+
+	outbox := &FileOutbox{
+		MemoryOutbox: memoryOutbox,
+		path:         outboxPath,
+		file:         file,
+		lines:        len(records),
+	}
+	memoryOutbox.persist = outbox.write
+
+	return outbox, nil
+}
+
+func (fo *FileOutbox) Durable() bool {
+	return true
+}
+
+func (fo *FileOutbox) Close() error {
+	fo.Lock()
+	defer fo.Unlock()
+
+	return fo.file.Close()
+}
+
+func (fo *FileOutbox) write(op operation) error {
+	// Nothing is left once the last record is acked, the file can start over.
+	if op.Ack != 0 && fo.size() == 1 {
+		if err := fo.file.Truncate(0); err != nil {
+			return err
+		}
+
+		fo.lines = 0
+
+		return fo.file.Sync()
+	}
+
+	if op.Ack != 0 && fo.lines >= compactMinLines && fo.lines > compactRatio*fo.size() {
+		return fo.rewrite(op.Ack)
+	}
+
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fo.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	fo.lines++
+
+	return fo.file.Sync()
+}
+
+// Replace the file by one with only the pending records, without the acked one, the writes continue on the new file.
+func (fo *FileOutbox) rewrite(acked uint64) error {
+	records := make([]Record, 0, fo.size())
+
+	for _, stream := range fo.streams {
+		for _, record := range stream {
+			if record.ID != acked {
+				records = append(records, record)
+			}
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	file, err := compact(fo.path, records)
+	if err != nil {
+		return err
+	}
+
+	if err := fo.file.Close(); err != nil {
+		logger.Warningf("[Outbox] Failed to close the compacted file, %s", err)
+	}
+
+	fo.file = file
+	fo.lines = len(records)
+
+	return nil
+}
+
+// Read the records not acked, ordered by the push order.
+func load(outboxPath string) ([]Record, error) {
+	file, err := os.Open(outboxPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	pending := make(map[uint64]Record)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), 1024*1024)
+
+	for scanner.Scan() {
+		var op operation
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			// A partial line is left behind when the process dies in the middle of a write.
+			logger.Warningf("[Outbox] Ignoring invalid entry '%s', %s", scanner.Text(), err)
+
+			continue
+		}
+
+		if op.Record != nil {
+			pending[op.Record.ID] = *op.Record
+		}
+
+		delete(pending, op.Ack)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(pending))
+	for _, record := range pending {
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	return records, nil
+}
+
+// Rewrite the outbox with the pending records, the new file replace the old one atomically
+// and is returned open to append the next changes.
+func compact(outboxPath string, records []Record) (*os.File, error) {
+	tmpPath := outboxPath + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_TRUNC|os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for i := range records {
+		if err := encoder.Encode(operation{Record: &records[i]}); err != nil {
+			file.Close()
+
+			return nil, err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, outboxPath); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return file, nil
+}
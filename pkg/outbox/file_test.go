@@ -0,0 +1,149 @@
+package outbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+func newEvent(key string) Event {
+	event, err := models.NewEvent("files", key, map[string]any{"file_path": "/data/file.json"})
+	if err != nil {
+		panic(err)
+	}
+
+	return event
+}
+
+func newSut(dir string) *FileOutbox {
+	outbox, err := NewFileOutbox(Config{Enabled: true, Directory: dir})
+	if err != nil {
+		panic(err)
+	}
+
+	return outbox
+}
+
+func TestFileOutboxShouldRestorePendingRecordsAfterReopen(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+
+	// Arrange
+	sut := newSut(dir)
+	assert.Nil(t, sut.Push("files", newEvent("success")))
+	assert.Nil(t, sut.Push("files", newEvent("error")))
+
+	record, ok := sut.Next("files")
+	assert.True(t, ok)
+	assert.Nil(t, sut.Ack(record))
+	assert.Nil(t, sut.Close())
+
+	// Action
+	sut = newSut(dir)
+	defer sut.Close()
+
+	// Assert
+	record, ok = sut.Next("files")
+	assert.True(t, ok)
+	assert.Equal(t, "error", record.Event.Key)
+	assert.Equal(t, 1, sut.Len("files"))
+}
+
+func TestFileOutboxShouldTruncateFileWhenLastRecordIsAcked(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+
+	// Arrange
+	sut := newSut(dir)
+	defer sut.Close()
+
+	assert.Nil(t, sut.Push("files", newEvent("success")))
+
+	record, ok := sut.Next("files")
+	assert.True(t, ok)
+
+	// Action
+	err := sut.Ack(record)
+
+	// Assert
+	assert.Nil(t, err)
+
+	info, err := os.Stat(filepath.Join(dir, outboxFileName))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestFileOutboxShouldCompactFileWhileRecordsArePending(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+
+	// Arrange
+	sut := newSut(dir)
+	assert.Nil(t, sut.Push("files:dead-letter", newEvent("success")))
+
+	// Action
+	for i := 0; i < compactMinLines; i++ {
+		assert.Nil(t, sut.Push("files", newEvent("success")))
+
+		record, ok := sut.Next("files")
+		assert.True(t, ok)
+		assert.Nil(t, sut.Ack(record))
+	}
+
+	// Assert
+	data, err := os.ReadFile(filepath.Join(dir, outboxFileName))
+	assert.Nil(t, err)
+	assert.Less(t, bytes.Count(data, []byte("\n")), compactMinLines)
+
+	assert.Nil(t, sut.Close())
+
+	sut = newSut(dir)
+	defer sut.Close()
+
+	assert.Equal(t, 1, sut.Len("files:dead-letter"))
+	assert.Equal(t, 0, sut.Len("files"))
+}
+
+func TestFileOutboxShouldIgnorePartialEntries(t *testing.T) {
+	// Prepare
+	dir := t.TempDir()
+
+	// Arrange
+	sut := newSut(dir)
+	assert.Nil(t, sut.Push("files", newEvent("success")))
+	_, err := sut.file.WriteString(`{"record":{"id":2`)
+	assert.Nil(t, err)
+	assert.Nil(t, sut.Close())
+
+	// Action
+	sut = newSut(dir)
+	defer sut.Close()
+
+	// Assert
+	assert.Equal(t, 1, sut.Len("files"))
+}
+
+func TestNextShouldNotReturnRecordBeingSent(t *testing.T) {
+	// Arrange
+	sut := NewMemoryOutbox()
+	assert.Nil(t, sut.Push("files", newEvent("success")))
+	assert.Nil(t, sut.Push("files", newEvent("error")))
+
+	first, ok := sut.Next("files")
+	assert.True(t, ok)
+
+	// Action
+	_, whileSending := sut.Next("files")
+
+	sut.Release(first)
+	again, afterRelease := sut.Next("files")
+
+	// Assert
+	assert.False(t, whileSending)
+	assert.True(t, afterRelease)
+	assert.Equal(t, first.ID, again.ID)
+}
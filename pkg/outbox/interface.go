@@ -0,0 +1,12 @@
+package outbox
+
+import (
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+type (
+	Config = config.OutboxConfig
+	Event  = models.Event
+	Record = models.OutboxRecord
+)
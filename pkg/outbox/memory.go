@@ -0,0 +1,142 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+)
+
+// Change written to the outbox, either a new record or the ack of a sent one.
+type operation struct {
+	Record *Record `json:"record,omitempty"`
+	Ack    uint64  `json:"ack,omitempty"`
+}
+
+type MemoryOutbox struct {
+	sync.Mutex
+	streams  map[string][]Record
+	inFlight map[uint64]bool
+	lastID   uint64
+	// Called with the lock held before a change is applied, the change is discarded when it fails
+	persist func(operation) error
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{
+		streams:  make(map[string][]Record),
+		inFlight: make(map[uint64]bool),
+		persist:  func(operation) error { return nil },
+	}
+}
+
+// Add the event at the end of the stream.
+func (mo *MemoryOutbox) Push(stream string, event Event) error {
+	mo.Lock()
+	defer mo.Unlock()
+
+	record := Record{
+		ID:        mo.lastID + 1,
+		Stream:    stream,
+		Event:     event,
+		CreatedAt: time.Now(),
+	}
+
+	if err := mo.persist(operation{Record: &record}); err != nil {
+		return err
+	}
+
+	mo.lastID = record.ID
+	mo.streams[stream] = append(mo.streams[stream], record)
+
+	return nil
+}
+
+// Return the oldest record of the stream, false when it is empty or the oldest record is being sent.
+// The record must be acked once sent or released when it fails, so the next call returns it again.
+func (mo *MemoryOutbox) Next(stream string) (Record, bool) {
+	mo.Lock()
+	defer mo.Unlock()
+
+	records := mo.streams[stream]
+	if len(records) == 0 || mo.inFlight[records[0].ID] {
+		return Record{}, false
+	}
+
+	mo.inFlight[records[0].ID] = true
+
+	return records[0], true
+}
+
+// Remove the sent record from the outbox.
+func (mo *MemoryOutbox) Ack(record Record) error {
+	mo.Lock()
+	defer mo.Unlock()
+
+	records := mo.streams[record.Stream]
+
+	for i := range records {
+		if records[i].ID != record.ID {
+			continue
+		}
+
+		if err := mo.persist(operation{Ack: record.ID}); err != nil {
+			return err
+		}
+
+		delete(mo.inFlight, record.ID)
+
+		if len(records) == 1 {
+			delete(mo.streams, record.Stream)
+		} else {
+			mo.streams[record.Stream] = append(records[:i:i], records[i+1:]...)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// Keep the record that couldn't be sent, it is returned again by the next call to Next.
+func (mo *MemoryOutbox) Release(record Record) {
+	mo.Lock()
+	defer mo.Unlock()
+
+	delete(mo.inFlight, record.ID)
+}
+
+// Number of records waiting at the stream, including the one being sent.
+func (mo *MemoryOutbox) Len(stream string) int {
+	mo.Lock()
+	defer mo.Unlock()
+
+	return len(mo.streams[stream])
+}
+
+// Copy of the records waiting at the stream, in the send order.
+func (mo *MemoryOutbox) Records(stream string) []Record {
+	mo.Lock()
+	defer mo.Unlock()
+
+	return append([]Record{}, mo.streams[stream]...)
+}
+
+// Records kept only in memory are lost on restart.
+func (mo *MemoryOutbox) Durable() bool {
+	return false
+}
+
+// Don't do anything, just keep compatibility.
+func (mo *MemoryOutbox) Close() error {
+	return nil
+}
+
+// Number of records waiting at all streams, must be called with the lock held.
+func (mo *MemoryOutbox) size() int {
+	size := 0
+
+	for _, records := range mo.streams {
+		size += len(records)
+	}
+
+	return size
+}
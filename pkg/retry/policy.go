@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Max delay between attempts when the policy doesn't inform one.
+const DefaultMaxBackoff = time.Hour
+
+// Highest exponent of the backoff, any base delay doubled this many times is over the max backoff.
+const maxExponent = 62
+
+type Policy struct {
+	// Max attempts of each operation, 0 or 1 don't retry
+	MaxAttempts int `yaml:"maxAttempts" json:"maxAttempts"`
+	// Delay before the first retry, doubled on each attempt
+	BaseBackoff time.Duration `yaml:"baseBackoff" json:"baseBackoff"`
+	// Max delay between attempts, 0 uses the DefaultMaxBackoff
+	MaxBackoff time.Duration `yaml:"maxBackoff" json:"maxBackoff"`
+	// Fraction of the delay randomly added or removed, between 0 and 1
+	Jitter float64 `yaml:"jitter" json:"jitter"`
+}
+
+// Run fn until it succeeds, the attempts are exhausted, it returns a permanent error or the context is done.
+// The error of the last attempt is returned.
+func (p Policy) Do(ctx context.Context, fn func(attempt int) error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(attempt); err == nil {
+			return nil
+		}
+
+		if attempt >= p.MaxAttempts || IsPermanent(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.Backoff(attempt)):
+		}
+	}
+}
+
+// Delay to wait after the informed attempt.
+func (p Policy) Backoff(attempt int) time.Duration {
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	// The exponent is limited so the power doesn't overflow to +Inf on high attempts.
+	delay := float64(p.BaseBackoff) * math.Pow(2, math.Min(float64(attempt-1), maxExponent))
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1) // nolint:gosec
+	}
+
+	return time.Duration(delay)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Mark the error as one that fails again on the next attempts, so it isn't retried.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent permanentError
+
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,137 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTest = errors.New("test error")
+
+func TestDoShouldRetryUntilSuccess(t *testing.T) {
+	// Arrange
+	sut := Policy{MaxAttempts: 3}
+	calls := 0
+
+	// Action
+	err := sut.Do(context.TODO(), func(attempt int) error {
+		calls++
+		if attempt < 2 {
+			return errTest
+		}
+
+		return nil
+	})
+
+	// Assert
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDoShouldReturnLastErrorWhenAttemptsAreExhausted(t *testing.T) {
+	// Arrange
+	sut := Policy{MaxAttempts: 3}
+	calls := 0
+
+	// Action
+	err := sut.Do(context.TODO(), func(attempt int) error {
+		calls++
+
+		return errTest
+	})
+
+	// Assert
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDoShouldRunOnceWhenMaxAttemptsIsZero(t *testing.T) {
+	// Arrange
+	sut := Policy{}
+	calls := 0
+
+	// Action
+	err := sut.Do(context.TODO(), func(attempt int) error {
+		calls++
+
+		return errTest
+	})
+
+	// Assert
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoShouldStopWhenContextIsDone(t *testing.T) {
+	// Arrange
+	sut := Policy{MaxAttempts: 3, BaseBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+
+	// Action
+	err := sut.Do(ctx, func(attempt int) error {
+		calls++
+
+		return errTest
+	})
+
+	// Assert
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, 1, calls)
+}
+
+func TestBackoffShouldBeExponentialAndLimited(t *testing.T) {
+	// Arrange
+	sut := Policy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	// Assert
+	assert.Equal(t, time.Second, sut.Backoff(1))
+	assert.Equal(t, 2*time.Second, sut.Backoff(2))
+	assert.Equal(t, 4*time.Second, sut.Backoff(3))
+	assert.Equal(t, 5*time.Second, sut.Backoff(4))
+}
+
+func TestBackoffShouldBeLimitedByDefaultOnHighAttempts(t *testing.T) {
+	// Arrange
+	sut := Policy{BaseBackoff: time.Second}
+
+	// Assert
+	assert.Equal(t, DefaultMaxBackoff, sut.Backoff(5000))
+	assert.Equal(t, 5*time.Second, Policy{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}.Backoff(5000))
+	assert.Equal(t, time.Duration(0), Policy{}.Backoff(5000))
+}
+
+func TestBackoffShouldApplyJitter(t *testing.T) {
+	// Arrange
+	sut := Policy{BaseBackoff: time.Second, Jitter: 0.5}
+
+	// Action
+	delay := sut.Backoff(1)
+
+	// Assert
+	assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+	assert.LessOrEqual(t, delay, 1500*time.Millisecond)
+}
+
+func TestDoShouldNotRetryPermanentErrors(t *testing.T) {
+	// Arrange
+	sut := Policy{MaxAttempts: 3}
+	calls := 0
+
+	// Action
+	err := sut.Do(context.TODO(), func(attempt int) error {
+		calls++
+
+		return Permanent(errTest)
+	})
+
+	// Assert
+	assert.True(t, errors.Is(err, errTest))
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, calls)
+}
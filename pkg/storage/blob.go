@@ -35,7 +35,26 @@ func NewBlobStorage(config Config) (*BlobStorage, error) {
 	}, nil
 }
 
-func (svc *BlobStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker) error {
+// Check if the container exists and is accessible.
+func (svc *BlobStorage) HealthCheck(ctx context.Context) error {
+	containerURL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", svc.user, svc.container))
+	if err != nil {
+		return err
+	}
+
+	container := azblob.NewContainerURL(*containerURL, azblob.NewPipeline(svc.credentials, azblob.PipelineOptions{}))
+	_, err = container.GetProperties(ctx, azblob.LeaseAccessConditions{})
+
+	return err
+}
+
+func (svc *BlobStorage) Locate(fileKey string) (string, string) {
+	return svc.container, fileKey
+}
+
+// The MD5 checksum is stored as the blob Content-MD5 property. When the checksums weren't computed before the
+// upload, the ones computed while the content was read are set as the blob metadata after it.
+func (svc *BlobStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker, checksum Checksum) error {
 	fileURL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", svc.user, svc.container, fileKey))
 	if err != nil {
 		return err
@@ -43,8 +62,10 @@ func (svc *BlobStorage) SendFile(ctx context.Context, fileKey string, reader io.
 
 	blobURL := azblob.NewBlockBlobURL(*fileURL, azblob.NewPipeline(svc.credentials, azblob.PipelineOptions{}))
 	options := azblob.UploadStreamToBlockBlobOptions{
-		BufferSize: uploadBufferSize,
-		MaxBuffers: uploadMaxBuffers,
+		BufferSize:      uploadBufferSize,
+		MaxBuffers:      uploadMaxBuffers,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentMD5: checksum.MD5},
+		Metadata:        checksumMetadata(checksum),
 	}
 
 	_, err = azblob.UploadStreamToBlockBlob(ctx, reader, blobURL, options)
@@ -52,5 +73,17 @@ func (svc *BlobStorage) SendFile(ctx context.Context, fileKey string, reader io.
 		return err
 	}
 
-	return nil
+	if !checksum.IsEmpty() {
+		return nil
+	}
+
+	if streamed, ok := reader.(ChecksumReader); ok {
+		if checksum, ok = streamed.Checksum(); ok {
+			_, err = blobURL.SetMetadata(
+				ctx, checksumMetadata(checksum), azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{},
+			)
+		}
+	}
+
+	return err
 }
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownStorageType = errors.New("unknown storage type")
+
+type Client interface {
+	SendFile(context.Context, string, io.ReadSeeker, Checksum) error
+	HealthCheck(context.Context) error
+	Locate(string) (string, string)
+}
+
+type Factory func(cfg Config) (Client, error)
+
+// Registered storage factories, indexed by the STORAGE_TYPE value.
+var (
+	factoriesMu sync.RWMutex          // nolint:gochecknoglobals
+	factories   = map[string]Factory{ // nolint:gochecknoglobals
+		"s3": func(cfg Config) (Client, error) {
+			return NewS3Storage(cfg, cfg.Region), nil
+		},
+		"blob": func(cfg Config) (Client, error) {
+			return NewBlobStorage(cfg)
+		},
+		"memory": func(cfg Config) (Client, error) {
+			return NewMemoryStorage(), nil
+		},
+		"none": func(cfg Config) (Client, error) {
+			return NewNoneStorage(), nil
+		},
+	}
+)
+
+// Register a new storage factory, an existing factory with the same name is replaced.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	factories[strings.ToLower(name)] = factory
+}
+
+// Create the storage client configured by cfg.Type.
+func New(cfg Config) (Client, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[strings.ToLower(strings.TrimSpace(cfg.Type))]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownStorageType, "'%s'", cfg.Type)
+	}
+
+	return factory(cfg)
+}
@@ -1,5 +1,31 @@
 package storage
 
-import "github.com/uesleicarvalhoo/go-collector-service/internal/config"
+import (
+	"io"
 
-type Config = config.StorageConfig
+	"github.com/uesleicarvalhoo/go-collector-service/internal/config"
+	"github.com/uesleicarvalhoo/go-collector-service/internal/models"
+)
+
+type (
+	Config   = config.StorageConfig
+	Checksum = models.Checksum
+)
+
+// Reader computing the checksums while it's read, the storages that can send them after the content get them
+// from it when the checksums weren't computed before the upload.
+type ChecksumReader interface {
+	io.ReadSeeker
+	Checksum() (Checksum, bool)
+}
+
+// Object metadata with the hex encoded digests, prefixed by "checksum-".
+func checksumMetadata(checksum Checksum) map[string]string {
+	metadata := map[string]string{}
+
+	for name, digest := range checksum.Hex() {
+		metadata["checksum-"+name] = digest
+	}
+
+	return metadata
+}
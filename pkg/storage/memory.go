@@ -1,14 +1,19 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"io"
 	"io/ioutil"
 	"sync"
 )
 
-var ErrFileKeyNotFound = errors.New("fileKey not found")
+var (
+	ErrFileKeyNotFound  = errors.New("fileKey not found")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
 
 type MemoryStorage struct {
 	storedFiles map[string][]byte
@@ -21,7 +26,8 @@ func NewMemoryStorage() *MemoryStorage {
 	}
 }
 
-func (ms *MemoryStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker) error {
+// The SHA256 checksum is validated like the cloud storages do.
+func (ms *MemoryStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker, checksum Checksum) error {
 	ms.Lock()
 	defer ms.Unlock()
 
@@ -30,11 +36,26 @@ func (ms *MemoryStorage) SendFile(ctx context.Context, fileKey string, reader io
 		return err
 	}
 
+	if len(checksum.SHA256) > 0 {
+		if digest := sha256.Sum256(data); !bytes.Equal(digest[:], checksum.SHA256) {
+			return ErrChecksumMismatch
+		}
+	}
+
 	ms.storedFiles[fileKey] = data
 
 	return nil
 }
 
+func (ms *MemoryStorage) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Files are kept only in memory, there isn't a bucket.
+func (ms *MemoryStorage) Locate(fileKey string) (string, string) {
+	return "", fileKey
+}
+
 func (ms *MemoryStorage) GetFile(fileKey string) ([]byte, error) {
 	ms.Lock()
 	defer ms.Unlock()
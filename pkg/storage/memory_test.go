@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorageSendFileShouldReturnErrorWhenChecksumMismatch(t *testing.T) {
+	// Arrange
+	sut := NewMemoryStorage()
+	digest := sha256.Sum256([]byte("other content"))
+
+	// Action
+	err := sut.SendFile(context.TODO(), "file.json", bytes.NewReader([]byte("{}")), Checksum{SHA256: digest[:]})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.False(t, sut.FileExists("file.json"))
+}
+
+func TestChecksumMetadataShouldContainHexDigests(t *testing.T) {
+	// Arrange
+	checksum := Checksum{SHA256: []byte{0xab}, MD5: []byte{0xcd}}
+
+	// Action
+	metadata := checksumMetadata(checksum)
+
+	// Assert
+	assert.Equal(t, map[string]string{"checksum-sha256": "ab", "checksum-md5": "cd"}, metadata)
+}
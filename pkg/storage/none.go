@@ -9,12 +9,21 @@ import (
 
 type NoneStorage struct{}
 
-func (ns *NoneStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker) error {
+func (ns *NoneStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker, checksum Checksum) error {
 	logger.Debugf("File received, %+v", fileKey)
 
 	return nil
 }
 
+func (ns *NoneStorage) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Files are discarded, there isn't a bucket.
+func (ns *NoneStorage) Locate(fileKey string) (string, string) {
+	return "", fileKey
+}
+
 func NewNoneStorage() *NoneStorage {
 	return &NoneStorage{}
 }
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"path"
+)
+
+// Storage wrapper which prepend a prefix to every file key.
+type PrefixedStorage struct {
+	prefix  string
+	storage Client
+}
+
+func NewPrefixedStorage(storage Client, prefix string) *PrefixedStorage {
+	return &PrefixedStorage{
+		prefix:  prefix,
+		storage: storage,
+	}
+}
+
+func (ps *PrefixedStorage) HealthCheck(ctx context.Context) error {
+	return ps.storage.HealthCheck(ctx)
+}
+
+func (ps *PrefixedStorage) Locate(fileKey string) (string, string) {
+	return ps.storage.Locate(path.Join(ps.prefix, fileKey))
+}
+
+func (ps *PrefixedStorage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker, checksum Checksum) error {
+	return ps.storage.SendFile(ctx, path.Join(ps.prefix, fileKey), reader, checksum)
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixedStorageSendFileShouldPrependPrefix(t *testing.T) {
+	// Prepare
+	memoryStorage := NewMemoryStorage()
+
+	// Arrange
+	sut := NewPrefixedStorage(memoryStorage, "domain_1/")
+
+	// Action
+	err := sut.SendFile(context.TODO(), "file.json", bytes.NewReader([]byte("{}")), Checksum{})
+	assert.Nil(t, err)
+
+	// Assert
+	assert.True(t, memoryStorage.FileExists("domain_1/file.json"))
+}
+
+func TestPrefixedStorageLocateShouldPrependPrefix(t *testing.T) {
+	// Arrange
+	sut := NewPrefixedStorage(NewS3Storage(Config{Bucket: "files"}, "sa-east-1"), "domain_1/")
+
+	// Action
+	bucket, objectKey := sut.Locate("file.json")
+
+	// Assert
+	assert.Equal(t, "files", bucket)
+	assert.Equal(t, "domain_1/file.json", objectKey)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
 	"io"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -24,12 +25,37 @@ func NewS3Storage(cfg Config, region string) *S3Storage {
 	}
 }
 
-func (svc *S3Storage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker) error {
-	_, err := s3.New(svc.session).PutObjectWithContext(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(svc.bucketName),
-		Key:    aws.String(fileKey),
-		Body:   reader,
-	})
+// Check if the bucket exists and is accessible.
+func (svc *S3Storage) HealthCheck(ctx context.Context) error {
+	_, err := s3.New(svc.session).HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(svc.bucketName)})
+
+	return err
+}
+
+func (svc *S3Storage) Locate(fileKey string) (string, string) {
+	return svc.bucketName, fileKey
+}
+
+// The checksums are sent as x-amz-checksum-sha256 and Content-MD5, S3 reject the upload when they don't match.
+// aws-sdk-go doesn't send trailing checksums, so the ones computed while the content is read aren't sent, the
+// content is still validated by S3 with the payload hash of the request signature.
+func (svc *S3Storage) SendFile(ctx context.Context, fileKey string, reader io.ReadSeeker, checksum Checksum) error {
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(svc.bucketName),
+		Key:      aws.String(fileKey),
+		Body:     reader,
+		Metadata: aws.StringMap(checksumMetadata(checksum)),
+	}
+
+	if len(checksum.SHA256) > 0 {
+		input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(checksum.SHA256))
+	}
+
+	if len(checksum.MD5) > 0 {
+		input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(checksum.MD5))
+	}
+
+	_, err := s3.New(svc.session).PutObjectWithContext(ctx, input)
 
 	return err
 }
@@ -2,10 +2,19 @@ package trace
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
@@ -13,12 +22,48 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// Exporters of the finished spans.
+const (
+	// Jaeger collector over HTTP
+	ExporterJaeger = "jaeger"
+	// OpenTelemetry protocol over gRPC
+	ExporterOTLPGRPC = "otlp-grpc"
+	// OpenTelemetry protocol over HTTP, with protobuf payloads
+	ExporterOTLPHTTP = "otlp-http"
+	// Spans written as JSON to the standard output, useful for debugging
+	ExporterStdout = "stdout"
+)
+
+const jaegerCollectorPath = "/api/traces"
+
+// Used when the endpoint isn't set.
+var defaultEndpoints = map[string]string{ // nolint:gochecknoglobals
+	ExporterJaeger:   "http://localhost:14268" + jaegerCollectorPath,
+	ExporterOTLPGRPC: "localhost:4317",
+	ExporterOTLPHTTP: "localhost:4318",
+}
+
+var (
+	ErrUnknownExporter    = errors.New("unknown trace exporter")
+	ErrInvalidSampleRatio = errors.New("trace sample ratio must be between 0 and 1")
+)
+
 type ProviderConfig struct {
-	JaegerEndpoint string
+	// One of jaeger, otlp-grpc, otlp-http or stdout, empty is the same as jaeger
+	Exporter string
+	// Collector address, each exporter has its default. The OTLP exporters accept host:port or an URL,
+	// the http scheme disables TLS
+	Endpoint string
+	// Send the OTLP spans without TLS
+	Insecure bool
+	// Fraction of the new traces that are sampled, the spans with a remote parent follow its decision
+	SampleRatio    float64
 	ServiceName    string
 	ServiceVersion string
 	Environment    string
-	Disabled       bool
+	// Extra attributes of the resource, like the host or the deployment region
+	ResourceAttributes map[string]string
+	Disabled           bool
 }
 
 type Provider struct {
@@ -32,21 +77,19 @@ func NewProvider(config ProviderConfig) (Provider, error) {
 		return Provider{Provider: trace.NewNoopTracerProvider()}, nil
 	}
 
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(config.JaegerEndpoint)))
+	if config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return Provider{}, fmt.Errorf("%w, got %v", ErrInvalidSampleRatio, config.SampleRatio)
+	}
+
+	exp, err := newExporter(config)
 	if err != nil {
-		return Provider{}, nil
+		return Provider{}, err
 	}
 
 	prv := tracesdk.NewTracerProvider(
 		tracesdk.WithBatcher(exp),
-		tracesdk.WithResource(
-			resource.NewWithAttributes(
-				semconv.SchemaURL,
-				semconv.ServiceNameKey.String(config.ServiceName),
-				semconv.ServiceVersionKey.String(config.ServiceVersion),
-				attribute.String("environment", config.Environment),
-			),
-		),
+		tracesdk.WithSampler(tracesdk.ParentBased(tracesdk.TraceIDRatioBased(config.SampleRatio))),
+		tracesdk.WithResource(newResource(config)),
 	)
 
 	otel.SetTracerProvider(prv)
@@ -67,3 +110,106 @@ func (p *Provider) Close(ctx context.Context) error {
 
 	return nil
 }
+
+func newExporter(config ProviderConfig) (tracesdk.SpanExporter, error) {
+	exporter := strings.ToLower(strings.TrimSpace(config.Exporter))
+	if exporter == "" {
+		exporter = ExporterJaeger
+	}
+
+	endpoint := strings.TrimSpace(config.Endpoint)
+	if endpoint == "" {
+		endpoint = defaultEndpoints[exporter]
+	}
+
+	var (
+		exp tracesdk.SpanExporter
+		err error
+	)
+
+	switch exporter {
+	case ExporterJaeger:
+		exp, err = jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(jaegerEndpoint(endpoint))))
+
+	case ExporterOTLPGRPC:
+		address, insecure := otlpAddress(endpoint, config.Insecure)
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(address.Host)}
+
+		if insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+
+		exp, err = otlptracegrpc.New(context.Background(), options...)
+
+	case ExporterOTLPHTTP:
+		address, insecure := otlpAddress(endpoint, config.Insecure)
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(address.Host)}
+
+		if address.Path != "" && address.Path != "/" {
+			options = append(options, otlptracehttp.WithURLPath(address.Path))
+		}
+
+		if insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+
+		exp, err = otlptracehttp.New(context.Background(), options...)
+
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownExporter, config.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create the %s trace exporter, %w", exporter, err)
+	}
+
+	return exp, nil
+}
+
+// The collector URL without a path is completed with the default path of the Jaeger collector.
+func jaegerEndpoint(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && strings.Trim(u.Path, "/") == "" {
+		return strings.TrimSuffix(endpoint, "/") + jaegerCollectorPath
+	}
+
+	return endpoint
+}
+
+// Split an OTLP endpoint given as host:port or URL, an http URL is always insecure.
+func otlpAddress(endpoint string, insecure bool) (*url.URL, bool) {
+	if !strings.Contains(endpoint, "://") {
+		return &url.URL{Host: endpoint}, insecure
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return &url.URL{Host: endpoint}, insecure
+	}
+
+	return u, insecure || u.Scheme == "http"
+}
+
+func newResource(config ProviderConfig) *resource.Resource {
+	attributes := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(config.ServiceName),
+		semconv.ServiceVersionKey.String(config.ServiceVersion),
+		attribute.String("environment", config.Environment),
+	}
+
+	keys := make([]string, 0, len(config.ResourceAttributes))
+	for key := range config.ResourceAttributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	// The service attributes set above can be overridden, the last value of a key is kept.
+	for _, key := range keys {
+		attributes = append(attributes, attribute.String(key, config.ResourceAttributes[key]))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attributes...)
+}
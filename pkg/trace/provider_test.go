@@ -0,0 +1,70 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestNewProviderShouldReturnErrorOfUnknownExporter(t *testing.T) {
+	// Action
+	_, err := NewProvider(ProviderConfig{Exporter: "zipkin", SampleRatio: 1})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrUnknownExporter)
+}
+
+func TestNewProviderShouldReturnErrorOfInvalidSampleRatio(t *testing.T) {
+	// Action
+	_, err := NewProvider(ProviderConfig{Exporter: ExporterStdout, SampleRatio: 1.5})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrInvalidSampleRatio)
+}
+
+func TestJaegerEndpointShouldAddCollectorPath(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{endpoint: "http://jaeger:14268", expected: "http://jaeger:14268/api/traces"},
+		{endpoint: "http://jaeger:14268/", expected: "http://jaeger:14268/api/traces"},
+		{endpoint: "http://jaeger:14268/custom/traces", expected: "http://jaeger:14268/custom/traces"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			assert.Equal(t, tc.expected, jaegerEndpoint(tc.endpoint))
+		})
+	}
+}
+
+func TestOTLPAddressShouldBeInsecureWithHTTPScheme(t *testing.T) {
+	// Action
+	address, insecure := otlpAddress("http://collector:4318/custom/v1/traces", false)
+
+	// Assert
+	assert.True(t, insecure)
+	assert.Equal(t, "collector:4318", address.Host)
+	assert.Equal(t, "/custom/v1/traces", address.Path)
+}
+
+func TestNewResourceShouldOverrideServiceAttributes(t *testing.T) {
+	// Arrange
+	config := ProviderConfig{
+		ServiceName:        "go-collector",
+		Environment:        "dev",
+		ResourceAttributes: map[string]string{"environment": "prod", "region": "sa-east-1"},
+	}
+
+	// Action
+	res := newResource(config)
+
+	// Assert
+	environment, _ := res.Set().Value(attribute.Key("environment"))
+	region, _ := res.Set().Value(attribute.Key("region"))
+
+	assert.Equal(t, "prod", environment.AsString())
+	assert.Equal(t, "sa-east-1", region.AsString())
+}
@@ -6,6 +6,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -20,6 +21,28 @@ func NewSpan(ctx context.Context, name string) (context.Context, trace.Span) {
 	return otel.Tracer(serviceName).Start(ctx, name)
 }
 
+// Span of a message sent to a broker, its context should be injected on the message.
+func NewProducerSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(serviceName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindProducer))
+}
+
+// Encode the span context as the W3C trace context headers, empty when there isn't a span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return carrier
+}
+
+// Return a context with the span context encoded on the headers as the remote parent.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
+
 func AddSpanTags(span trace.Span, tags map[string]string) {
 	list := []attribute.KeyValue{}
 
@@ -48,6 +71,16 @@ func FailSpan(span trace.Span, message string) {
 	span.SetStatus(codes.Error, message)
 }
 
+// ID of the trace of the span at the context, empty when there isn't a recording span.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+
+	return spanContext.TraceID().String()
+}
+
 func SpanFromContext(ctx context.Context) trace.Span {
 	return trace.SpanFromContext(ctx)
 }